@@ -25,6 +25,8 @@ const (
 	DefaultTlsSecret = "gesher-tls"
 	DefaultService   = "gesher"
 	DefaultHttpsPort = 8443
+
+	DefaultServiceAccount = "gesher"
 )
 
 var (
@@ -32,4 +34,14 @@ var (
 	TlsSecret = flag.String("tls-secret", DefaultTlsSecret, "secret to fetch and store tls files from")
 	Service   = flag.String("service-name", DefaultService, "service name to use for gesher")
 	Port      = flag.Int("port", DefaultHttpsPort, "port https server should run on")
+
+	ServiceAccount = flag.String("service-account", DefaultServiceAccount, "service account gesher runs as, never recorded as the creator of a rule")
+
+	ProxyAuth     = flag.String("proxy-auth", "", "authentication of the callers of the proxy: \"client-cert\", \"token\", or none when empty")
+	ProxyClientCA = flag.String("proxy-client-ca", "", "file of the CA verifying client certificates with client-cert proxy authentication. "+
+		"The webhook server then requires a client certificate on every path, so probes can't use https.")
+	ProxyAllowedNames = flag.String("proxy-allowed-names", "", "comma separated client certificate common names, or token usernames, "+
+		"allowed to call the proxy. Any authenticated caller is when empty.")
+	ProxyTokenAudiences = flag.String("proxy-token-audiences", "", "comma separated audiences tokens are reviewed for with token proxy authentication")
+	ProxyPanicPolicy    = flag.String("proxy-panic-policy", "Fail", "whether requests the proxy panics on are allowed (\"Ignore\") or denied (\"Fail\")")
 )
@@ -31,6 +31,7 @@ import (
 	"github.com/redislabs/gesher/cmd/manager/flags"
 	"github.com/redislabs/gesher/pkg/common"
 	"github.com/redislabs/gesher/pkg/tls_manager"
+	admregv1 "k8s.io/api/admissionregistration/v1"
 	"k8s.io/client-go/kubernetes"
 
 	"go.uber.org/zap"
@@ -45,12 +46,14 @@ import (
 	admission_proxy "github.com/redislabs/gesher/pkg/admission-proxy"
 	"github.com/redislabs/gesher/pkg/apis"
 	"github.com/redislabs/gesher/pkg/controller"
+	crd_webhook "github.com/redislabs/gesher/pkg/crd-webhook"
 	"github.com/redislabs/gesher/version"
 
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 // Change below variables to serve metrics on different host or port.
@@ -110,6 +113,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Register the webhook validating gesher's own resources
+	err = setupCRDWebhook(cfg)
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
 	ctx := context.TODO()
 	// Become the leader before proceeding
 	err = leader.Become(ctx, "gesher-lock")
@@ -154,7 +164,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupWebhook(mgr)
+	err = setupWebhook(mgr)
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
 
 	log.Info("Starting the Cmd.")
 
@@ -172,7 +186,7 @@ func (h Healthz) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
-func setupWebhook(mgr manager.Manager) {
+func setupWebhook(mgr manager.Manager) error {
 	// TODO: hack to not annoy linter to enable code to remain
 	//	enableWebhook := os.Getenv("ENABLE_WEBHOOK")
 	//	if enableWebhook == "yes" {
@@ -183,10 +197,97 @@ func setupWebhook(mgr manager.Manager) {
 	server.KeyName = common.PrivPem
 	server.Port = 8443
 
-	// register objects that serve the 2 primary endpoints
+	validator, err := crd_webhook.NewValidator(mgr.GetClient(), mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
+	mutator, err := crd_webhook.NewMutator(mgr.GetClient(), mgr.GetScheme(), crd_webhook.ServiceAccountUsername(*flags.Namespace, *flags.ServiceAccount))
+	if err != nil {
+		return err
+	}
+
+	authenticator, err := proxyAuthenticator(mgr, server)
+	if err != nil {
+		return err
+	}
+
+	panicPolicy := admregv1.FailurePolicyType(*flags.ProxyPanicPolicy)
+	if panicPolicy != admregv1.Fail && panicPolicy != admregv1.Ignore {
+		return fmt.Errorf("unknown proxy panic policy %q", panicPolicy)
+	}
+
+	// register objects that serve the primary endpoints
 	server.Register("/healthz", &Healthz{})
-	server.Register(common.ProxyPath, &admission_proxy.Handler{})
+	server.Register(common.ProxyPath, &admission_proxy.Handler{Authenticator: authenticator, PanicPolicy: panicPolicy})
+	server.Register(common.ValidatePath, &webhook.Admission{Handler: validator})
+	server.Register(common.MutatePath, &webhook.Admission{Handler: mutator})
 	//	}
+
+	return nil
+}
+
+// proxyAuthenticator returns the authenticator of the proxy's callers flags ask for, configuring server for it
+func proxyAuthenticator(mgr manager.Manager, server *webhook.Server) (admission_proxy.Authenticator, error) {
+	allowedNames := splitList(*flags.ProxyAllowedNames)
+
+	switch *flags.ProxyAuth {
+	case "":
+		return nil, nil
+	case admission_proxy.AuthClientCert:
+		if *flags.ProxyClientCA == "" {
+			return nil, fmt.Errorf("--proxy-client-ca is required with %v proxy authentication", admission_proxy.AuthClientCert)
+		}
+
+		// the webhook server reads its client CA from its certificate directory
+		ca, err := ioutil.ReadFile(*flags.ProxyClientCA)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(filepath.Join(common.CertDir, common.ProxyClientCAPem), ca, 0600)
+		if err != nil {
+			return nil, err
+		}
+		server.ClientCAName = common.ProxyClientCAPem
+
+		return &admission_proxy.ClientCertAuthenticator{AllowedNames: allowedNames}, nil
+	case admission_proxy.AuthToken:
+		client, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			return nil, err
+		}
+
+		return admission_proxy.NewTokenAuthenticator(client, allowedNames, splitList(*flags.ProxyTokenAudiences)), nil
+	default:
+		return nil, fmt.Errorf("unknown proxy authentication %q", *flags.ProxyAuth)
+	}
+}
+
+func splitList(list string) []string {
+	var ret []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+
+	return ret
+}
+
+func setupCRDWebhook(cfg *rest.Config) error {
+	client := kubernetes.NewForConfigOrDie(cfg)
+
+	caBundle, err := ioutil.ReadFile(filepath.Join(common.CertDir, common.CertPem))
+	if err != nil {
+		return err
+	}
+
+	err = crd_webhook.EnsureWebhookConfig(client, crd_webhook.GenerateWebhookConfig(*flags.Namespace, *flags.Service, caBundle))
+	if err != nil {
+		return err
+	}
+
+	return crd_webhook.EnsureMutatingWebhookConfig(client, crd_webhook.GenerateMutatingWebhookConfig(*flags.Namespace, *flags.Service, caBundle))
 }
 
 func setupTLS(cfg *rest.Config) error {
@@ -212,5 +313,21 @@ func setupTLS(cfg *rest.Config) error {
 		return err
 	}
 
-	return nil
+	// the client key pair lives in the same secret, so it is rotated along with the serving one
+	clientPriv, clientCert, clientCA, err := tls_manager.GenerateClientTLS(client, *flags.Namespace, *flags.Service, *flags.TlsSecret)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(common.CertDir, common.ClientPrivPem), clientPriv, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(common.CertDir, common.ClientCertPem), clientCert, 0600)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(common.CertDir, common.ClientCAPem), clientCA, 0600)
 }
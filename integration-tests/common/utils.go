@@ -135,6 +135,32 @@ func LoadNamespacedValidatingRuleCRD() *apiextv1.CustomResourceDefinition {
 	return c
 }
 
+func LoadWebhookServiceGrantCRD() *apiextv1.CustomResourceDefinition {
+	By("Read and Load CRD")
+
+	c := &apiextv1.CustomResourceDefinition{}
+
+	data, err := ioutil.ReadFile("../../deploy/crds/app.redislabs.com_webhookservicegrant_crd.yaml")
+	Expect(err).To(BeNil())
+	Expect(yaml.NewYAMLToJSONDecoder(bytes.NewReader(data)).Decode(c)).To(Succeed())
+	Expect(kubeClient.Create(context.TODO(), c)).To(Succeed())
+
+	return c
+}
+
+func LoadWebhookQuotaCRD() *apiextv1.CustomResourceDefinition {
+	By("Read and Load CRD")
+
+	c := &apiextv1.CustomResourceDefinition{}
+
+	data, err := ioutil.ReadFile("../../deploy/crds/app.redislabs.com_webhookquota_crd.yaml")
+	Expect(err).To(BeNil())
+	Expect(yaml.NewYAMLToJSONDecoder(bytes.NewReader(data)).Decode(c)).To(Succeed())
+	Expect(kubeClient.Create(context.TODO(), c)).To(Succeed())
+
+	return c
+}
+
 func LoadServiceAccount() *v1.ServiceAccount {
 	By("Read and Load ServiceAccount")
 
@@ -42,6 +42,8 @@ var (
 
 	crd1               *apiextv1.CustomResourceDefinition
 	crd2               *apiextv1.CustomResourceDefinition
+	crd3               *apiextv1.CustomResourceDefinition
+	crd4               *apiextv1.CustomResourceDefinition
 	service            *corev1.Service
 	sa                 *corev1.ServiceAccount
 	role               *rbacv1.Role
@@ -59,6 +61,8 @@ var _ = BeforeSuite(func() {
 
 	crd1 = common.LoadNamespacedValidatingTypeCRD()
 	crd2 = common.LoadNamespacedValidatingRuleCRD()
+	crd3 = common.LoadWebhookServiceGrantCRD()
+	crd4 = common.LoadWebhookQuotaCRD()
 	service = common.LoadService()
 	serviceName = service.Name
 	sa = common.LoadServiceAccount()
@@ -77,6 +81,15 @@ var _ = AfterSuite(func() {
 		Expect(kubeClient.Delete(context.TODO(), crd2)).To(Succeed())
 		crd1 = nil
 	}
+	if crd3 != nil {
+		Expect(kubeClient.Delete(context.TODO(), crd3)).To(Succeed())
+		crd3 = nil
+	}
+
+	if crd4 != nil {
+		Expect(kubeClient.Delete(context.TODO(), crd4)).To(Succeed())
+		crd4 = nil
+	}
 	if service != nil {
 		Expect(kubeClient.Delete(context.TODO(), service)).To(Succeed())
 		service = nil
@@ -40,6 +40,8 @@ func TestNamespacedWebhook(t *testing.T) {
 var (
 	crd1               *apiextv1.CustomResourceDefinition
 	crd2               *apiextv1.CustomResourceDefinition
+	crd3               *apiextv1.CustomResourceDefinition
+	crd4               *apiextv1.CustomResourceDefinition
 	opDeploy           *appsv1.Deployment
 	admDeploy          *appsv1.Deployment
 	sa                 *corev1.ServiceAccount
@@ -64,6 +66,8 @@ var _ = BeforeSuite(func() {
 
 	crd1 = common.LoadNamespacedValidatingTypeCRD()
 	crd2 = common.LoadNamespacedValidatingRuleCRD()
+	crd3 = common.LoadWebhookServiceGrantCRD()
+	crd4 = common.LoadWebhookQuotaCRD()
 	opService = common.LoadService()
 	admService = common.LoadTestService()
 
@@ -100,6 +104,16 @@ var _ = AfterSuite(func() {
 		crd2 = nil
 	}
 
+	if crd3 != nil {
+		Expect(kubeClient.Delete(context.TODO(), crd3)).To(Succeed())
+		crd3 = nil
+	}
+
+	if crd4 != nil {
+		Expect(kubeClient.Delete(context.TODO(), crd4)).To(Succeed())
+		crd4 = nil
+	}
+
 	if opService != nil {
 		Expect(kubeClient.Delete(context.TODO(), opService)).To(Succeed())
 		opService = nil
@@ -50,18 +50,19 @@ var _ = Describe("NamespacedWebhook", func() {
 			pod = nil
 		}
 
-		if namespacedType != nil {
-			Expect(kubeClient.Delete(context.TODO(), namespacedType)).To(Succeed())
-			Eventually(func() error { return common.VerifyDeleted(namespacedType) }, 60, 5).Should(Succeed())
-			namespacedType = nil
-		}
-
 		if webhook != nil {
 			Expect(kubeClient.Delete(context.TODO(), webhook)).To(Succeed())
 			Eventually(func() error { return common.VerifyDeleted(webhook) }, 60, 5).Should(Succeed())
 			webhook = nil
 		}
 
+		// types can't be deleted while a rule still depends on them
+		if namespacedType != nil {
+			Expect(kubeClient.Delete(context.TODO(), namespacedType)).To(Succeed())
+			Eventually(func() error { return common.VerifyDeleted(namespacedType) }, 60, 5).Should(Succeed())
+			namespacedType = nil
+		}
+
 		// This has to be at the end after webhook's are deleted, as otherwise webhook can block pod from loading
 		if admDeploy == nil {
 			admDeploy = common.LoadAdmissionDeploy()
@@ -217,8 +218,8 @@ func createNamespacedWebhook(failurePolicy admissionv1.FailurePolicyType) *v1alp
 			Namespace: common.Namespace,
 		},
 		Spec: v1alpha1.NamespacedValidatingRuleSpec{
-			Webhooks: []admissionv1.ValidatingWebhook{
-				{
+			Webhooks: []v1alpha1.NamespacedValidatingWebhook{
+				{ValidatingWebhook: admissionv1.ValidatingWebhook{
 					Name:          "test-hook",
 					FailurePolicy: &failurePolicy,
 					ClientConfig: admissionv1.WebhookClientConfig{
@@ -242,7 +243,7 @@ func createNamespacedWebhook(failurePolicy admissionv1.FailurePolicyType) *v1alp
 					},
 					SideEffects:             &sideEffect,
 					AdmissionReviewVersions: []string{"v1"},
-				},
+				}},
 			},
 		},
 	}
@@ -42,6 +42,8 @@ func TestTypeController(t *testing.T) {
 var (
 	crd1               *apiextv1.CustomResourceDefinition
 	crd2               *apiextv1.CustomResourceDefinition
+	crd3               *apiextv1.CustomResourceDefinition
+	crd4               *apiextv1.CustomResourceDefinition
 	deploy             *appsv1.Deployment
 	sa                 *corev1.ServiceAccount
 	service            *corev1.Service
@@ -63,6 +65,8 @@ var _ = BeforeSuite(func() {
 
 	crd1 = common.LoadNamespacedValidatingTypeCRD()
 	crd2 = common.LoadNamespacedValidatingRuleCRD()
+	crd3 = common.LoadWebhookServiceGrantCRD()
+	crd4 = common.LoadWebhookQuotaCRD()
 	service = common.LoadService()
 	sa = common.LoadServiceAccount()
 	role = common.LoadRole()
@@ -94,6 +98,16 @@ var _ = AfterSuite(func() {
 		crd2 = nil
 	}
 
+	if crd3 != nil {
+		Expect(kubeClient.Delete(context.TODO(), crd3)).To(Succeed())
+		crd3 = nil
+	}
+
+	if crd4 != nil {
+		Expect(kubeClient.Delete(context.TODO(), crd4)).To(Succeed())
+		crd4 = nil
+	}
+
 	if service != nil {
 		Expect(kubeClient.Delete(context.TODO(), service)).To(Succeed())
 		service = nil
@@ -0,0 +1,185 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AuthClientCert authenticates callers of the proxy by the client certificate they present
+	AuthClientCert = "client-cert"
+	// AuthToken authenticates callers of the proxy by their bearer token, through a TokenReview
+	AuthToken = "token"
+
+	// tokenCacheTTL is how long the outcome of a TokenReview is reused for
+	tokenCacheTTL = 10 * time.Second
+)
+
+// Authenticator decides whether a caller may post AdmissionReviews to the proxy
+type Authenticator interface {
+	// Method names the authentication, as reported for rejected callers
+	Method() string
+	// Authenticate returns why the caller of r is rejected, nil if it isn't
+	Authenticate(r *http.Request) error
+}
+
+// ClientCertAuthenticator accepts callers presenting a client certificate the webhook server verified.  It expects
+// the server to require one, so that connections without one are refused before they get here.
+type ClientCertAuthenticator struct {
+	// AllowedNames are the common names accepted, any verified certificate is when empty
+	AllowedNames []string
+}
+
+func (a *ClientCertAuthenticator) Method() string {
+	return AuthClientCert
+}
+
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return errors.New("no verified client certificate")
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if !allowedName(a.AllowedNames, name) {
+		return fmt.Errorf("client certificate of %v isn't allowed", name)
+	}
+
+	return nil
+}
+
+// TokenAuthenticator accepts callers whose bearer token a TokenReview authenticates
+type TokenAuthenticator struct {
+	client       kubernetes.Interface
+	allowedUsers []string
+	audiences    []string
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]tokenResult
+}
+
+// tokenResult is the cached outcome of a TokenReview
+type tokenResult struct {
+	err     error
+	expires time.Time
+}
+
+// NewTokenAuthenticator returns an authenticator accepting tokens of allowedUsers, of any user when there are none,
+// reviewed for audiences, the API server's when there are none
+func NewTokenAuthenticator(client kubernetes.Interface, allowedUsers, audiences []string) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		client:       client,
+		allowedUsers: allowedUsers,
+		audiences:    audiences,
+		cache:        make(map[[sha256.Size]byte]tokenResult),
+	}
+}
+
+func (a *TokenAuthenticator) Method() string {
+	return AuthToken
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) error {
+	token := bearerToken(r)
+	if token == "" {
+		return errors.New("no bearer token")
+	}
+
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.err
+	}
+
+	decided, err := a.review(r.Context(), token)
+	// a failed review says nothing about the token, so it is tried again on the next request
+	if decided {
+		a.mu.Lock()
+		for k, result := range a.cache {
+			if !now.Before(result.expires) {
+				delete(a.cache, k)
+			}
+		}
+		a.cache[key] = tokenResult{err: err, expires: now.Add(tokenCacheTTL)}
+		a.mu.Unlock()
+	}
+
+	return err
+}
+
+// review returns whether the review decided on token, rather than failing, and why token is rejected
+func (a *TokenAuthenticator) review(ctx context.Context, token string) (bool, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: a.audiences},
+	}
+
+	result, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("TokenReview failed: %v", err)
+	}
+
+	if !result.Status.Authenticated {
+		return true, fmt.Errorf("token isn't authenticated: %v", result.Status.Error)
+	}
+
+	if username := result.Status.User.Username; !allowedName(a.allowedUsers, username) {
+		return true, fmt.Errorf("user %v isn't allowed", username)
+	}
+
+	return true, nil
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(auth, prefix))
+}
+
+// allowedName returns true if name is listed in allowed, or nothing is
+func allowedName(allowed []string, name string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/redislabs/gesher/pkg/tls_manager"
+)
+
+func TestClientCertAuthenticator(t *testing.T) {
+	caKey, ca, err := tls_manager.NewClientCA("kube-apiserver")
+	assert.NoError(t, err)
+	_, certPEM, err := tls_manager.NewClientKeyPair("test", "kube-apiserver", caKey, ca)
+	assert.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/proxy", nil)
+	a := &ClientCertAuthenticator{}
+	assert.Error(t, a.Authenticate(r))
+
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	assert.NoError(t, a.Authenticate(r))
+
+	a.AllowedNames = []string{"kube-apiserver"}
+	assert.NoError(t, a.Authenticate(r))
+
+	a.AllowedNames = []string{"other"}
+	assert.Error(t, a.Authenticate(r))
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var reviews int
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "apiserver":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:apiserver"}}
+		case "other":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:test:prober"}}
+		default:
+			review.Status = authenticationv1.TokenReviewStatus{Error: "invalid token"}
+		}
+		return true, review, nil
+	})
+
+	a := NewTokenAuthenticator(client, []string{"system:apiserver"}, nil)
+	request := func(token string) *http.Request {
+		r := httptest.NewRequest("POST", "/proxy", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r
+	}
+
+	assert.Error(t, a.Authenticate(request("")))
+	assert.Equal(t, 0, reviews)
+
+	assert.NoError(t, a.Authenticate(request("apiserver")))
+	assert.Error(t, a.Authenticate(request("other")))
+	assert.Error(t, a.Authenticate(request("invalid")))
+	assert.Equal(t, 3, reviews)
+
+	// outcomes are cached for a while
+	assert.NoError(t, a.Authenticate(request("apiserver")))
+	assert.Error(t, a.Authenticate(request("other")))
+	assert.Equal(t, 3, reviews)
+}
+
+func TestHandlerRejectsCallers(t *testing.T) {
+	before := testutil.ToFloat64(rejectedCallers.WithLabelValues(AuthClientCert))
+
+	handler := Handler{Authenticator: &ClientCertAuthenticator{}}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/proxy", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(rejectedCallers.WithLabelValues(AuthClientCert)))
+}
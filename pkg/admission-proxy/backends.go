@@ -0,0 +1,88 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"path"
+	"time"
+
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+// chooseBackend returns the name and client config of the backend a request is sent to for webhook, its clientConfig
+// unless the request falls in the share of one of its weighted backends
+func chooseBackend(webhook namespacedvalidatingrule.WebhookConfig, request *admv1.AdmissionRequest) (string, admregv1.WebhookClientConfig) {
+	if len(webhook.Backends) == 0 {
+		return namespacedvalidatingrule.TargetName(0), webhook.ClientConfig
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(backendKey(request)))
+	bucket := int32(h.Sum32() % 100)
+
+	var weights int32
+	for _, backend := range webhook.Backends {
+		weights += backend.Weight
+		if bucket < weights {
+			return backend.Name, backend.ClientConfig
+		}
+	}
+
+	return namespacedvalidatingrule.TargetName(0), webhook.ClientConfig
+}
+
+// backendKey returns what identifies the object of a request when choosing its backend.  Its name comes first, as an
+// object only has a UID once created, then its UID and the request's UID when neither is known yet.
+func backendKey(request *admv1.AdmissionRequest) string {
+	if request.Name != "" {
+		return path.Join(request.Resource.Group, request.Resource.Resource, request.Namespace, request.Name)
+	}
+
+	for _, raw := range [][]byte{request.Object.Raw, request.OldObject.Raw} {
+		var object struct {
+			Metadata struct {
+				UID string `json:"uid"`
+			} `json:"metadata"`
+		}
+		if len(raw) > 0 && json.Unmarshal(raw, &object) == nil && object.Metadata.UID != "" {
+			return object.Metadata.UID
+		}
+	}
+
+	return string(request.UID)
+}
+
+// recordBackend records how the backend a request was sent to for webhook decided it, in err, and how long it took
+func recordBackend(webhook namespacedvalidatingrule.WebhookConfig, namespace, backend string, err error, took time.Duration) {
+	var denied *deniedError
+	result := backendResultFailed
+	switch {
+	case err == nil:
+		result = backendResultAllowed
+	case errors.As(err, &denied):
+		result = backendResultDenied
+	}
+
+	backendRequests.WithLabelValues(namespace, webhook.RuleName, webhook.Name, backend, result).Inc()
+	backendDuration.WithLabelValues(namespace, webhook.RuleName, webhook.Name, backend).Observe(took.Seconds())
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+func testBackend(name string, weight int32) v1alpha1.WeightedBackend {
+	return v1alpha1.WeightedBackend{
+		Name:         name,
+		Weight:       weight,
+		ClientConfig: admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Namespace: "test", Name: name}},
+	}
+}
+
+func TestChooseBackend(t *testing.T) {
+	webhook := namespacedvalidatingrule.WebhookConfig{
+		ClientConfig: admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Namespace: "test", Name: "stable"}},
+		Backends:     []v1alpha1.WeightedBackend{testBackend("drained", 0), testBackend("canary", 20)},
+	}
+
+	chosen := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		request := &admv1.AdmissionRequest{Namespace: "test", Name: fmt.Sprintf("pod-%v", i)}
+		backend, clientConfig := chooseBackend(webhook, request)
+		chosen[backend]++
+
+		// the same object is always sent to the same backend
+		again, _ := chooseBackend(webhook, request)
+		assert.Equal(t, backend, again)
+
+		switch backend {
+		case "canary":
+			assert.Equal(t, "canary", clientConfig.Service.Name)
+		default:
+			assert.Equal(t, "stable", clientConfig.Service.Name)
+		}
+	}
+
+	assert.Zero(t, chosen["drained"])
+	assert.InDelta(t, 200, chosen["canary"], 50)
+	assert.InDelta(t, 800, chosen["clientConfig"], 50)
+
+	webhook.Backends = nil
+	backend, clientConfig := chooseBackend(webhook, &admv1.AdmissionRequest{Name: "pod"})
+	assert.Equal(t, "clientConfig", backend)
+	assert.Equal(t, "stable", clientConfig.Service.Name)
+}
+
+func TestBackendKey(t *testing.T) {
+	request := &admv1.AdmissionRequest{
+		UID:       "request",
+		Namespace: "test",
+		Name:      "pod",
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		OldObject: runtime.RawExtension{Raw: []byte(`{"metadata":{"uid":"object"}}`)},
+	}
+	assert.Equal(t, "pods/test/pod", backendKey(request))
+
+	request.Name = ""
+	assert.Equal(t, "object", backendKey(request))
+
+	request.OldObject.Raw = []byte(`{"metadata":{}}`)
+	assert.Equal(t, "request", backendKey(request))
+}
+
+func TestDoWebhookBackends(t *testing.T) {
+	stable, stableCalls := countingServer(t)
+	canary, canaryCalls := countingServer(t)
+	canaryBackend := testBackend("canary", 100)
+	canaryBackend.ClientConfig = serverTarget(t, "canary", canary)
+
+	webhook := namespacedvalidatingrule.WebhookConfig{
+		RuleName:      "backends",
+		Name:          "webhook",
+		ClientConfig:  serverTarget(t, "stable", stable),
+		Backends:      []v1alpha1.WeightedBackend{canaryBackend},
+		FailurePolicy: admregv1.Fail,
+		TimeoutSecs:   5,
+	}
+	call := webhookCall{webhook: webhook, request: &admv1.AdmissionRequest{UID: "uid", Namespace: "test", Name: "pod"}}
+
+	assert.NoError(t, doWebhook(call, httptest.NewRequest("POST", "/proxy", nil)))
+	assert.Equal(t, int32(0), atomic.LoadInt32(stableCalls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(canaryCalls))
+	assert.Equal(t, 1.0, testutil.ToFloat64(backendRequests.WithLabelValues("test", "backends", "webhook", "canary", backendResultAllowed)))
+
+	// a backend failing is told apart from one denying
+	canary.Close()
+	assert.Error(t, doWebhook(call, httptest.NewRequest("POST", "/proxy", nil)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(backendRequests.WithLabelValues("test", "backends", "webhook", "canary", backendResultFailed)))
+	assert.Zero(t, testutil.ToFloat64(backendRequests.WithLabelValues("test", "backends", "webhook", "canary", backendResultDenied)))
+}
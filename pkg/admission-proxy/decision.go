@@ -0,0 +1,164 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"errors"
+	"fmt"
+
+	admv1 "k8s.io/api/admission/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+// vote is a webhook's say in whether a request is allowed
+type vote int
+
+const (
+	voteAllow vote = iota
+	voteDeny
+	// voteAbstain is the vote of webhooks failing with the Ignore failure policy
+	voteAbstain
+)
+
+// ignoredError is a webhook's failure its Ignore failure policy makes an abstention
+type ignoredError struct {
+	name string
+	err  error
+}
+
+func (e *ignoredError) Error() string {
+	return fmt.Sprintf("proxied webhook %v failed and is ignored: %v", e.name, e.err)
+}
+
+// voteOf returns the vote of a webhook whose call returned err
+func voteOf(err error) vote {
+	var ignored *ignoredError
+	switch {
+	case err == nil:
+		return voteAllow
+	case errors.As(err, &ignored):
+		return voteAbstain
+	default:
+		return voteDeny
+	}
+}
+
+// settles is true when a vote decides the request whatever the votes after it, so a sequential rule needn't call
+// the rest of its webhooks
+func settles(decision v1alpha1.DecisionStrategy, v vote) bool {
+	switch decision {
+	case v1alpha1.DecisionAnyAllows:
+		return v == voteAllow
+	case v1alpha1.DecisionMajority:
+		return false
+	default:
+		return v == voteDeny
+	}
+}
+
+// tally counts the votes of webhooks decided by the same strategy
+type tally struct {
+	decision v1alpha1.DecisionStrategy
+	allows   int
+	denies   int
+	abstains int
+	// denial is the first denial among the votes
+	denial error
+}
+
+func (t *tally) add(err error) {
+	switch voteOf(err) {
+	case voteAllow:
+		t.allows++
+	case voteAbstain:
+		t.abstains++
+	default:
+		t.denies++
+		if t.denial == nil {
+			t.denial = err
+		}
+	}
+}
+
+// allowed is true when the votes allow the request by the tally's strategy
+func (t *tally) allowed() bool {
+	switch t.decision {
+	case v1alpha1.DecisionAnyAllows:
+		return t.denies == 0 || t.allows > 0
+	case v1alpha1.DecisionMajority:
+		return t.denies == 0 || t.allows > t.denies
+	default:
+		return t.denies == 0
+	}
+}
+
+func (t *tally) String() string {
+	return fmt.Sprintf("%v: %v of %v webhooks allowed, %v denied, %v abstained",
+		t.decision, t.allows, t.allows+t.denies+t.abstains, t.denies, t.abstains)
+}
+
+// decisionOf returns the strategy deciding webhook's vote
+func decisionOf(webhook namespacedvalidatingrule.WebhookConfig, namespaceDecision v1alpha1.DecisionStrategy) v1alpha1.DecisionStrategy {
+	if webhook.Decision != "" {
+		return webhook.Decision
+	}
+	return namespaceDecision
+}
+
+// decide answers a request from the results of its webhooks.  The webhooks of rules setting a decision strategy vote
+// among themselves, and the others together by the namespace's strategy.  The request is denied when any of these
+// votes denies it, by the first in the webhooks' order.
+func decide(results []webhookResult, namespaceDecision v1alpha1.DecisionStrategy) *admv1.AdmissionResponse {
+	var tallies []*tally
+	byRule := make(map[string]*tally)
+
+	for _, result := range results {
+		key, decision := "", decisionOf(result.webhook, namespaceDecision)
+		if result.webhook.Decision != "" {
+			key = result.webhook.RuleName
+		}
+
+		t, ok := byRule[key]
+		if !ok {
+			t = &tally{decision: decision}
+			byRule[key] = t
+			tallies = append(tallies, t)
+		}
+
+		// webhooks a sequential rule didn't call have no say
+		if result.voted {
+			t.add(result.err)
+		}
+	}
+
+	for _, t := range tallies {
+		if t.allowed() {
+			continue
+		}
+
+		log.V(1).Info(fmt.Sprintf("decide: request denied by %v", t))
+		response := errToAdmissionResponse(t.denial)
+		if t.decision != v1alpha1.DecisionAllMustAllow {
+			response.Result.Message = fmt.Sprintf("%v (%v)", response.Result.Message, t)
+		}
+		return response
+	}
+
+	return approved()
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+var (
+	allow   error
+	deny    = &deniedError{name: "webhook", result: &metav1.Status{Message: "no"}}
+	abstain = &ignoredError{name: "webhook", err: errors.New("unreachable")}
+)
+
+func voted(rule string, decision v1alpha1.DecisionStrategy, errs ...error) []webhookResult {
+	var results []webhookResult
+	for _, err := range errs {
+		results = append(results, webhookResult{
+			webhook: namespacedvalidatingrule.WebhookConfig{RuleName: rule, Decision: decision},
+			voted:   true,
+			err:     err,
+		})
+	}
+	return results
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision v1alpha1.DecisionStrategy
+		votes    []error
+		allowed  bool
+	}{
+		{"all allow", v1alpha1.DecisionAllMustAllow, []error{allow, allow}, true},
+		{"one denies", v1alpha1.DecisionAllMustAllow, []error{allow, deny}, false},
+		{"ignored failure", v1alpha1.DecisionAllMustAllow, []error{allow, abstain}, true},
+		{"any allows", v1alpha1.DecisionAnyAllows, []error{deny, allow, deny}, true},
+		{"none allows", v1alpha1.DecisionAnyAllows, []error{deny, abstain}, false},
+		{"all abstain", v1alpha1.DecisionAnyAllows, []error{abstain, abstain}, true},
+		{"majority allows", v1alpha1.DecisionMajority, []error{allow, allow, deny}, true},
+		{"tie", v1alpha1.DecisionMajority, []error{allow, deny, abstain}, false},
+		{"majority denies", v1alpha1.DecisionMajority, []error{allow, deny, deny}, false},
+	}
+
+	for _, test := range tests {
+		response := decide(voted("rule", test.decision, test.votes...), v1alpha1.DecisionAllMustAllow)
+		assert.Equal(t, test.allowed, response.Allowed, test.name)
+	}
+}
+
+func TestDecideMessage(t *testing.T) {
+	response := decide(voted("rule", v1alpha1.DecisionMajority, allow, deny, deny, abstain), v1alpha1.DecisionAllMustAllow)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, int32(403), response.Result.Code)
+	assert.Equal(t, "proxied webhook webhook denied the request: no (Majority: 1 of 4 webhooks allowed, 2 denied, 1 abstained)",
+		response.Result.Message)
+
+	response = decide(voted("rule", "", allow, deny), v1alpha1.DecisionAllMustAllow)
+	assert.Equal(t, "proxied webhook webhook denied the request: no", response.Result.Message)
+}
+
+func TestDecideGroups(t *testing.T) {
+	// rules without a strategy vote together by the namespace's
+	results := append(voted("a", "", deny), voted("b", "", allow)...)
+	assert.True(t, decide(results, v1alpha1.DecisionAnyAllows).Allowed)
+	assert.False(t, decide(results, v1alpha1.DecisionAllMustAllow).Allowed)
+
+	// while a rule setting its own keeps its veto
+	results = append(voted("a", v1alpha1.DecisionAllMustAllow, deny), voted("b", "", allow)...)
+	assert.False(t, decide(results, v1alpha1.DecisionAnyAllows).Allowed)
+
+	// webhooks that weren't called don't vote
+	results = voted("a", v1alpha1.DecisionMajority, allow, deny)
+	results[1].voted = false
+	assert.True(t, decide(results, v1alpha1.DecisionAllMustAllow).Allowed)
+}
+
+func TestCheckWebhooksAnyAllows(t *testing.T) {
+	called := fakeWebhooks(t, "a/first")
+	webhooks := []namespacedvalidatingrule.WebhookConfig{
+		testWebhook("a", "first", v1alpha1.EvaluationSequential),
+		testWebhook("a", "second", v1alpha1.EvaluationSequential),
+		testWebhook("a", "third", v1alpha1.EvaluationSequential),
+	}
+	for i := range webhooks {
+		webhooks[i].Decision = v1alpha1.DecisionAnyAllows
+	}
+
+	response := checkWebhooks(webhooks, &admv1.AdmissionRequest{Namespace: "test"}, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.True(t, response.Allowed)
+	// the second webhook's allow settles the decision
+	assert.Equal(t, []string{"a/first", "a/second"}, called())
+}
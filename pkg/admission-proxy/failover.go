@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	admregv1 "k8s.io/api/admissionregistration/v1"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+// targetURL returns the URL a webhook target is called at, it is only replaced by tests
+var targetURL = func(clientConfig admregv1.WebhookClientConfig) string {
+	return serviceToUrl(clientConfig.Service)
+}
+
+// target is one of the client configs a webhook is called at, index 0 being the backend chosen for the request, its
+// clientConfig unless it has weighted backends, and i its i-th failover target
+type target struct {
+	index        int
+	clientConfig admregv1.WebhookClientConfig
+}
+
+// grantedTargets returns the targets of webhook the namespace's requests may be sent to, the backend chosen for the
+// request followed by its failover targets, failing when none is
+func grantedTargets(webhook namespacedvalidatingrule.WebhookConfig, backend admregv1.WebhookClientConfig, namespace string) ([]target, error) {
+	var targets []target
+	var firstErr error
+
+	for i, clientConfig := range append([]admregv1.WebhookClientConfig{backend}, webhook.Failover...) {
+		if err := checkGrant(clientConfig.Service, namespace); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		targets = append(targets, target{index: i, clientConfig: clientConfig})
+	}
+
+	if len(targets) == 0 {
+		return nil, firstErr
+	}
+
+	return targets, nil
+}
+
+// callTargets calls a webhook at the target it was last reached at, failing over to the targets after it when the
+// proxy can't connect.  Each target tried gets what is left of the time before deadline, when ctx ends, so a slow
+// target isn't failed over from.
+func callTargets(ctx context.Context, targets []target, call webhookCall, r *http.Request, deadline time.Time) (*http.Response, error) {
+	webhook, namespace := call.webhook, call.request.Namespace
+
+	first := 0
+	if len(targets) > 1 {
+		active := namespacedvalidatingrule.ActiveTarget(namespace, webhook.RuleName, webhook.Name)
+		for i, t := range targets {
+			if t.index == active {
+				first = i
+			}
+		}
+	}
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < len(targets); i++ {
+		t := targets[(first+i)%len(targets)]
+
+		resp, err = callTarget(ctx, t.clientConfig, call, r, deadline)
+		if err == nil {
+			if len(targets) > 1 {
+				namespacedvalidatingrule.SetActiveTarget(namespace, webhook.RuleName, webhook.Name, t.index)
+			}
+			return resp, nil
+		}
+
+		if ctx.Err() != nil || timedOut(err) || i == len(targets)-1 {
+			break
+		}
+
+		log.Info("failing over webhook", "rule", webhook.RuleName, "webhook", webhook.Name, "UID", call.request.UID,
+			"target", namespacedvalidatingrule.TargetName(t.index), "reason", err.Error())
+		webhookFailovers.WithLabelValues(namespace, webhook.RuleName, webhook.Name).Inc()
+	}
+
+	return resp, err
+}
+
+// timedOut returns true if err is a target taking too long to answer, rather than the proxy failing to connect to it
+func timedOut(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// callTarget calls a webhook at one of its targets, until deadline
+func callTarget(ctx context.Context, clientConfig admregv1.WebhookClientConfig, call webhookCall, r *http.Request, deadline time.Time) (*http.Response, error) {
+	// TODO: Perhaps include system wide certs here?
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(clientConfig.CABundle)
+
+	client := &http.Client{
+		Timeout: time.Duration(call.webhook.TimeoutSecs) * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:              caCertPool,
+				GetClientCertificate: clientCertificates.GetClientCertificate,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	resp, err := callWithRetries(ctx, client, targetURL(clientConfig), call, r, deadline)
+	if resp == nil || resp.Body == nil {
+		cancel()
+		return resp, err
+	}
+
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, err
+}
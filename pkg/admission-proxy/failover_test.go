@@ -0,0 +1,145 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+// countingServer answers every request allowing it, counting them
+func countingServer(t *testing.T) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(allowedReview))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+// serverTarget returns a target at server, which tests find by the name of its service
+func serverTarget(t *testing.T, name string, server *httptest.Server) admregv1.WebhookClientConfig {
+	urls := map[string]string{}
+	f := targetURL
+	t.Cleanup(func() { targetURL = f })
+	targetURL = func(clientConfig admregv1.WebhookClientConfig) string {
+		if url, ok := urls[clientConfig.Service.Name]; ok {
+			return url
+		}
+		return f(clientConfig)
+	}
+	urls[name] = server.URL
+
+	return admregv1.WebhookClientConfig{
+		Service:  &admregv1.ServiceReference{Namespace: "test", Name: name},
+		CABundle: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+	}
+}
+
+func TestDoWebhookFailover(t *testing.T) {
+	old, _ := countingServer(t)
+	oldTarget := serverTarget(t, "old", old)
+	old.Close()
+
+	current, currentCalls := countingServer(t)
+	webhook := namespacedvalidatingrule.WebhookConfig{
+		RuleName:      "failover",
+		Name:          "webhook",
+		ClientConfig:  oldTarget,
+		Failover:      []admregv1.WebhookClientConfig{serverTarget(t, "current", current)},
+		FailurePolicy: admregv1.Fail,
+		TimeoutSecs:   5,
+	}
+	call := webhookCall{webhook: webhook, request: &admv1.AdmissionRequest{UID: "uid", Namespace: "test"}}
+
+	assert.NoError(t, doWebhook(call, httptest.NewRequest("POST", "/proxy", nil)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(currentCalls))
+	assert.Equal(t, 1, namespacedvalidatingrule.ActiveTarget("test", "failover", "webhook"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(webhookFailovers.WithLabelValues("test", "failover", "webhook")))
+
+	// the target reached is called first from then on
+	assert.NoError(t, doWebhook(call, httptest.NewRequest("POST", "/proxy", nil)))
+	assert.Equal(t, int32(2), atomic.LoadInt32(currentCalls))
+	assert.Equal(t, 1.0, testutil.ToFloat64(webhookFailovers.WithLabelValues("test", "failover", "webhook")))
+}
+
+func TestDoWebhookFailoverSlow(t *testing.T) {
+	slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(1500 * time.Millisecond):
+			w.Write([]byte(allowedReview))
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	current, currentCalls := countingServer(t)
+	webhook := namespacedvalidatingrule.WebhookConfig{
+		RuleName:      "slow",
+		Name:          "webhook",
+		ClientConfig:  serverTarget(t, "slow", slow),
+		Failover:      []admregv1.WebhookClientConfig{serverTarget(t, "current", current)},
+		FailurePolicy: admregv1.Fail,
+		TimeoutSecs:   2,
+	}
+	call := webhookCall{webhook: webhook, request: &admv1.AdmissionRequest{UID: "uid", Namespace: "test"}}
+
+	// a target answering after more than half the timeout still gets to answer
+	assert.NoError(t, doWebhook(call, httptest.NewRequest("POST", "/proxy", nil)))
+	assert.Equal(t, int32(0), atomic.LoadInt32(currentCalls))
+	assert.Equal(t, 0, namespacedvalidatingrule.ActiveTarget("test", "slow", "webhook"))
+
+	// and one not answering in time isn't failed over from, there being no time left
+	call.webhook.TimeoutSecs = 1
+	start := time.Now()
+	assert.Error(t, doWebhook(call, httptest.NewRequest("POST", "/proxy", nil)))
+	assert.True(t, time.Since(start) < 1500*time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(currentCalls))
+	assert.Zero(t, testutil.ToFloat64(webhookFailovers.WithLabelValues("test", "slow", "webhook")))
+}
+
+func TestGrantedTargets(t *testing.T) {
+	webhook := namespacedvalidatingrule.WebhookConfig{
+		ClientConfig: admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Namespace: "other", Name: "old"}},
+		Failover: []admregv1.WebhookClientConfig{
+			{Service: &admregv1.ServiceReference{Namespace: "test", Name: "current"}},
+		},
+	}
+
+	targets, err := grantedTargets(webhook, webhook.ClientConfig, "test")
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, 1, targets[0].index)
+	}
+
+	webhook.Failover = nil
+	_, err = grantedTargets(webhook, webhook.ClientConfig, "test")
+	assert.Error(t, err)
+}
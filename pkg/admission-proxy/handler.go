@@ -17,79 +17,181 @@ limitations under the License.
 package admission_proxy
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"runtime/debug"
+	"time"
 
-	admregv1 "k8s.io/api/admission/v1"
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
 	"k8s.io/apiextensions-apiserver/pkg/apiserver"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	// maxRequestBytes bounds the AdmissionReviews the proxy reads, leaving room for an object and an old object each
+	// at etcd's default limit of 1.5MiB
+	maxRequestBytes = 8 << 20
+)
+
 var log = logf.Log.WithName("handler")
 
-type Handler struct{}
+// reviewRequest decides on an admission request, it is only replaced by tests
+var reviewRequest = respond
+
+type Handler struct {
+	// Authenticator rejects callers that may not use the proxy, none are when it is nil
+	Authenticator Authenticator
+	// PanicPolicy decides whether requests the proxy panics on are allowed or denied, they are denied by default
+	PanicPolicy admregv1.FailurePolicyType
+}
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var body []byte
-	if r.Body != nil {
-		if data, err := ioutil.ReadAll(r.Body); err == nil {
-			body = data
+	deadline := requestDeadline(r, time.Now())
+
+	if h.Authenticator != nil {
+		if err := h.Authenticator.Authenticate(r); err != nil {
+			log.Info("rejecting caller", "remoteAddr", r.RemoteAddr, "method", h.Authenticator.Method(), "reason", err.Error())
+			rejectedCallers.WithLabelValues(h.Authenticator.Method()).Inc()
+			httpError(w, http.StatusUnauthorized, "unauthorized")
+			return
 		}
 	}
 
+	if r.Method != http.MethodPost {
+		httpError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %v, expect POST", r.Method))
+		return
+	}
+
 	// verify the content type is accurate
 	contentType := r.Header.Get("Content-Type")
-	if contentType != "application/json" {
-		msg := fmt.Sprintf("contentType=%s, expect application/json", contentType)
-		log.Error(nil, msg)
-
-		w.WriteHeader(400)
-		_, err := w.Write([]byte(msg))
-		if err != nil {
-			log.Error(err, "http write failed")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+		httpError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("contentType=%s, expect application/json", contentType))
+		return
+	}
+
+	if r.Body == nil {
+		httpError(w, http.StatusBadRequest, "request has no body")
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		// MaxBytesReader's error isn't exported, but reading the body fails for no other reason past the limit
+		if len(body) >= maxRequestBytes {
+			httpError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %v bytes", maxRequestBytes))
+		} else {
+			httpError(w, http.StatusBadRequest, fmt.Sprintf("failed to read the request body: %v", err))
 		}
+		return
+	}
 
+	request, err := decodeReview(body)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// The AdmissionReview that was sent to the webhook
-	requestedAdmissionReview := admregv1.AdmissionReview{}
+	log.V(2).Info(fmt.Sprintf("request = %+v", request))
+
+	response := h.review(request, r, body, deadline)
+	// Return the same UID
+	response.UID = request.UID
+
+	log.V(2).Info(fmt.Sprintf("sending response: %v", response))
 
 	// The AdmissionReview that will be returned
-	responseAdmissionReview := admregv1.AdmissionReview{
+	responseAdmissionReview := admv1.AdmissionReview{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "AdmissionReview",
 			APIVersion: "admission.k8s.io/v1",
 		},
+		Response: response,
 	}
 
-	deserializer := apiserver.Codecs.UniversalDeserializer()
+	respBytes, err := json.Marshal(responseAdmissionReview)
+	if err != nil {
+		log.Error(err, "json marshall failed")
+		httpError(w, http.StatusInternalServerError, "failed to encode the response")
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(respBytes); err != nil {
+		log.Error(err, "http response write failed")
+	}
+}
+
+// decodeReview returns the admission request of the AdmissionReview in body
+func decodeReview(body []byte) (*admv1.AdmissionRequest, error) {
+	// The AdmissionReview that was sent to the webhook
+	requestedAdmissionReview := admv1.AdmissionReview{}
+
+	deserializer := apiserver.Codecs.UniversalDeserializer()
 	if _, _, err := deserializer.Decode(body, nil, &requestedAdmissionReview); err != nil {
-		log.Error(err, "deserializer failed")
-		responseAdmissionReview.Response = errToAdmissionResponse(err)
-	} else {
-		log.V(2).Info(fmt.Sprintf("request = %+v", requestedAdmissionReview))
-		webhooks := findWebhooks(requestedAdmissionReview.Request)
-		log.V(2).Info(fmt.Sprintf("webhooks = %+v", webhooks))
-		responseAdmissionReview.Response = checkWebhooks(webhooks, r, bytes.NewReader(body))
-		log.V(2).Info(fmt.Sprintf("response = %+v", responseAdmissionReview.Response))
+		return nil, fmt.Errorf("failed to decode the AdmissionReview: %v", err)
 	}
 
-	// Return the same UID
-	responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
+	if requestedAdmissionReview.Request == nil {
+		return nil, errors.New("AdmissionReview has no request")
+	}
 
-	log.V(2).Info(fmt.Sprintf("sending response: %v", responseAdmissionReview.Response))
+	return requestedAdmissionReview.Request, nil
+}
 
-	respBytes, err := json.Marshal(responseAdmissionReview)
-	if err != nil {
-		log.Error(err, "json marshall failed")
+// review returns the response to request, recovering from panics into the handler's panic policy.  The policy goes
+// along with r to the goroutines calling webhooks, which recover on their own.
+func (h Handler) review(request *admv1.AdmissionRequest, r *http.Request, body []byte, deadline time.Time) (response *admv1.AdmissionResponse) {
+	defer func() {
+		if p := recover(); p != nil {
+			err := fmt.Errorf("panic: %v", p)
+			log.Error(err, "reviewing the request panicked", "UID", request.UID, "stack", string(debug.Stack()))
+			response = recovered(err, h.PanicPolicy)
+		}
+	}()
+
+	r = r.WithContext(context.WithValue(r.Context(), panicPolicyKey{}, h.PanicPolicy))
+
+	return reviewRequest(request, r, body, deadline)
+}
+
+// panicPolicyKey is the context key of the panic policy of the handler serving a request
+type panicPolicyKey struct{}
+
+// panicPolicy returns the panic policy of the handler serving r, Fail when it has none
+func panicPolicy(r *http.Request) admregv1.FailurePolicyType {
+	if policy, ok := r.Context().Value(panicPolicyKey{}).(admregv1.FailurePolicyType); ok && policy != "" {
+		return policy
 	}
-	if _, err := w.Write(respBytes); err != nil {
-		log.Error(err, "http response write failed")
+
+	return admregv1.Fail
+}
+
+// respond decides on request, calling the webhooks it is proxied to unless it is bypassed
+func respond(request *admv1.AdmissionRequest, r *http.Request, body []byte, deadline time.Time) *admv1.AdmissionResponse {
+	var response *admv1.AdmissionResponse
+	if reason := bypassReason(request, time.Now()); reason != "" {
+		log.Info("bypassing webhooks", "UID", request.UID, "reason", reason)
+		response = bypassed(reason)
+	} else {
+		webhooks := findWebhooks(request)
+		log.V(2).Info(fmt.Sprintf("webhooks = %+v", webhooks))
+		response = checkWebhooks(webhooks, request, r, body, deadline)
 	}
+	log.V(2).Info(fmt.Sprintf("response = %+v", response))
+
+	return response
+}
+
+// httpError answers a request the proxy can't make an AdmissionReview of with code, which the API server handles as a
+// failure of the proxy's webhook
+func httpError(w http.ResponseWriter, code int, msg string) {
+	log.Error(nil, msg, "code", code)
+	http.Error(w, msg, code)
 }
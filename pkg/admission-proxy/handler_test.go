@@ -0,0 +1,184 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const validReview = `{
+	"apiVersion": "admission.k8s.io/v1",
+	"kind": "AdmissionReview",
+	"request": {
+		"uid": "uid",
+		"kind": {"group": "", "version": "v1", "kind": "ConfigMap"},
+		"resource": {"group": "", "version": "v1", "resource": "configmaps"},
+		"namespace": "test",
+		"operation": "CREATE",
+		"userInfo": {"username": "user"},
+		"object": {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "cm"}, "data": {"key": "value"}}
+	}
+}`
+
+func serve(h Handler, method, contentType string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/proxy", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) *admv1.AdmissionResponse {
+	var review admv1.AdmissionReview
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &review))
+	if !assert.NotNil(t, review.Response) {
+		return &admv1.AdmissionResponse{}
+	}
+
+	return review.Response
+}
+
+func TestServeHTTP(t *testing.T) {
+	w := serve(Handler{}, http.MethodPost, "application/json; charset=utf-8", []byte(validReview))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	response := decodeResponse(t, w)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, "uid", string(response.UID))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(Handler{}, http.MethodGet, "application/json", []byte(validReview)).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, serve(Handler{}, http.MethodPost, "text/plain", []byte(validReview)).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, serve(Handler{}, http.MethodPost, "", []byte(validReview)).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(Handler{}, http.MethodPost, "application/json", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(Handler{}, http.MethodPost, "application/json", []byte("{")).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(Handler{}, http.MethodPost, "application/json",
+		[]byte(`{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`)).Code)
+
+	oversized := bytes.Repeat([]byte(" "), maxRequestBytes+1)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(Handler{}, http.MethodPost, "application/json", oversized).Code)
+}
+
+func TestServeHTTPPanic(t *testing.T) {
+	defer func(f func(*admv1.AdmissionRequest, *http.Request, []byte, time.Time) *admv1.AdmissionResponse) {
+		reviewRequest = f
+	}(reviewRequest)
+	reviewRequest = func(*admv1.AdmissionRequest, *http.Request, []byte, time.Time) *admv1.AdmissionResponse {
+		panic("boom")
+	}
+
+	w := serve(Handler{}, http.MethodPost, "application/json", []byte(validReview))
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := decodeResponse(t, w)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, "uid", string(response.UID))
+	if assert.NotNil(t, response.Result) {
+		assert.Equal(t, int32(http.StatusInternalServerError), response.Result.Code)
+		assert.Equal(t, metav1.StatusReasonInternalError, response.Result.Reason)
+		assert.Contains(t, response.Result.Message, "boom")
+	}
+
+	response = decodeResponse(t, serve(Handler{PanicPolicy: admregv1.Ignore}, http.MethodPost, "application/json", []byte(validReview)))
+	assert.True(t, response.Allowed)
+	assert.NotEmpty(t, response.Warnings)
+}
+
+// TestServeHTTPRandomized feeds the decode path mutations and truncations of a valid review and random bytes, none of
+// which may panic the handler or be answered with anything but a review or a client error
+func TestServeHTTPRandomized(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	valid := []byte(validReview)
+	tokens := []string{"{", "}", "[", "]", ":", ",", `"`, "null", "true", "0", "-1e999", `"request"`, `"uid"`, `"object"`, "\x00", "\xff"}
+
+	for i := 0; i < 2000; i++ {
+		var body []byte
+		switch i % 4 {
+		case 0:
+			body = append([]byte(nil), valid...)
+			for n := rnd.Intn(8) + 1; n > 0; n-- {
+				body[rnd.Intn(len(body))] = byte(rnd.Intn(256))
+			}
+		case 1:
+			body = valid[:rnd.Intn(len(valid))]
+		case 2:
+			pos := rnd.Intn(len(valid))
+			token := tokens[rnd.Intn(len(tokens))]
+			body = []byte(string(valid[:pos]) + token + string(valid[pos:]))
+		default:
+			body = make([]byte, rnd.Intn(512))
+			rnd.Read(body)
+		}
+
+		w := serve(Handler{}, http.MethodPost, "application/json", body)
+		switch w.Code {
+		case http.StatusOK:
+			response := decodeResponse(t, w)
+			assert.True(t, response.Allowed, "body %q", body)
+		case http.StatusBadRequest:
+		default:
+			t.Fatalf("unexpected status %v for body %q", w.Code, body)
+		}
+	}
+}
+
+func TestErrToAdmissionResponse(t *testing.T) {
+	response := errToAdmissionResponse(errors.New("failed"))
+	assert.False(t, response.Allowed)
+	assert.Equal(t, metav1.StatusFailure, response.Result.Status)
+	assert.Equal(t, int32(http.StatusInternalServerError), response.Result.Code)
+	assert.Equal(t, metav1.StatusReasonInternalError, response.Result.Reason)
+
+	response = errToAdmissionResponse(&deniedError{name: "webhook", result: &metav1.Status{Message: "no"}})
+	assert.Equal(t, int32(http.StatusForbidden), response.Result.Code)
+	assert.Equal(t, metav1.StatusReasonForbidden, response.Result.Reason)
+	assert.Equal(t, "proxied webhook webhook denied the request: no", response.Result.Message)
+
+	response = errToAdmissionResponse(&deniedError{name: "webhook", result: &metav1.Status{Code: http.StatusConflict, Reason: metav1.StatusReasonConflict}})
+	assert.Equal(t, int32(http.StatusConflict), response.Result.Code)
+	assert.Equal(t, metav1.StatusReasonConflict, response.Result.Reason)
+}
+
+func TestToFailure(t *testing.T) {
+	reply := func(code int, body string) *http.Response {
+		return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+
+	assert.NoError(t, toFailure("webhook", reply(http.StatusOK, `{"response": {"allowed": true}}`), nil, admregv1.Fail))
+	assert.Error(t, toFailure("webhook", reply(http.StatusInternalServerError, `{"response": {"allowed": true}}`), nil, admregv1.Fail))
+	assert.Equal(t, voteAbstain, voteOf(toFailure("webhook", reply(http.StatusInternalServerError, ""), nil, admregv1.Ignore)))
+	assert.Error(t, toFailure("webhook", reply(http.StatusOK, `{}`), nil, admregv1.Fail))
+	assert.Error(t, toFailure("webhook", reply(http.StatusOK, strings.Repeat(" ", maxResponseBytes+1)), nil, admregv1.Fail))
+
+	err := toFailure("webhook", reply(http.StatusOK, `{"response": {"allowed": false}}`), nil, admregv1.Ignore)
+	var denied *deniedError
+	assert.True(t, errors.As(err, &denied))
+	assert.Equal(t, voteDeny, voteOf(err))
+}
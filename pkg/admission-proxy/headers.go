@@ -0,0 +1,81 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redislabs/gesher/version"
+)
+
+const (
+	// requestUIDHeader is the UID of the admission request a webhook is called for
+	requestUIDHeader = "X-Gesher-Request-UID"
+	// ruleHeader is the namespace/name of the NamespacedValidatingRule a webhook belongs to
+	ruleHeader = "X-Gesher-Rule"
+	// webhookHeader is the name of the webhook called within its rule
+	webhookHeader = "X-Gesher-Webhook"
+	// timeoutHeader is the number of milliseconds left for a webhook to answer in
+	timeoutHeader = "X-Gesher-Timeout-Ms"
+	// versionHeader is the version of gesher calling a webhook
+	versionHeader = "X-Gesher-Version"
+	// payloadModifiedHeader lists the modifications made to the AdmissionReview sent to a webhook, when there are any
+	payloadModifiedHeader = "X-Gesher-Payload-Modified"
+	// attemptHeader is the number of the attempt at calling a webhook, starting from 1
+	attemptHeader = "X-Gesher-Attempt"
+	// hedgedHeader is set on the second request of a hedged attempt
+	hedgedHeader = "X-Gesher-Hedged"
+)
+
+// forwardedHeaders are the only headers of the API server's request passed on to webhooks.  Hop-by-hop headers, the
+// body's length and the API server's credentials are the proxy's own business.
+var forwardedHeaders = []string{"Accept", "Content-Type", "User-Agent"}
+
+// setHeaders sets the headers of req, the call of a webhook that has to be answered by deadline, from those of r,
+// the API server's request to the proxy
+func setHeaders(req *http.Request, r *http.Request, call webhookCall, deadline time.Time) {
+	for _, header := range forwardedHeaders {
+		for _, value := range r.Header.Values(header) {
+			req.Header.Add(header, value)
+		}
+	}
+
+	req.Header.Set(requestUIDHeader, string(call.request.UID))
+	req.Header.Set(ruleHeader, fmt.Sprintf("%v/%v", call.request.Namespace, call.webhook.RuleName))
+	req.Header.Set(webhookHeader, call.webhook.Name)
+	req.Header.Set(timeoutHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+	req.Header.Set(versionHeader, version.Version)
+
+	if len(call.modifications) > 0 {
+		req.Header.Set(payloadModifiedHeader, strings.Join(call.modifications, ", "))
+	}
+}
+
+// requestDeadline returns when the API server stops waiting for the response to r, received at received, zero if its
+// timeout parameter doesn't say
+func requestDeadline(r *http.Request, received time.Time) time.Time {
+	timeout, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+	if err != nil || timeout <= 0 {
+		return time.Time{}
+	}
+
+	return received.Add(timeout)
+}
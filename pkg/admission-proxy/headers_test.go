@@ -0,0 +1,71 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+	"github.com/redislabs/gesher/version"
+)
+
+func TestSetHeaders(t *testing.T) {
+	r := httptest.NewRequest("POST", "/proxy?timeout=10s", nil)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Connection", "keep-alive")
+	r.Header.Set("Content-Length", "100")
+
+	call := webhookCall{
+		webhook:       namespacedvalidatingrule.WebhookConfig{RuleName: "rule", Name: "webhook"},
+		request:       &admv1.AdmissionRequest{UID: "uid", Namespace: "test"},
+		modifications: []string{modificationProjected, modificationRedacted},
+	}
+
+	req := httptest.NewRequest("POST", "/webhook", nil)
+	req.Header = make(map[string][]string)
+	setHeaders(req, r, call, time.Now().Add(5*time.Second))
+
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Empty(t, req.Header.Get("Connection"))
+	assert.Empty(t, req.Header.Get("Content-Length"))
+
+	assert.Equal(t, "uid", req.Header.Get(requestUIDHeader))
+	assert.Equal(t, "test/rule", req.Header.Get(ruleHeader))
+	assert.Equal(t, "webhook", req.Header.Get(webhookHeader))
+	assert.Equal(t, version.Version, req.Header.Get(versionHeader))
+	assert.Equal(t, "projected, redacted", req.Header.Get(payloadModifiedHeader))
+
+	budget, err := strconv.Atoi(req.Header.Get(timeoutHeader))
+	assert.NoError(t, err)
+	assert.True(t, budget > 4000 && budget <= 5000)
+}
+
+func TestRequestDeadline(t *testing.T) {
+	received := time.Now()
+
+	assert.Equal(t, received.Add(10*time.Second), requestDeadline(httptest.NewRequest("POST", "/proxy?timeout=10s", nil), received))
+	assert.True(t, requestDeadline(httptest.NewRequest("POST", "/proxy", nil), received).IsZero())
+	assert.True(t, requestDeadline(httptest.NewRequest("POST", "/proxy?timeout=soon", nil), received).IsZero())
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	skipReasonNoop     = "noop"
+	skipReasonFiltered = "filtered"
+
+	retryReasonConnection = "connection"
+	retryReasonStatus     = "status"
+
+	hedgeWinnerFirst = "first"
+	hedgeWinnerHedge = "hedge"
+
+	backendResultAllowed = "allowed"
+	backendResultDenied  = "denied"
+	backendResultFailed  = "failed"
+)
+
+// skippedUpdates counts the UPDATE requests a webhook was not called for, as they were no-ops or filtered out
+var skippedUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_skipped_updates_total",
+	Help: "Number of UPDATE requests not proxied to a namespaced webhook, by reason",
+}, []string{"namespace", "rule", "webhook", "reason"})
+
+// rejectedCallers counts the requests to the proxy whose caller failed to authenticate
+var rejectedCallers = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_rejected_callers_total",
+	Help: "Number of requests to the proxy rejected as their caller failed to authenticate, by authentication method",
+}, []string{"method"})
+
+// webhookRetries counts the calls of namespaced webhooks retried after failing transiently
+var webhookRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_webhook_retries_total",
+	Help: "Number of calls of a namespaced webhook retried, by the reason of the failure retried",
+}, []string{"namespace", "rule", "webhook", "reason"})
+
+// hedgedRequests counts the attempts at calling namespaced webhooks sent a second time as the first was slow
+var hedgedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_hedged_requests_total",
+	Help: "Number of hedged attempts at calling a namespaced webhook, by the request whose answer was used",
+}, []string{"namespace", "rule", "webhook", "winner"})
+
+// webhookFailovers counts the calls of namespaced webhooks failed over to their next target
+var webhookFailovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_webhook_failovers_total",
+	Help: "Number of calls of a namespaced webhook failed over to its next target",
+}, []string{"namespace", "rule", "webhook"})
+
+// shadowVerdicts counts how the verdicts of shadow webhooks compared with those enforced
+var shadowVerdicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_shadow_verdicts_total",
+	Help: "Number of requests decided by a shadow webhook, by whether it agreed with the enforced verdict or failed",
+}, []string{"namespace", "rule", "webhook", "result"})
+
+// backendRequests counts the requests sent to each backend of namespaced webhooks, by how the backend decided them
+var backendRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gesher_proxy_backend_requests_total",
+	Help: "Number of requests sent to a backend of a namespaced webhook, by whether it allowed, denied or failed them",
+}, []string{"namespace", "rule", "webhook", "backend", "result"})
+
+// backendDuration observes how long the backends of namespaced webhooks took to decide requests
+var backendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gesher_proxy_backend_request_duration_seconds",
+	Help:    "Time taken by a backend of a namespaced webhook to decide a request, including retries and failovers",
+	Buckets: prometheus.DefBuckets,
+}, []string{"namespace", "rule", "webhook", "backend"})
+
+func init() {
+	metrics.Registry.MustRegister(skippedUpdates, rejectedCallers, webhookRetries, hedgedRequests, webhookFailovers, shadowVerdicts,
+		backendRequests, backendDuration)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacecache"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+const (
+	// reviewExtensionField is the field of the AdmissionReviews sent to webhooks gesher adds its own data under
+	reviewExtensionField = "gesher"
+
+	modificationProjected         = "projected"
+	modificationRedacted          = "redacted"
+	modificationNamespaceMetadata = "namespace-metadata"
+)
+
+// ReviewExtension is the data gesher adds to the AdmissionReviews sent to the webhooks asking for it
+type ReviewExtension struct {
+	Namespace *NamespaceMetadata `json:"namespace,omitempty"`
+}
+
+// NamespaceMetadata is the metadata of an admission request's namespace
+type NamespaceMetadata struct {
+	Name        string            `json:"name"`
+	UID         types.UID         `json:"uid,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// webhookBody returns the AdmissionReview to send to webhook for a request in namespace, review being the one the
+// proxy received, along with the modifications made to it.  The request's object and old object are projected and
+// redacted, gesher's extension is added alongside the review's fields, which are otherwise sent unchanged.
+func webhookBody(webhook namespacedvalidatingrule.WebhookConfig, namespace string, review []byte) ([]byte, []string, error) {
+	var modifications []string
+	if len(webhook.Projection) > 0 {
+		modifications = append(modifications, modificationProjected)
+	}
+	if len(webhook.Redactions) > 0 {
+		modifications = append(modifications, modificationRedacted)
+	}
+	if webhook.NamespaceMetadata != nil {
+		modifications = append(modifications, modificationNamespaceMetadata)
+	}
+
+	if len(modifications) == 0 {
+		return review, nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(review, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	if len(webhook.Projection) > 0 || len(webhook.Redactions) > 0 {
+		request, err := filterObjects(fields["request"], webhook.Projection, webhook.Redactions)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields["request"] = request
+	}
+
+	if webhook.NamespaceMetadata != nil {
+		extension, err := json.Marshal(ReviewExtension{Namespace: namespaceMetadata(namespace, *webhook.NamespaceMetadata)})
+		if err != nil {
+			return nil, nil, err
+		}
+		fields[reviewExtensionField] = extension
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, modifications, nil
+}
+
+// filterObjects returns request with its object and old object projected and redacted
+func filterObjects(request json.RawMessage, projection []string, redactions []v1alpha1.Redaction) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(request, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"object", "oldObject"} {
+		raw, ok := fields[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+
+		// numbers are kept as they are written, rather than going through float64
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, err
+		}
+
+		object = project(object, projection)
+		redact(object, redactions)
+
+		filtered, err := json.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = filtered
+	}
+
+	return json.Marshal(fields)
+}
+
+// project returns the fields of object at paths, all of object when there are none
+func project(object map[string]interface{}, paths []string) map[string]interface{} {
+	if len(paths) == 0 {
+		return object
+	}
+
+	projected := make(map[string]interface{})
+	for _, p := range paths {
+		fields := strings.Split(p, ".")
+		if value, found, _ := unstructured.NestedFieldNoCopy(object, fields...); found {
+			// a path going through a non-object field is not found, so this can't fail
+			_ = unstructured.SetNestedField(projected, value, fields...)
+		}
+	}
+
+	return projected
+}
+
+// redact hides the fields of object redactions apply to
+func redact(object map[string]interface{}, redactions []v1alpha1.Redaction) {
+	for _, redaction := range redactions {
+		fields := strings.Split(redaction.Path, ".")
+		value, found, _ := unstructured.NestedFieldNoCopy(object, fields...)
+		if !found {
+			continue
+		}
+
+		if redaction.Mode == v1alpha1.RedactionHash {
+			_ = unstructured.SetNestedField(object, hashValues(value), fields...)
+		} else {
+			unstructured.RemoveNestedField(object, fields...)
+		}
+	}
+}
+
+// hashValues returns value with each of the scalars within it replaced by its SHA-256 hash
+func hashValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		hashed := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			hashed[k] = hashValues(item)
+		}
+		return hashed
+	case []interface{}:
+		hashed := make([]interface{}, len(v))
+		for i, item := range v {
+			hashed[i] = hashValues(item)
+		}
+		return hashed
+	case string:
+		return hashString([]byte(v))
+	default:
+		// other scalars are hashed as they are written
+		data, _ := json.Marshal(v)
+		return hashString(data)
+	}
+}
+
+func hashString(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// namespaceMetadata returns the cached metadata of namespace selection selects, just its name if it isn't cached yet
+func namespaceMetadata(namespace string, selection v1alpha1.NamespaceMetadataSelection) *NamespaceMetadata {
+	metadata := &NamespaceMetadata{Name: namespace}
+
+	info, ok := namespacecache.NamespaceData.Info(namespace)
+	if !ok {
+		return metadata
+	}
+
+	metadata.UID = info.UID
+	metadata.Labels = selectKeys(info.Labels, selection.Labels)
+	metadata.Annotations = selectKeys(info.Annotations, selection.Annotations)
+
+	return metadata
+}
+
+// selectKeys returns the entries of m whose keys match any of globs, all of them when there are no globs
+func selectKeys(m map[string]string, globs []string) map[string]string {
+	if len(globs) == 0 {
+		return m
+	}
+
+	selected := make(map[string]string)
+	for k, v := range m {
+		for _, glob := range globs {
+			if matched, _ := path.Match(glob, k); matched {
+				selected[k] = v
+				break
+			}
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacecache"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+const testReview = `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1","request":{"uid":"1","namespace":"test"}}`
+
+func TestWebhookBodyNamespaceMetadata(t *testing.T) {
+	saved := namespacecache.NamespaceData
+	defer func() { namespacecache.NamespaceData = saved }()
+	namespacecache.NamespaceData = (&namespacecache.NamespaceDataType{}).Update(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test",
+		UID:         "uid",
+		Labels:      map[string]string{"team": "a", "app.kubernetes.io/part-of": "billing"},
+		Annotations: map[string]string{"owner": "a@example.com"},
+	}})
+
+	webhook := namespacedvalidatingrule.WebhookConfig{Name: "webhook"}
+	body, modifications, err := webhookBody(webhook, "test", []byte(testReview))
+	assert.NoError(t, err)
+	assert.Equal(t, testReview, string(body))
+	assert.Empty(t, modifications)
+
+	webhook.NamespaceMetadata = &v1alpha1.NamespaceMetadataSelection{Labels: []string{"team"}}
+	body, modifications, err = webhookBody(webhook, "test", []byte(testReview))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{modificationNamespaceMetadata}, modifications)
+
+	var fields map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(body, &fields))
+	assert.JSONEq(t, `{"uid":"1","namespace":"test"}`, string(fields["request"]))
+
+	var extension ReviewExtension
+	assert.NoError(t, json.Unmarshal(fields[reviewExtensionField], &extension))
+	assert.Equal(t, &NamespaceMetadata{
+		Name:        "test",
+		UID:         "uid",
+		Labels:      map[string]string{"team": "a"},
+		Annotations: map[string]string{"owner": "a@example.com"},
+	}, extension.Namespace)
+
+	// a namespace the cache doesn't know yet is sent by name only
+	body, _, err = webhookBody(webhook, "other", []byte(testReview))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(body, &fields))
+	assert.JSONEq(t, `{"namespace":{"name":"other"}}`, string(fields[reviewExtensionField]))
+
+	_, _, err = webhookBody(webhook, "test", []byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestWebhookBodyFilterObjects(t *testing.T) {
+	review := `{"kind":"AdmissionReview","request":{"uid":"1",` +
+		`"object":{"kind":"Secret","metadata":{"name":"a","labels":{"team":"a"}},"data":{"password":"cGFzcw==","user":"dXNlcg=="},"size":12345678901234567890},` +
+		`"oldObject":null}}`
+
+	webhook := namespacedvalidatingrule.WebhookConfig{
+		Name:       "webhook",
+		Projection: []string{"metadata.labels", "data", "size", "missing"},
+		Redactions: []v1alpha1.Redaction{
+			{Path: "data.password", Mode: v1alpha1.RedactionHash},
+			{Path: "data.user"},
+			{Path: "metadata.labels.missing"},
+		},
+	}
+
+	body, modifications, err := webhookBody(webhook, "test", []byte(review))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{modificationProjected, modificationRedacted}, modifications)
+
+	var fields map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(body, &fields))
+	var request map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(fields["request"], &request))
+
+	assert.JSONEq(t, `"1"`, string(request["uid"]))
+	assert.JSONEq(t, `null`, string(request["oldObject"]))
+	// Secret data is hashed as it is sent, base64 encoded
+	assert.JSONEq(t, `{
+		"metadata":{"labels":{"team":"a"}},
+		"data":{"password":"sha256:4535f470996d64296e167f226c8f52fd19e4332003253a023038e3ccedcf4b05"},
+		"size":12345678901234567890
+	}`, string(request["object"]))
+	// large numbers go through unchanged
+	assert.Contains(t, string(request["object"]), "12345678901234567890")
+}
+
+func TestHashValues(t *testing.T) {
+	hashed := hashValues(map[string]interface{}{"a": []interface{}{"x", true}}).(map[string]interface{})
+	list := hashed["a"].([]interface{})
+	assert.Equal(t, hashString([]byte("x")), list[0])
+	assert.Equal(t, hashString([]byte("true")), list[1])
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultBackoff is how long the first retry of a webhook waits when its policy doesn't say
+	defaultBackoff = 100 * time.Millisecond
+)
+
+// answer is a webhook's answer to a request, or why there is none
+type answer struct {
+	resp *http.Response
+	err  error
+}
+
+// cancelBody cancels the context of the request its body answers once it is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// callWithRetries calls the webhook at url with client, retrying transient failures as its policy allows while ctx,
+// which ends at deadline, leaves time for them.  Retries are counted by webhookRetries and logged, there being no
+// tracing to record them in.
+func callWithRetries(ctx context.Context, client *http.Client, url string, call webhookCall, r *http.Request, deadline time.Time) (*http.Response, error) {
+	webhook := call.webhook
+	maxAttempts, backoff, hedge := 1, defaultBackoff, time.Duration(0)
+	if retry := webhook.Retry; retry != nil {
+		if retry.MaxAttempts > 1 {
+			maxAttempts = int(retry.MaxAttempts)
+		}
+		if retry.BackoffMilliseconds > 0 {
+			backoff = time.Duration(retry.BackoffMilliseconds) * time.Millisecond
+		}
+		if retry.HedgeAfterMilliseconds != nil {
+			hedge = time.Duration(*retry.HedgeAfterMilliseconds) * time.Millisecond
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		a := send(ctx, client, url, call, r, deadline, attempt, hedge)
+
+		reason := retryReason(ctx, a)
+		if reason == "" || attempt >= maxAttempts {
+			return a.resp, a.err
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			log.V(1).Info(fmt.Sprintf("callWithRetries: no time left to retry webhook %v of rule %v", webhook.Name, webhook.RuleName),
+				"UID", call.request.UID, "attempt", attempt, "reason", reason)
+			return a.resp, a.err
+		}
+
+		closeAnswer(a)
+		log.Info("retrying webhook", "rule", webhook.RuleName, "webhook", webhook.Name, "UID", call.request.UID,
+			"attempt", attempt, "reason", reason, "backoff", backoff.String())
+		webhookRetries.WithLabelValues(call.request.Namespace, webhook.RuleName, webhook.Name, reason).Inc()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryReason returns why a is worth retrying, empty when it isn't: the webhook answered it or ctx is over
+func retryReason(ctx context.Context, a answer) string {
+	switch {
+	case ctx.Err() != nil:
+		return ""
+	case a.err != nil:
+		return retryReasonConnection
+	case a.resp.StatusCode >= http.StatusInternalServerError:
+		return retryReasonStatus
+	default:
+		return ""
+	}
+}
+
+// send makes an attempt at calling the webhook at url.  When hedge is set and the webhook hasn't answered within it,
+// the attempt is sent a second time and the first useful answer is used.
+func send(ctx context.Context, client *http.Client, url string, call webhookCall, r *http.Request, deadline time.Time, attempt int, hedge time.Duration) answer {
+	if hedge <= 0 {
+		return post(ctx, client, url, call, r, deadline, attempt, false)
+	}
+
+	answers := make(chan answer, 2)
+	go func() { answers <- post(ctx, client, url, call, r, deadline, attempt, false) }()
+
+	timer := time.NewTimer(hedge)
+	defer timer.Stop()
+
+	select {
+	case a := <-answers:
+		return a
+	case <-timer.C:
+	}
+
+	log.V(1).Info(fmt.Sprintf("send: hedging attempt %v at webhook %v of rule %v", attempt, call.webhook.Name, call.webhook.RuleName),
+		"UID", call.request.UID)
+	hedged := make(chan answer, 1)
+	go func() { hedged <- post(ctx, client, url, call, r, deadline, attempt, true) }()
+
+	// a retriable answer is only used if the other request's is too
+	var first answer
+	winner := hedgeWinnerFirst
+	select {
+	case first = <-answers:
+		if retryReason(ctx, first) != "" {
+			closeAnswer(first)
+			first, winner = <-hedged, hedgeWinnerHedge
+		} else {
+			go func() { closeAnswer(<-hedged) }()
+		}
+	case first = <-hedged:
+		winner = hedgeWinnerHedge
+		if retryReason(ctx, first) != "" {
+			closeAnswer(first)
+			first, winner = <-answers, hedgeWinnerFirst
+		} else {
+			go func() { closeAnswer(<-answers) }()
+		}
+	}
+
+	hedgedRequests.WithLabelValues(call.request.Namespace, call.webhook.RuleName, call.webhook.Name, winner).Inc()
+	return first
+}
+
+// post sends a single request calling the webhook at url, which is closed after it, so that hedged and retried
+// requests are balanced anew between the endpoints of the webhook's service
+func post(ctx context.Context, client *http.Client, url string, call webhookCall, r *http.Request, deadline time.Time, attempt int, hedged bool) answer {
+	ctx, cancel := context.WithCancel(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(call.body))
+	if err != nil {
+		cancel()
+		log.Error(err, "post: NewRequestWithContext failed")
+		return answer{err: err}
+	}
+
+	req.Close = true
+
+	setHeaders(req, r, call, deadline)
+	req.Header.Set(attemptHeader, strconv.Itoa(attempt))
+	if hedged {
+		req.Header.Set(hedgedHeader, "true")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil || resp.Body == nil {
+		cancel()
+		return answer{resp: resp, err: err}
+	}
+
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return answer{resp: resp}
+}
+
+// closeAnswer releases an answer that isn't used
+func closeAnswer(a answer) {
+	if a.resp != nil && a.resp.Body != nil {
+		a.resp.Body.Close()
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+const (
+	allowedReview = `{"response": {"allowed": true}}`
+	deniedReview  = `{"response": {"allowed": false}}`
+)
+
+// flakyServer answers with the statuses listed, one per request, and an allowing review once they run out.  It
+// returns the attempt headers of the requests it got.
+func flakyServer(t *testing.T, statuses ...int) (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var attempts []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts = append(attempts, r.Header.Get(attemptHeader))
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		lock.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte(allowedReview))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), attempts...)
+	}
+}
+
+func retryCall(rule string, retry *v1alpha1.RetryPolicy) webhookCall {
+	return webhookCall{
+		webhook: namespacedvalidatingrule.WebhookConfig{RuleName: rule, Name: "webhook", Retry: retry},
+		request: &admv1.AdmissionRequest{UID: "uid", Namespace: "test"},
+	}
+}
+
+func callServer(server *httptest.Server, call webhookCall, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	resp, err := callWithRetries(ctx, server.Client(), server.URL, call, httptest.NewRequest("POST", "/proxy", nil), deadline)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+func TestCallWithRetries(t *testing.T) {
+	server, attempts := flakyServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	call := retryCall("retried", &v1alpha1.RetryPolicy{MaxAttempts: 3, BackoffMilliseconds: 1})
+
+	status, err := callServer(server, call, 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"1", "2", "3"}, attempts())
+	assert.Equal(t, 2.0, testutil.ToFloat64(webhookRetries.WithLabelValues("test", "retried", "webhook", retryReasonStatus)))
+
+	// the last attempt's answer is used
+	server, attempts = flakyServer(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	status, err = callServer(server, retryCall("exhausted", &v1alpha1.RetryPolicy{MaxAttempts: 2, BackoffMilliseconds: 1}), 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Len(t, attempts(), 2)
+
+	// webhooks without a policy are called once
+	server, attempts = flakyServer(t, http.StatusInternalServerError)
+	status, _ = callServer(server, retryCall("once", nil), 5*time.Second)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Len(t, attempts(), 1)
+}
+
+func TestCallWithRetriesDenial(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(deniedReview))
+	}))
+	defer server.Close()
+
+	status, err := callServer(server, retryCall("denied", &v1alpha1.RetryPolicy{MaxAttempts: 3, BackoffMilliseconds: 1}), 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, calls)
+}
+
+func TestCallWithRetriesDeadline(t *testing.T) {
+	server, attempts := flakyServer(t, http.StatusServiceUnavailable)
+
+	// the backoff doesn't fit before the deadline
+	status, err := callServer(server, retryCall("deadline", &v1alpha1.RetryPolicy{MaxAttempts: 3, BackoffMilliseconds: 1000}), 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Len(t, attempts(), 1)
+}
+
+func TestCallWithRetriesConnection(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := callServer(server, retryCall("connection", &v1alpha1.RetryPolicy{MaxAttempts: 2, BackoffMilliseconds: 1}), 5*time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(webhookRetries.WithLabelValues("test", "connection", "webhook", retryReasonConnection)))
+}
+
+func TestCallWithRetriesHedge(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(hedgedHeader) == "" {
+			// the first request is stuck until the test is over
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			w.Write([]byte(deniedReview))
+			return
+		}
+		w.Write([]byte(allowedReview))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	hedge := int32(20)
+	call := retryCall("hedged", &v1alpha1.RetryPolicy{HedgeAfterMilliseconds: &hedge})
+
+	deadline := time.Now().Add(5 * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	resp, err := callWithRetries(ctx, server.Client(), server.URL, call, httptest.NewRequest("POST", "/proxy", nil), deadline)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		assert.NoError(t, toFailure("webhook", resp, nil, "Fail"))
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(hedgedRequests.WithLabelValues("test", "hedged", "webhook", hedgeWinnerHedge)))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	admv1 "k8s.io/api/admission/v1"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+const (
+	// shadowDecisionWait bounds how long a shadow's verdict waits for the enforced one, which never comes when
+	// reviewing the request panicked
+	shadowDecisionWait = time.Minute
+
+	shadowAgreed    = "agreed"
+	shadowDisagreed = "disagreed"
+	shadowFailed    = "failed"
+)
+
+// callShadows calls shadow webhooks in the background, but for those over quota.  Their verdicts are compared with the
+// enforced one once it is reported through the function returned, which has to be called exactly once.
+func callShadows(shadows []namespacedvalidatingrule.WebhookConfig, request *admv1.AdmissionRequest, r *http.Request, body []byte) func(allowed bool) {
+	if len(shadows) == 0 {
+		return func(bool) {}
+	}
+
+	// the API server's request is done with by the time the shadows are
+	r = r.Clone(context.Background())
+
+	var enforced bool
+	decided := make(chan struct{})
+
+	for _, webhook := range shadows {
+		if err := checkQuota(webhook, request.Namespace); err != nil {
+			log.Info(fmt.Sprintf("callShadows: not calling %v", err), "UID", request.UID)
+			recordShadow(webhook, request.Namespace, shadowFailed, "")
+			continue
+		}
+
+		payload, modifications, err := webhookBody(webhook, request.Namespace, body)
+		if err != nil {
+			log.Error(err, "callShadows: webhookBody failed")
+			recordShadow(webhook, request.Namespace, shadowFailed, "")
+			continue
+		}
+
+		// the shadow's latency isn't the API server's concern, so its deadline doesn't apply
+		call := webhookCall{
+			webhook:       webhook,
+			request:       request,
+			body:          payload,
+			modifications: modifications,
+		}
+		go func() {
+			// a panic is recorded as the shadow's failure, whatever the panic policy
+			err := safeCall(call, r)
+			select {
+			case <-decided:
+				compareShadow(call, err, enforced)
+			case <-time.After(shadowDecisionWait):
+				log.Info("no enforced verdict to compare the shadow webhook's with", "rule", call.webhook.RuleName,
+					"webhook", call.webhook.Name, "UID", call.request.UID)
+			}
+		}()
+	}
+
+	return func(allowed bool) {
+		enforced = allowed
+		close(decided)
+	}
+}
+
+// compareShadow records how the verdict of a shadow webhook, whose call returned err, compares with the enforced one
+func compareShadow(call webhookCall, err error, enforced bool) {
+	var denied *deniedError
+	var allowed bool
+	switch {
+	case err == nil:
+		allowed = true
+	case errors.As(err, &denied):
+		allowed = false
+	default:
+		log.V(1).Info(fmt.Sprintf("compareShadow: shadow webhook %v of rule %v failed: %v", call.webhook.Name, call.webhook.RuleName, err))
+		recordShadow(call.webhook, call.request.Namespace, shadowFailed, "")
+		return
+	}
+
+	if allowed == enforced {
+		recordShadow(call.webhook, call.request.Namespace, shadowAgreed, "")
+		return
+	}
+
+	request := call.request
+	message := fmt.Sprintf("%v of %v %v by %v was %v, the shadow webhook %v it", request.Operation, request.Resource.Resource,
+		request.Name, request.UserInfo.Username, verdict(enforced), verdict(allowed))
+	if denied != nil {
+		message = fmt.Sprintf("%v: %v", message, denied.result.Message)
+	}
+	log.Info("shadow webhook disagreed", "rule", call.webhook.RuleName, "webhook", call.webhook.Name, "UID", request.UID,
+		"enforced", verdict(enforced), "shadow", verdict(allowed))
+	recordShadow(call.webhook, request.Namespace, shadowDisagreed, message)
+}
+
+// recordShadow records the result of comparing a shadow webhook's verdict, in metrics and for the rule's status
+func recordShadow(webhook namespacedvalidatingrule.WebhookConfig, namespace, result, message string) {
+	shadowVerdicts.WithLabelValues(namespace, webhook.RuleName, webhook.Name, result).Inc()
+
+	switch result {
+	case shadowFailed:
+		namespacedvalidatingrule.RecordShadowFailure(namespace, webhook.RuleName, webhook.Name)
+	default:
+		namespacedvalidatingrule.RecordShadowVerdict(namespace, webhook.RuleName, webhook.Name, result == shadowAgreed, message, time.Now())
+	}
+}
+
+func verdict(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
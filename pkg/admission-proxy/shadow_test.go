@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+func shadowWebhook(rule, name string) namespacedvalidatingrule.WebhookConfig {
+	webhook := testWebhook(rule, name, "")
+	webhook.Shadow = true
+	return webhook
+}
+
+func TestCheckWebhooksShadow(t *testing.T) {
+	called := fakeWebhooks(t, "shadow/denying")
+	webhooks := []namespacedvalidatingrule.WebhookConfig{
+		testWebhook("enforced", "allowing", ""),
+		shadowWebhook("shadow", "denying"),
+		shadowWebhook("shadow", "allowing"),
+	}
+	request := &admv1.AdmissionRequest{UID: "uid", Namespace: "shadow-test"}
+
+	// the shadow denying the request doesn't deny it
+	response := checkWebhooks(webhooks, request, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.True(t, response.Allowed)
+
+	disagreed := shadowVerdicts.WithLabelValues("shadow-test", "shadow", "denying", shadowDisagreed)
+	agreed := shadowVerdicts.WithLabelValues("shadow-test", "shadow", "allowing", shadowAgreed)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(disagreed) == 1 && testutil.ToFloat64(agreed) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"enforced/allowing", "shadow/denying", "shadow/allowing"}, called())
+}
+
+func TestCompareShadow(t *testing.T) {
+	request := &admv1.AdmissionRequest{UID: "uid", Namespace: "compare-test", Operation: admv1.Create, Name: "pod"}
+	request.Resource.Resource = "pods"
+	request.UserInfo.Username = "user"
+	call := webhookCall{webhook: shadowWebhook("compare", "webhook"), request: request}
+	result := func(r string) float64 {
+		return testutil.ToFloat64(shadowVerdicts.WithLabelValues("compare-test", "compare", "webhook", r))
+	}
+
+	compareShadow(call, nil, true)
+	assert.Equal(t, 1.0, result(shadowAgreed))
+
+	compareShadow(call, errors.New("connection refused"), true)
+	assert.Equal(t, 1.0, result(shadowFailed))
+
+	// ignored failures are failures too, not verdicts
+	compareShadow(call, &ignoredError{name: "compare/webhook", err: errors.New("timeout")}, false)
+	assert.Equal(t, 2.0, result(shadowFailed))
+
+	compareShadow(call, nil, false)
+	assert.Equal(t, 1.0, result(shadowDisagreed))
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package admission_proxy
 
 import (
+	"errors"
+	"net/http"
 	"os"
 
 	admregv1 "k8s.io/api/admission/v1"
@@ -24,13 +26,38 @@ import (
 	"k8s.io/klog"
 )
 
+const (
+	// bypassAuditAnnotation is the audit annotation recording why a request was bypassed
+	bypassAuditAnnotation = "bypass"
+
+	// maxResponseBytes bounds the AdmissionReviews read from proxied webhooks
+	maxResponseBytes = 1 << 20
+)
+
 // toAdmissionResponse is a helper function to create an AdmissionResponse
-// with an embedded error
+// with an embedded error, forbidding the request when a webhook denied it and failing it otherwise
 func errToAdmissionResponse(err error) *admregv1.AdmissionResponse {
+	result := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: err.Error(),
+		Code:    http.StatusInternalServerError,
+		Reason:  metav1.StatusReasonInternalError,
+	}
+
+	var denied *deniedError
+	if errors.As(err, &denied) {
+		result.Code = http.StatusForbidden
+		result.Reason = metav1.StatusReasonForbidden
+		if denied.result.Code != 0 {
+			result.Code = denied.result.Code
+		}
+		if denied.result.Reason != "" {
+			result.Reason = denied.result.Reason
+		}
+	}
+
 	return &admregv1.AdmissionResponse{
-		Result: &metav1.Status{
-			Message: err.Error(),
-		},
+		Result:  result,
 		Allowed: false,
 	}
 }
@@ -41,6 +68,15 @@ func approved() *admregv1.AdmissionResponse {
 	}
 }
 
+// bypassed approves a request without calling any webhook, recording why in the audit log and warning the requester
+func bypassed(reason string) *admregv1.AdmissionResponse {
+	return &admregv1.AdmissionResponse{
+		Allowed:          true,
+		AuditAnnotations: map[string]string{bypassAuditAnnotation: reason},
+		Warnings:         []string{"gesher admission webhooks bypassed: " + reason},
+	}
+}
+
 func GetNamespace() string {
 	namespace := os.Getenv("POD_NAMESPACE")
 	if namespace == "" {
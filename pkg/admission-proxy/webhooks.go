@@ -17,23 +17,38 @@ limitations under the License.
 package admission_proxy
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
 
 	admv1 "k8s.io/api/admission/v1"
 	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/common"
+	"github.com/redislabs/gesher/pkg/controller/namespacecache"
 	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookquota"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
+	"github.com/redislabs/gesher/pkg/tls_manager"
+)
+
+// clientCertificates holds the client certificate presented to every webhook
+var clientCertificates = tls_manager.NewKeyPairReloader(
+	filepath.Join(common.CertDir, common.ClientCertPem),
+	filepath.Join(common.CertDir, common.ClientPrivPem),
 )
 
 func findWebhooks(request *admv1.AdmissionRequest) []namespacedvalidatingrule.WebhookConfig {
@@ -42,83 +57,273 @@ func findWebhooks(request *admv1.AdmissionRequest) []namespacedvalidatingrule.We
 	return namespacedvalidatingrule.EndpointData.Get(request.Namespace, request.Resource, op)
 }
 
-// code is inspired by k8s.io/apiserver/pkg/admission/plugin/webhook/validating/dispatcher.go
-func checkWebhooks(webhooks []namespacedvalidatingrule.WebhookConfig, r *http.Request, body *bytes.Reader) *admv1.AdmissionResponse {
-	if len(webhooks) == 0 {
-		return approved()
+// bypassReason returns why an administrator's bypass approves request at now, empty when none does
+func bypassReason(request *admv1.AdmissionRequest, now time.Time) string {
+	if b := namespacecache.NamespaceData.Bypass(request.Namespace); b.Active(now) {
+		return fmt.Sprintf("namespace %v is bypassed %v", request.Namespace, b)
 	}
 
-	wg := &sync.WaitGroup{}
-	errCh := make(chan error, len(webhooks))
+	op := admregv1.OperationType(request.Operation)
+	if name, b := namespacedvalidatingtype.TypeBypassed(request.Namespace, request.Resource, op, now); b != nil {
+		return fmt.Sprintf("NamespacedValidatingType %v is bypassed %v", name, b)
+	}
+
+	return ""
+}
 
-	wg.Add(len(webhooks))
+// code is inspired by k8s.io/apiserver/pkg/admission/plugin/webhook/validating/dispatcher.go.  deadline is when the API
+// server stops waiting for the response, zero if it didn't say.
+func checkWebhooks(webhooks []namespacedvalidatingrule.WebhookConfig, request *admv1.AdmissionRequest, r *http.Request, body []byte, deadline time.Time) *admv1.AdmissionResponse {
+	namespace := request.Namespace
 
+	// webhooks not matching the requesting user, the object's name or the fields an update changes are skipped before
+	// any of them is called
+	update := namespacedvalidatingrule.NewUpdate(request)
+	var matching []namespacedvalidatingrule.WebhookConfig
 	for _, webhook := range webhooks {
-		go doWebhook(webhook, wg, r, body, errCh)
+		if !namespacedvalidatingrule.MatchesUserInfo(webhook.UserInfo, request.UserInfo) {
+			log.V(2).Info(fmt.Sprintf("checkWebhooks: skipping webhook %v of rule %v for user %v", webhook.Name, webhook.RuleName, request.UserInfo.Username))
+			continue
+		}
+		if !namespacedvalidatingrule.MatchesResourceName(webhook.ResourceNames, request) {
+			log.V(2).Info(fmt.Sprintf("checkWebhooks: skipping webhook %v of rule %v for object %v", webhook.Name, webhook.RuleName, request.Name))
+			continue
+		}
+		if update.Noop() {
+			log.V(2).Info(fmt.Sprintf("checkWebhooks: skipping webhook %v of rule %v for no-op update of %v", webhook.Name, webhook.RuleName, request.Name))
+			skippedUpdates.WithLabelValues(namespace, webhook.RuleName, webhook.Name, skipReasonNoop).Inc()
+			continue
+		}
+		if !update.Selected(webhook.UpdateFilter) {
+			log.V(2).Info(fmt.Sprintf("checkWebhooks: skipping webhook %v of rule %v for filtered update of %v", webhook.Name, webhook.RuleName, request.Name))
+			skippedUpdates.WithLabelValues(namespace, webhook.RuleName, webhook.Name, skipReasonFiltered).Inc()
+			continue
+		}
+		matching = append(matching, webhook)
 	}
 
-	wg.Wait()
-	close(errCh)
-
-	var errs []error
-	for e := range errCh {
-		if e != nil {
-			errs = append(errs, e)
+	// shadow webhooks are called alongside the others, but the answer doesn't wait for them nor depend on them
+	var shadows []namespacedvalidatingrule.WebhookConfig
+	webhooks = nil
+	for _, webhook := range matching {
+		if webhook.Shadow {
+			shadows = append(shadows, webhook)
+		} else {
+			webhooks = append(webhooks, webhook)
 		}
 	}
-	if len(errs) == 0 {
+	enforced := callShadows(shadows, request, r, body)
+
+	if len(webhooks) == 0 {
+		enforced(true)
 		return approved()
 	}
 
-	if len(errs) > 1 {
-		// TODO: merge status errors; until then, just return the first one.
-		log.V(3).Info("TODO: merge status errors; until then, just return the first one.")
+	// parallel webhooks are each called on their own, while the webhooks of a sequential rule are called one after
+	// another in order, stopping once their votes settle the decision
+	namespaceDecision := namespacecache.NamespaceData.Decision(namespace)
+	results := make([]webhookResult, len(webhooks))
+	var chains [][]webhookCall
+	sequential := make(map[string]int)
+	stopped := make(map[string]bool)
+
+	var warnings []string
+
+	// a webhook failing before it is called votes according to its failure policy, which may settle the decision of a
+	// sequential rule like a call would
+	fail := func(i int, err error) {
+		webhook := webhooks[i]
+		results[i].voted = true
+		results[i].err = err
+		if webhook.Evaluation == v1alpha1.EvaluationSequential && settles(decisionOf(webhook, namespaceDecision), voteOf(err)) {
+			stopped[webhook.RuleName] = true
+		}
 	}
 
-	return errToAdmissionResponse(errs[0])
+	for i, webhook := range webhooks {
+		results[i].webhook = webhook
+		if stopped[webhook.RuleName] {
+			continue
+		}
+
+		// webhooks over quota are never called.  The response warns of those whose failure policy ignores it, as
+		// nothing else would tell of them.
+		if err := checkQuota(webhook, namespace); err != nil {
+			log.Info(fmt.Sprintf("checkWebhooks: not calling %v", err), "UID", request.UID)
+			fail(i, errToFailure("webhook", err, webhook.FailurePolicy))
+			if voteOf(results[i].err) == voteAbstain {
+				warnings = append(warnings, fmt.Sprintf("gesher did not call %v", err))
+			}
+			continue
+		}
+
+		// objects are projected and redacted before anything is sent, each webhook getting its own body
+		payload, modifications, err := webhookBody(webhook, namespace, body)
+		if err != nil {
+			log.Error(err, "checkWebhooks: webhookBody failed")
+			fail(i, toFailure("webhook", nil, err, webhook.FailurePolicy))
+			continue
+		}
+
+		call := webhookCall{
+			webhook:       webhook,
+			request:       request,
+			position:      i,
+			body:          payload,
+			modifications: modifications,
+			deadline:      deadline,
+		}
+
+		if webhook.Evaluation != v1alpha1.EvaluationSequential {
+			chains = append(chains, []webhookCall{call})
+			continue
+		}
+
+		chain, ok := sequential[webhook.RuleName]
+		if !ok {
+			chain = len(chains)
+			sequential[webhook.RuleName] = chain
+			chains = append(chains, nil)
+		}
+		chains[chain] = append(chains[chain], call)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(chains))
+	for _, chain := range chains {
+		go callChain(chain, decisionOf(chain[0].webhook, namespaceDecision), results, wg, r)
+	}
+	wg.Wait()
+
+	// the results are in the webhooks' order, so requests several webhooks deny are always answered the same way
+	response := decide(results, namespaceDecision)
+	response.Warnings = append(response.Warnings, warnings...)
+	enforced(response.Allowed)
+
+	return response
 }
 
-func doWebhook(webhook namespacedvalidatingrule.WebhookConfig, wg *sync.WaitGroup, r *http.Request, body *bytes.Reader, errCh chan error) {
+// webhookResult is the outcome of proxying a request to a webhook
+type webhookResult struct {
+	webhook namespacedvalidatingrule.WebhookConfig
+	// voted is false for webhooks a sequential rule stopped before
+	voted bool
+	// err is why the webhook doesn't allow the request, nil when it does
+	err error
+}
+
+// callChain calls chain's webhooks one after another, stopping once a vote settles decision, and records their
+// results at their positions
+func callChain(chain []webhookCall, decision v1alpha1.DecisionStrategy, results []webhookResult, wg *sync.WaitGroup, r *http.Request) {
 	defer wg.Done()
 
-	url := serviceToUrl(webhook.ClientConfig.Service)
+	for i, call := range chain {
+		err := safeCall(call, r)
+		results[call.position].voted = true
+		results[call.position].err = err
+		if settles(decision, voteOf(err)) {
+			if rest := len(chain) - i - 1; rest > 0 {
+				log.V(1).Info(fmt.Sprintf("callChain: webhook %v of rule %v settled the %v decision, not calling the %v after it",
+					call.webhook.Name, call.webhook.RuleName, decision, rest))
+			}
+			return
+		}
+	}
+}
 
-	// TODO: Perhaps include system wide certs here?
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(webhook.ClientConfig.CABundle)
+// webhookCall is a call of a webhook for an admission request
+type webhookCall struct {
+	webhook namespacedvalidatingrule.WebhookConfig
+	request *admv1.AdmissionRequest
+	// position is the webhook's place among those the request is proxied to, where its result is recorded
+	position int
+	// body is the AdmissionReview sent, with modifications made to the one the proxy received
+	body          []byte
+	modifications []string
+	// deadline is when the API server stops waiting, zero if it didn't say
+	deadline time.Time
+}
 
-	client := &http.Client{
-		Timeout: time.Duration(webhook.TimeoutSecs) * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: caCertPool,
-			},
-		},
-	}
+// callWebhook calls a webhook, it is only replaced by tests
+var callWebhook = doWebhook
+
+// safeCall calls a webhook, turning a panic into its failure according to the panic policy of the handler serving r.
+// Webhooks are called in goroutines of their own, whose panics the handler can't recover from.
+func safeCall(call webhookCall, r *http.Request) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+			log.Error(err, "calling the webhook panicked", "rule", call.webhook.RuleName, "webhook", call.webhook.Name,
+				"UID", call.request.UID, "stack", string(debug.Stack()))
+			err = errToFailure("webhook", err, panicPolicy(r))
+		}
+	}()
+
+	return callWebhook(call, r)
+}
 
-	req, err := http.NewRequestWithContext(context.TODO(), "POST", url, body)
+// doWebhook calls a webhook, returning why it rejects the request, nil when it doesn't
+func doWebhook(call webhookCall, r *http.Request) (err error) {
+	webhook, namespace := call.webhook, call.request.Namespace
+
+	backend, clientConfig := chooseBackend(webhook, call.request)
+	start := time.Now()
+	defer func() {
+		recordBackend(webhook, namespace, backend, err, time.Since(start))
+	}()
+
+	// the rule controller only proxies granted services, but a grant can be revoked before it catches up
+	targets, err := grantedTargets(webhook, clientConfig, namespace)
 	if err != nil {
-		log.Error(err, "doWebhook: NewRequestWithContext failed")
-		err = toFailure("webhook", nil, err, webhook.FailurePolicy)
-		errCh <- err
-		return
+		log.V(1).Info(fmt.Sprintf("doWebhook: %v", err))
+		return errToFailure("webhook", err, webhook.FailurePolicy)
 	}
 
-	req.Close = true
-
-	for k, v := range r.Header {
-		for _, s := range v {
-			req.Header.Add(k, s)
+	if webhook.RequireMutualTLS {
+		if _, err := clientCertificates.Load(); err != nil {
+			log.Error(err, "doWebhook: no client certificate for a webhook requiring mutual TLS")
+			return errToFailure("webhook", fmt.Errorf("no client certificate for webhook %v of rule %v: %v", webhook.Name, webhook.RuleName, err), webhook.FailurePolicy)
 		}
 	}
 
-	resp, err := client.Do(req)
+	// the webhook's own timeout applies, unless the API server gives up before it
+	deadline := time.Now().Add(time.Duration(webhook.TimeoutSecs) * time.Second)
+	if !call.deadline.IsZero() && call.deadline.Before(deadline) {
+		deadline = call.deadline
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	resp, err := callTargets(ctx, targets, call, r, deadline)
 	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close()
 	}
-	err = toFailure("webhook", resp, err, webhook.FailurePolicy)
 
-	errCh <- err
+	return toFailure("webhook", resp, err, webhook.FailurePolicy)
+}
+
+// checkGrant verifies a webhook proxied for a request in namespace may be sent to service
+func checkGrant(service *admregv1.ServiceReference, namespace string) error {
+	if service == nil {
+		return nil
+	}
+
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if !webhookservicegrant.GrantData.Allowed(namespace, key) {
+		return fmt.Errorf("no WebhookServiceGrant allows namespace %v to send requests to service %v", namespace, key)
+	}
+
+	return nil
+}
+
+// checkQuota verifies a webhook proxied for a request in namespace is within the namespace's WebhookQuotas, as the
+// WebhookQuota controller evaluated them
+func checkQuota(webhook namespacedvalidatingrule.WebhookConfig, namespace string) error {
+	if reason := webhookquota.QuotaData.Excess(namespace, webhook.RuleName, webhook.Name); reason != "" {
+		return fmt.Errorf("webhook %v of rule %v, over the WebhookQuota of namespace %v with %v", webhook.Name, webhook.RuleName, namespace, reason)
+	}
+
+	return nil
 }
 
 func serviceToUrl(service *admregv1.ServiceReference) string {
@@ -155,10 +360,17 @@ func toFailure(name string, resp *http.Response, httpErr error, failurePolicy ad
 		return errToFailure(name, errors.New("response body is nil"), failurePolicy)
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errToFailure(name, fmt.Errorf("unexpected status code %v", resp.StatusCode), failurePolicy)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
 	if err != nil {
 		return errToFailure(name, fmt.Errorf("ReadAll failed: %v", err), failurePolicy)
 	}
+	if len(data) > maxResponseBytes {
+		return errToFailure(name, fmt.Errorf("response body is larger than %v bytes", maxResponseBytes), failurePolicy)
+	}
 
 	log.V(2).Info(fmt.Sprintf("toFailure: resp.Body = %v", string(data)))
 
@@ -170,8 +382,17 @@ func toFailure(name string, resp *http.Response, httpErr error, failurePolicy ad
 
 	log.V(2).Info(fmt.Sprintf("toFailure: unmarshalled response = %+v\n", responseAdmissionReview))
 
-	if !responseAdmissionReview.Response.Allowed {
-		return fmt.Errorf("proxied webhook %v denied the request: %v", name, responseAdmissionReview.Response.Result.Message)
+	response := responseAdmissionReview.Response
+	if response == nil {
+		return errToFailure(name, errors.New("AdmissionReview has no response"), failurePolicy)
+	}
+
+	if !response.Allowed {
+		result := response.Result
+		if result == nil {
+			result = &metav1.Status{}
+		}
+		return &deniedError{name: name, result: result}
 	}
 
 	log.V(2).Info("toFailure: passed all test")
@@ -179,6 +400,16 @@ func toFailure(name string, resp *http.Response, httpErr error, failurePolicy ad
 	return nil
 }
 
+// deniedError is a proxied webhook's denial of a request, with the status it gave
+type deniedError struct {
+	name   string
+	result *metav1.Status
+}
+
+func (e *deniedError) Error() string {
+	return fmt.Sprintf("proxied webhook %v denied the request: %v", e.name, e.result.Message)
+}
+
 func errToFailure(name string, err error, failurePolicy admregv1.FailurePolicyType) error {
 	switch strings.ToLower(string(failurePolicy)) {
 	case strings.ToLower(string(admregv1.Fail)):
@@ -186,6 +417,18 @@ func errToFailure(name string, err error, failurePolicy admregv1.FailurePolicyTy
 		return fmt.Errorf("proxied webhook %v failed: %v", name, err)
 	default:
 		log.V(1).Info(fmt.Sprintf("err = %v and FailurePolicy == Ignore", err))
-		return nil
+		return &ignoredError{name: name, err: err}
 	}
 }
+
+// recovered answers a request the proxy panicked on according to failurePolicy, denying it unless the policy is Ignore
+func recovered(err error, failurePolicy admregv1.FailurePolicyType) *admv1.AdmissionResponse {
+	if strings.EqualFold(string(failurePolicy), string(admregv1.Ignore)) {
+		return &admv1.AdmissionResponse{
+			Allowed:  true,
+			Warnings: []string{"gesher failed to review the request and allowed it: " + err.Error()},
+		}
+	}
+
+	return errToAdmissionResponse(err)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission_proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+	"github.com/redislabs/gesher/pkg/controller/webhookquota"
+)
+
+// fakeWebhooks replaces the calls of webhooks, denying requests for those listed, and returns the webhooks called
+func fakeWebhooks(t *testing.T, denying ...string) func() []string {
+	var lock sync.Mutex
+	var called []string
+
+	f := callWebhook
+	t.Cleanup(func() { callWebhook = f })
+
+	callWebhook = func(call webhookCall, r *http.Request) error {
+		name := call.webhook.RuleName + "/" + call.webhook.Name
+		lock.Lock()
+		called = append(called, name)
+		lock.Unlock()
+
+		for _, d := range denying {
+			if d == name {
+				return &deniedError{name: name, result: &metav1.Status{}}
+			}
+		}
+		return nil
+	}
+
+	return func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), called...)
+	}
+}
+
+func testWebhook(rule, name string, evaluation v1alpha1.EvaluationMode) namespacedvalidatingrule.WebhookConfig {
+	return namespacedvalidatingrule.WebhookConfig{RuleName: rule, Name: name, Evaluation: evaluation}
+}
+
+func TestCheckWebhooksSequential(t *testing.T) {
+	called := fakeWebhooks(t, "a/first", "b/parallel")
+	webhooks := []namespacedvalidatingrule.WebhookConfig{
+		testWebhook("a", "first", v1alpha1.EvaluationSequential),
+		testWebhook("b", "parallel", v1alpha1.EvaluationParallel),
+		testWebhook("a", "second", v1alpha1.EvaluationSequential),
+		testWebhook("c", "other", v1alpha1.EvaluationSequential),
+	}
+	request := &admv1.AdmissionRequest{UID: "uid", Namespace: "test"}
+
+	response := checkWebhooks(webhooks, request, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.False(t, response.Allowed)
+	assert.Equal(t, "proxied webhook a/first denied the request: ", response.Result.Message)
+	assert.ElementsMatch(t, []string{"a/first", "b/parallel", "c/other"}, called())
+}
+
+func TestCheckWebhooksOrder(t *testing.T) {
+	// the first webhook denying the request answers it, whichever returns first
+	for i := 0; i < 20; i++ {
+		fakeWebhooks(t, "a/first", "a/second", "a/third")
+		webhooks := []namespacedvalidatingrule.WebhookConfig{
+			testWebhook("a", "first", ""),
+			testWebhook("a", "second", ""),
+			testWebhook("a", "third", ""),
+		}
+		request := &admv1.AdmissionRequest{UID: "uid", Namespace: "test"}
+
+		response := checkWebhooks(webhooks, request, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+		assert.Equal(t, "proxied webhook a/first denied the request: ", response.Result.Message)
+	}
+
+	called := fakeWebhooks(t)
+	webhooks := []namespacedvalidatingrule.WebhookConfig{
+		testWebhook("a", "first", v1alpha1.EvaluationSequential),
+		testWebhook("a", "second", v1alpha1.EvaluationSequential),
+	}
+	response := checkWebhooks(webhooks, &admv1.AdmissionRequest{Namespace: "test"}, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.True(t, response.Allowed)
+	assert.Equal(t, []string{"a/first", "a/second"}, called())
+}
+
+func TestCheckWebhooksQuota(t *testing.T) {
+	q := webhookquota.QuotaData
+	t.Cleanup(func() { webhookquota.QuotaData = q })
+	webhookquota.QuotaData = q.Update("test", webhookquota.NamespaceQuota{
+		Excess: map[string]string{
+			webhookquota.WebhookKey("a", "ignored"): "more than the 1 webhooks allowed",
+			webhookquota.WebhookKey("a", "failing"): "more than the 1 webhooks allowed",
+		},
+	})
+
+	called := fakeWebhooks(t)
+	ignored := testWebhook("a", "ignored", "")
+	ignored.FailurePolicy = admregv1.Ignore
+	failing := testWebhook("a", "failing", "")
+	failing.FailurePolicy = admregv1.Fail
+	request := &admv1.AdmissionRequest{UID: "uid", Namespace: "test"}
+
+	// webhooks over quota aren't called, those whose failures are ignored being warned of
+	response := checkWebhooks([]namespacedvalidatingrule.WebhookConfig{testWebhook("a", "within", ""), ignored}, request,
+		httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.True(t, response.Allowed)
+	assert.Len(t, response.Warnings, 1)
+	assert.Contains(t, response.Warnings[0], "webhook ignored of rule a")
+	assert.Equal(t, []string{"a/within"}, called())
+
+	response = checkWebhooks([]namespacedvalidatingrule.WebhookConfig{failing}, request, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.False(t, response.Allowed)
+	assert.Empty(t, response.Warnings)
+	assert.Equal(t, []string{"a/within"}, called())
+}
+
+func TestCheckWebhooksPanic(t *testing.T) {
+	f := callWebhook
+	t.Cleanup(func() { callWebhook = f })
+	callWebhook = func(call webhookCall, r *http.Request) error {
+		if call.webhook.Name == "panicking" {
+			panic("boom")
+		}
+		return nil
+	}
+
+	webhooks := []namespacedvalidatingrule.WebhookConfig{
+		testWebhook("a", "allowing", ""),
+		testWebhook("a", "panicking", ""),
+		shadowWebhook("shadow", "panicking"),
+	}
+	request := &admv1.AdmissionRequest{UID: "uid", Namespace: "panic-test"}
+
+	// a webhook panicking fails according to the panic policy, denying the request by default
+	response := checkWebhooks(webhooks, request, httptest.NewRequest("POST", "/proxy", nil), nil, time.Time{})
+	assert.False(t, response.Allowed)
+	assert.Contains(t, response.Result.Message, "panic: boom")
+
+	r := httptest.NewRequest("POST", "/proxy", nil)
+	r = r.WithContext(context.WithValue(r.Context(), panicPolicyKey{}, admregv1.Ignore))
+	response = checkWebhooks(webhooks, request, r, nil, time.Time{})
+	assert.True(t, response.Allowed)
+
+	// and a shadow panicking is a failure of the shadow
+	failed := shadowVerdicts.WithLabelValues("panic-test", "shadow", "panicking", shadowFailed)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(failed) == 2
+	}, time.Second, 10*time.Millisecond)
+}
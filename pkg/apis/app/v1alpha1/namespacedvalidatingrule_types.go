@@ -21,6 +21,43 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// CreatorAnnotation records the user that created the rule, as JSON encoded authentication.k8s.io UserInfo.  Only
+	// users allowed to impersonate a rule's creator may set it on a rule without one.
+	CreatorAnnotation = "gesher.redislabs.com/creator"
+
+	// RuleConditionDegraded is true when a NamespacedValidatingType the rule depended on was force deleted
+	RuleConditionDegraded = "Degraded"
+	// RuleConditionReady is true when the rule is active, fully accepted and all its webhooks are reachable
+	RuleConditionReady = "Ready"
+	// RuleConditionActive is true when at least some of the rule's webhook rules are being proxied
+	RuleConditionActive = "Active"
+	// RuleConditionAccepted is true when every webhook rule is covered by a NamespacedValidatingType
+	RuleConditionAccepted = "Accepted"
+	// RuleConditionReachable is true when every webhook's service, endpoints and CA bundle are usable
+	RuleConditionReachable = "Reachable"
+	// RuleConditionReferencesGranted is true when every cross-namespace service is allowed by a WebhookServiceGrant
+	RuleConditionReferencesGranted = "ReferencesGranted"
+
+	// RuleConditionBypassed is true while an administrator bypasses the rule's webhooks, through the
+	// BypassAnnotation of its namespace or of a type covering it
+	RuleConditionBypassed = "Bypassed"
+
+	// DecisionAnnotation on a Namespace sets the DecisionStrategy combining the votes of the webhooks of its rules
+	// that don't set one.  Requests are decided by AllMustAllow when it is missing or invalid.
+	DecisionAnnotation = "gesher.redislabs.com/decision"
+
+	// ReasonTypeForceDeleted is the Degraded reason used when a type was deleted with ForceDeleteAnnotation
+	ReasonTypeForceDeleted = "TypeForceDeleted"
+	// ReasonNamespaceBypassed is the Bypassed reason used when the rule's namespace has the BypassAnnotation
+	ReasonNamespaceBypassed = "NamespaceBypassed"
+	// ReasonTypeBypassed is the Bypassed reason used when a type covering the rule has the BypassAnnotation
+	ReasonTypeBypassed = "TypeBypassed"
+	// ReasonInvalidBypass is the Bypassed reason used when the BypassAnnotation of the rule's namespace is invalid and
+	// ignored
+	ReasonInvalidBypass = "InvalidBypass"
+)
+
 // Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 // Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
 
@@ -30,12 +67,313 @@ type NamespacedValidatingRuleSpec struct {
 	// +optional
 	// +patchMergeKey=name
 	// +patchStrategy=merge
-	Webhooks []admregv1.ValidatingWebhook `json:"webhooks,omitempty" patchStrategy:"merge" patchMergeKey:"name" protobuf:"bytes,2,rep,name=Webhooks"`
+	Webhooks []NamespacedValidatingWebhook `json:"webhooks,omitempty" patchStrategy:"merge" patchMergeKey:"name" protobuf:"bytes,2,rep,name=Webhooks"`
+
+	// Evaluation is how the rule's webhooks are called for a request, Parallel by default.  Sequential calls them one
+	// after another by order, not calling the rest once the decision is known: once one denies the request with
+	// AllMustAllow, or allows it with AnyAllows.
+	// +optional
+	Evaluation EvaluationMode `json:"evaluation,omitempty"`
+
+	// Decision is how the votes of the rule's webhooks are combined into the rule's answer to a request.  When it
+	// is unset, the webhooks vote along with those of the namespace's other rules not setting it, by the strategy
+	// of the namespace's DecisionAnnotation.
+	// +optional
+	Decision DecisionStrategy `json:"decision,omitempty"`
+}
+
+// DecisionStrategy is how the votes of webhooks are combined into an answer to a request.  Webhooks failing with the
+// Fail failure policy vote to deny it, while those failing with Ignore abstain.  Requests no webhook votes on are
+// allowed.
+type DecisionStrategy string
+
+const (
+	// DecisionAllMustAllow denies requests any webhook denies
+	DecisionAllMustAllow DecisionStrategy = "AllMustAllow"
+	// DecisionAnyAllows allows requests any webhook allows
+	DecisionAnyAllows DecisionStrategy = "AnyAllows"
+	// DecisionMajority allows requests more webhooks allow than deny
+	DecisionMajority DecisionStrategy = "Majority"
+)
+
+// EvaluationMode is how the webhooks of a rule matching a request are called
+type EvaluationMode string
+
+const (
+	// EvaluationParallel calls all the webhooks at once
+	EvaluationParallel EvaluationMode = "Parallel"
+	// EvaluationSequential calls the webhooks one after another, stopping once the decision is known
+	EvaluationSequential EvaluationMode = "Sequential"
+)
+
+// NamespacedValidatingWebhook is a validating webhook, along with what gesher matches requests on before proxying them
+type NamespacedValidatingWebhook struct {
+	admregv1.ValidatingWebhook `json:",inline"`
+
+	// UserInfo limits the webhook to requests by the matching users
+	// +optional
+	UserInfo *UserInfoMatch `json:"userInfo,omitempty"`
+
+	// ResourceNames limits the webhook to objects whose name matches one of the globs, as UserInfoSubjects' do.
+	// Objects created with generateName are matched on it instead.  All objects match when it is empty.
+	// +optional
+	ResourceNames []string `json:"resourceNames,omitempty"`
+
+	// UpdateFilter limits the webhook to UPDATE requests changing the selected fields.  Updates changing nothing but
+	// metadata.managedFields and metadata.resourceVersion are never sent, whether it is set or not.
+	// +optional
+	UpdateFilter *UpdateFilter `json:"updateFilter,omitempty"`
+
+	// NamespaceMetadata adds the name, UID, labels and annotations of the request's namespace to the AdmissionReview
+	// sent to the webhook, under its "gesher" field.  The review's own fields are left as they are.
+	// +optional
+	NamespaceMetadata *NamespaceMetadataSelection `json:"namespaceMetadata,omitempty"`
+
+	// Projection limits the object and old object sent to the webhook to the fields at the listed dot-separated
+	// paths, e.g. "spec" or "metadata.labels".  The redactions of the types covering the request still apply.
+	// +optional
+	Projection []string `json:"projection,omitempty"`
+
+	// Order places the webhook among those called for a request, lower orders first and ties broken by rule and
+	// webhook name.  Requests denied by several webhooks are answered with the denial of the first.
+	// +optional
+	Order int32 `json:"order,omitempty"`
+
+	// RequireMutualTLS fails calls to the webhook when gesher has no client certificate to present, rather than
+	// making them without one.  The webhook server verifies it against the rule's status.clientCABundle.
+	// +optional
+	RequireMutualTLS bool `json:"requireMutualTLS,omitempty"`
+
+	// Retry retries calls of the webhook failing transiently, calls are made once when it is unset
+	// +optional
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// Failover lists alternative targets for the webhook, tried in order when the proxy fails to connect to the
+	// one before them.  The proxy keeps calling the last target it reached, starting over from the clientConfig only
+	// once that one fails.  A target that is slow to answer isn't failed over from, it gets the whole timeout.
+	// +optional
+	Failover []admregv1.WebhookClientConfig `json:"failover,omitempty"`
+
+	// Backends split the requests sent to the webhook between its clientConfig and other versions of it, each
+	// backend receiving the percentage of requests its weight sets and the clientConfig the rest.  The same object,
+	// by UID or else by name, is always sent to the same backend for its verdicts to be consistent.  The failover
+	// targets are tried after the backend a request is sent to.
+	// +optional
+	Backends []WeightedBackend `json:"backends,omitempty"`
+
+	// Shadow has the proxy call the webhook alongside the others without waiting for it, its verdict having no
+	// say in the answer to the request.  How its verdicts compare with those enforced is reported in the rule's
+	// status, with an event whenever it disagrees.
+	// +optional
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// WeightedBackend is a version of a webhook receiving a share of its requests
+type WeightedBackend struct {
+	// Name identifies the backend in the proxy's metrics, in which the webhook's clientConfig is "clientConfig"
+	Name string `json:"name"`
+
+	// Weight is the percentage of the webhook's requests sent to the backend, between 0 and 100
+	Weight int32 `json:"weight"`
+
+	// ClientConfig defines how to communicate with the backend
+	ClientConfig admregv1.WebhookClientConfig `json:"clientConfig"`
+}
+
+// RetryPolicy retries the calls of a webhook that fail to connect or are answered with a 5xx status.  Calls the
+// webhook answers, allowing or denying the request, are never retried, nor are calls once the webhook's timeout or
+// the API server's deadline leaves no time for them.  Retries and hedged attempts are reported by the proxy's metrics
+// and logs, and webhooks see them in the X-Gesher-Attempt and X-Gesher-Hedged headers.  The proxy has no tracing, so
+// they don't show in traces.
+type RetryPolicy struct {
+	// MaxAttempts is the most times the webhook is called for a request, 1 by default
+	// +optional
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+
+	// BackoffMilliseconds is how long the first retry waits, doubling for each retry after it, 100 by default
+	// +optional
+	BackoffMilliseconds int32 `json:"backoffMilliseconds,omitempty"`
+
+	// HedgeAfterMilliseconds sends an attempt not answered by then a second time, over a new connection to the
+	// webhook's service which may balance it to another endpoint.  The first answer is used.
+	// +optional
+	HedgeAfterMilliseconds *int32 `json:"hedgeAfterMilliseconds,omitempty"`
+}
+
+// NamespaceMetadataSelection selects the labels and annotations of a namespace sent to a webhook, by globs matched
+// against their keys as UserInfoSubjects' are
+type NamespaceMetadataSelection struct {
+	// Labels limits the labels sent to those matching any of the globs, all of them are sent when unset
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+
+	// Annotations limits the annotations sent to those matching any of the globs, all of them are sent when unset
+	// +optional
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// UpdateFilter selects the fields whose changes an UPDATE request is sent to a webhook for.  Fields are written as
+// dot-separated paths into the object, e.g. "spec" or "metadata.labels".
+type UpdateFilter struct {
+	// Watch limits the webhook to updates changing any of the listed fields
+	// +optional
+	Watch []string `json:"watch,omitempty"`
+
+	// Ignore leaves out updates changing nothing but the listed fields.  It cannot be set along with Watch.
+	// +optional
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// UserInfoMatch matches admission requests on the user making them.  A request matches when it is included, and not
+// excluded.
+type UserInfoMatch struct {
+	// Include limits the match to requests by the listed users, all of them are included when unset
+	// +optional
+	Include *UserInfoSubjects `json:"include,omitempty"`
+
+	// Exclude leaves out requests by the listed users, even included ones
+	// +optional
+	Exclude *UserInfoSubjects `json:"exclude,omitempty"`
+}
+
+// UserInfoSubjects lists users as globs, a request's user being listed when any of them matches.  "*" matches any
+// sequence of characters but "/", "?" any single one.
+type UserInfoSubjects struct {
+	// Usernames are matched against the requesting user's name
+	// +optional
+	Usernames []string `json:"usernames,omitempty"`
+
+	// Groups are matched against each of the requesting user's groups
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+
+	// ServiceAccounts are matched, as namespace/name, against the service account making the request
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
 }
 
 // NamespacedValidatingRuleStatus defines the observed state of NamespacedValidatingRule
 type NamespacedValidatingRuleStatus struct {
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the current state of the rule
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Webhooks is the observed state of each of the rule's webhooks
+	// +optional
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=name
+	Webhooks []WebhookStatus `json:"webhooks,omitempty" patchStrategy:"merge" patchMergeKey:"name"`
+
+	// ClientCABundle is the PEM encoded CA bundle the client certificate gesher presents to the rule's webhooks is
+	// issued from, for their servers to verify it with.  It stays the same when the certificate is rotated, until the
+	// CA itself nears expiry.
+	// +optional
+	ClientCABundle []byte `json:"clientCABundle,omitempty"`
+}
+
+// WebhookStatus is the observed state of a single webhook of a NamespacedValidatingRule
+type WebhookStatus struct {
+	// Name of the webhook
+	Name string `json:"name"`
+
+	// AcceptedRules are the rules covered by a NamespacedValidatingType, and therefore proxied.  A rule's wildcards are
+	// narrowed to what the types cover.
+	// +optional
+	AcceptedRules []admregv1.RuleWithOperations `json:"acceptedRules,omitempty"`
+
+	// RejectedRules are the rules no NamespacedValidatingType covers, which are never proxied
+	// +optional
+	RejectedRules []admregv1.RuleWithOperations `json:"rejectedRules,omitempty"`
+
+	// DeniedRules are covered by NamespacedValidatingTypes, none of which permit the rule's namespace, and therefore
+	// never proxied
+	// +optional
+	DeniedRules []admregv1.RuleWithOperations `json:"deniedRules,omitempty"`
+
+	// UnauthorizedRules are covered only by NamespacedValidatingTypes the rule's creator may not use, and therefore
+	// never proxied
+	// +optional
+	UnauthorizedRules []admregv1.RuleWithOperations `json:"unauthorizedRules,omitempty"`
+
+	// EffectiveFailurePolicy is the failure policy the webhook is called with, once the limits of the types covering
+	// its accepted rules apply.  It is Ignore only when all of them force Ignore.
+	// +optional
+	EffectiveFailurePolicy admregv1.FailurePolicyType `json:"effectiveFailurePolicy,omitempty"`
+
+	// EffectiveTimeoutSeconds is the longest timeout the webhook is called with, once the limits of the types
+	// covering its accepted rules apply
+	// +optional
+	EffectiveTimeoutSeconds int32 `json:"effectiveTimeoutSeconds,omitempty"`
+
+	// IgnoredRules are the accepted rules for which the types' limits force the Ignore failure policy on a webhook
+	// asking for Fail
+	// +optional
+	IgnoredRules []admregv1.RuleWithOperations `json:"ignoredRules,omitempty"`
+
+	// ReferenceDenied is true if the webhook's service is in another namespace and no WebhookServiceGrant allows it.
+	// Such webhooks are never proxied.
+	// +optional
+	ReferenceDenied bool `json:"referenceDenied,omitempty"`
+
+	// DeniedTargets are the failover targets and backends of the webhook, as failover[i] and backends[i], whose
+	// services are in other namespaces that no WebhookServiceGrant allows.  Such backends are left out, their share
+	// of requests going to the webhook's clientConfig, and such failover targets are skipped.
+	// +optional
+	DeniedTargets []string `json:"deniedTargets,omitempty"`
+
+	// ServiceFound is true if the webhook's service exists
+	ServiceFound bool `json:"serviceFound"`
+
+	// ReadyEndpoints is the number of ready addresses behind the webhook's service
+	ReadyEndpoints int32 `json:"readyEndpoints"`
+
+	// CABundleValid is true if the webhook's CA bundle contains at least one parsable certificate
+	CABundleValid bool `json:"caBundleValid"`
+
+	// CABundleExpiry is when the first certificate in the CA bundle expires
+	// +optional
+	CABundleExpiry *metav1.Time `json:"caBundleExpiry,omitempty"`
+
+	// ActiveTarget is the target the proxy last reached a webhook with failover targets at, "clientConfig" or
+	// "failover[i]"
+	// +optional
+	ActiveTarget string `json:"activeTarget,omitempty"`
+
+	// Shadow compares the verdicts of a shadow webhook with those enforced
+	// +optional
+	Shadow *ShadowStatus `json:"shadow,omitempty"`
+
+	// Message explains any problem found with the webhook
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ShadowStatus compares the verdicts of a shadow webhook with those enforced, since the proxy started
+type ShadowStatus struct {
+	// Agreements is the number of requests the webhook decided as they were
+	Agreements int64 `json:"agreements"`
+
+	// Disagreements is the number of requests the webhook decided otherwise
+	Disagreements int64 `json:"disagreements"`
+
+	// Failures is the number of requests the webhook failed to decide
+	Failures int64 `json:"failures"`
+
+	// LastDisagreementTime is when the webhook last disagreed
+	// +optional
+	LastDisagreementTime *metav1.Time `json:"lastDisagreementTime,omitempty"`
+
+	// LastDisagreement describes the request the webhook last disagreed on
+	// +optional
+	LastDisagreement string `json:"lastDisagreement,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
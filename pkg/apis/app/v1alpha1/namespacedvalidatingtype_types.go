@@ -21,6 +21,30 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ForceDeleteAnnotation when set to "true" on a NamespacedValidatingType being deleted, lets the deletion
+	// proceed even though NamespacedValidatingRules still depend on it.  The affected rules are marked as degraded.
+	ForceDeleteAnnotation = "gesher.redislabs.com/force-delete"
+
+	// BypassAnnotation on a Namespace or a NamespacedValidatingType makes gesher approve every request proxied for
+	// it without calling any webhook.  A type's bypass applies in a namespace only when every type proxying the request
+	// that permits the namespace is bypassed.  Its value is "true", or the RFC 3339 time the bypass expires at.  It is
+	// meant for administrators, which only holds as long as tenants can't annotate their namespaces.
+	BypassAnnotation = "gesher.redislabs.com/bypass"
+
+	// UseVerb is the verb a NamespacedValidatingRule's creator has to hold on a type with RequireUsePermission set
+	UseVerb = "use"
+
+	// TypeConditionDeletionBlocked is true while the type's deletion waits on the rules that depend on it
+	TypeConditionDeletionBlocked = "DeletionBlocked"
+	// TypeConditionReady is true when the type's current generation is applied and it isn't being deleted
+	TypeConditionReady = "Ready"
+	// TypeConditionApplied is true when the type's rules are part of the cluster's proxy webhook
+	TypeConditionApplied = "Applied"
+	// TypeConditionConflicting is true when another type proxies some of the same resources and operations
+	TypeConditionConflicting = "Conflicting"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -31,6 +55,73 @@ type NamespacedValidatingTypeSpec struct {
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
 
 	Types []admissionv1.RuleWithOperations `json:"types,omitempty" protobuf:"bytes,3,rep,name=types"`
+
+	// NamespaceSelector limits the type to namespaces whose labels match it.
+	// A namespace in AllowedNamespaces is permitted even if it doesn't match.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// AllowedNamespaces limits the type to the listed namespaces, and those matching NamespaceSelector.
+	// The type is open to every namespace when neither is set.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// DeniedNamespaces can never use the type, whether they are allowed or selected
+	// +optional
+	DeniedNamespaces []string `json:"deniedNamespaces,omitempty"`
+
+	// RequireUsePermission limits the type to rules whose creator holds the "use" verb on it
+	// +optional
+	RequireUsePermission bool `json:"requireUsePermission,omitempty"`
+
+	// WebhookLimits caps the failure policy and timeout of the rules' webhooks proxied for the type's resources
+	// +optional
+	WebhookLimits *WebhookLimits `json:"webhookLimits,omitempty"`
+
+	// UserInfo exempts requests by users it doesn't match from the rules' webhooks proxied for the type's resources
+	// +optional
+	UserInfo *UserInfoMatch `json:"userInfo,omitempty"`
+
+	// Redactions hide fields of the objects sent to the rules' webhooks proxied for the type's resources
+	// +optional
+	Redactions []Redaction `json:"redactions,omitempty"`
+}
+
+// RedactionMode is how a redacted field is hidden from webhooks
+type RedactionMode string
+
+const (
+	// RedactionRemove removes the field
+	RedactionRemove RedactionMode = "Remove"
+	// RedactionHash replaces every value within the field by its SHA-256 hash, so webhooks can still compare them
+	RedactionHash RedactionMode = "Hash"
+)
+
+// Redaction hides a field of the object and old object of the requests sent to webhooks
+type Redaction struct {
+	// Path is the dot-separated path of the field, e.g. "data" or "metadata.annotations"
+	Path string `json:"path"`
+
+	// Mode is how the field is hidden, Remove by default
+	// +optional
+	Mode RedactionMode `json:"mode,omitempty"`
+}
+
+// WebhookLimits are the most a NamespacedValidatingRule's webhooks may ask for.  Webhooks asking for more are clamped
+// to them.  When several types cover a resource, the strictest of their limits applies.
+type WebhookLimits struct {
+	// MaxFailurePolicy is the strictest failure policy webhooks may use.  With Ignore, a failing webhook never
+	// blocks a request.
+	// +optional
+	MaxFailurePolicy *admissionv1.FailurePolicyType `json:"maxFailurePolicy,omitempty"`
+
+	// MaxTimeoutSeconds is the longest timeout webhooks may use
+	// +optional
+	MaxTimeoutSeconds *int32 `json:"maxTimeoutSeconds,omitempty"`
+
+	// IgnoreOperations are the operations for which webhooks always use the Ignore failure policy
+	// +optional
+	IgnoreOperations []admissionv1.OperationType `json:"ignoreOperations,omitempty"`
 }
 
 // NamespacedValidatingTypeStatus defines the observed state of NamespacedValidatingType
@@ -40,6 +131,28 @@ type NamespacedValidatingTypeStatus struct {
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
 
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the current state of the type, e.g. whether its deletion is blocked
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// EffectiveRules are the rules this type contributes to the cluster's proxy webhook
+	// +optional
+	EffectiveRules []admissionv1.RuleWithOperations `json:"effectiveRules,omitempty"`
+
+	// ConsumingNamespaces is the number of namespaces with rules that use this type
+	ConsumingNamespaces int32 `json:"consumingNamespaces,omitempty"`
+
+	// ConsumingRules is the number of NamespacedValidatingRules that use this type
+	ConsumingRules int32 `json:"consumingRules,omitempty"`
+
+	// LastWebhookSyncTime is the last time the cluster's proxy webhook was updated with this type's rules
+	// +optional
+	LastWebhookSyncTime *metav1.Time `json:"lastWebhookSyncTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookQuotaSpec limits the webhooks the NamespacedValidatingRules in the quota's namespace may register.
+// Unset limits aren't enforced.  When a namespace has several quotas, the strictest of each limit applies.
+// Shadow webhooks count towards MaxWebhooks and MaxFanOut, but not towards MaxTimeoutSeconds.
+type WebhookQuotaSpec struct {
+	// MaxWebhooks is the most webhooks the namespace's rules may hold
+	// +optional
+	MaxWebhooks *int32 `json:"maxWebhooks,omitempty"`
+
+	// MaxTimeoutSeconds is the most the timeouts of the namespace's webhooks may add up to, each timeout as limited by
+	// the WebhookLimits of the NamespacedValidatingTypes
+	// +optional
+	MaxTimeoutSeconds *int32 `json:"maxTimeoutSeconds,omitempty"`
+
+	// MaxFanOut is the most webhooks a single admission request may be proxied to
+	// +optional
+	MaxFanOut *int32 `json:"maxFanOut,omitempty"`
+}
+
+// WebhookQuotaUsage is what the namespace's rules use of a quota
+type WebhookQuotaUsage struct {
+	Webhooks       int32 `json:"webhooks"`
+	TimeoutSeconds int32 `json:"timeoutSeconds"`
+}
+
+// WebhookQuotaStatus defines the observed state of WebhookQuota
+type WebhookQuotaStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Used is the total of all the webhooks registered in the namespace, including those over quota
+	Used WebhookQuotaUsage `json:"used"`
+
+	// Excess lists the webhooks, as rule/webhook, that are over quota and therefore never called.
+	// They are treated as failing, according to their failure policy, and responses warn of those ignored.
+	// +optional
+	Excess []string `json:"excess,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookQuota is the Schema for the webhookquotas API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=webhookquota,scope=Namespaced
+type WebhookQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WebhookQuotaSpec   `json:"spec,omitempty"`
+	Status WebhookQuotaStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookQuotaList contains a list of WebhookQuota
+type WebhookQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WebhookQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WebhookQuota{}, &WebhookQuotaList{})
+}
+
+func (q *WebhookQuota) GetObservedGeneration() int64 {
+	return q.Status.ObservedGeneration
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookServiceGrantSpec defines which namespaces may send proxied admission requests to services in the grant's namespace
+type WebhookServiceGrantSpec struct {
+	// From lists the namespaces whose NamespacedValidatingRules may point webhooks at this namespace
+	From []WebhookServiceGrantFrom `json:"from"`
+
+	// To lists the services in this namespace that may be targeted.  All services may be targeted when empty.
+	// +optional
+	To []WebhookServiceGrantTo `json:"to,omitempty"`
+}
+
+// WebhookServiceGrantFrom names a namespace allowed to reference services in the grant's namespace
+type WebhookServiceGrantFrom struct {
+	Namespace string `json:"namespace"`
+}
+
+// WebhookServiceGrantTo names a service in the grant's namespace that may be referenced
+type WebhookServiceGrantTo struct {
+	Name string `json:"name"`
+}
+
+// WebhookServiceGrantStatus defines the observed state of WebhookServiceGrant
+type WebhookServiceGrantStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookServiceGrant is the Schema for the webhookservicegrants API.  A NamespacedValidatingRule may only point
+// a webhook at a service in another namespace if a grant in that namespace allows it.
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=webhookservicegrant,scope=Namespaced
+type WebhookServiceGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WebhookServiceGrantSpec   `json:"spec,omitempty"`
+	Status WebhookServiceGrantStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WebhookServiceGrantList contains a list of WebhookServiceGrant
+type WebhookServiceGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WebhookServiceGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WebhookServiceGrant{}, &WebhookServiceGrantList{})
+}
+
+func (g *WebhookServiceGrant) GetObservedGeneration() int64 {
+	return g.Status.ObservedGeneration
+}
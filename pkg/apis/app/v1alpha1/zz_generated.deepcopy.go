@@ -6,16 +6,43 @@ package v1alpha1
 
 import (
 	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceMetadataSelection) DeepCopyInto(out *NamespaceMetadataSelection) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceMetadataSelection.
+func (in *NamespaceMetadataSelection) DeepCopy() *NamespaceMetadataSelection {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceMetadataSelection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespacedValidatingRule) DeepCopyInto(out *NamespacedValidatingRule) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -75,7 +102,7 @@ func (in *NamespacedValidatingRuleSpec) DeepCopyInto(out *NamespacedValidatingRu
 	*out = *in
 	if in.Webhooks != nil {
 		in, out := &in.Webhooks, &out.Webhooks
-		*out = make([]admregv1.ValidatingWebhook, len(*in))
+		*out = make([]NamespacedValidatingWebhook, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -96,6 +123,25 @@ func (in *NamespacedValidatingRuleSpec) DeepCopy() *NamespacedValidatingRuleSpec
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespacedValidatingRuleStatus) DeepCopyInto(out *NamespacedValidatingRuleStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Webhooks != nil {
+		in, out := &in.Webhooks, &out.Webhooks
+		*out = make([]WebhookStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ClientCABundle != nil {
+		in, out := &in.ClientCABundle, &out.ClientCABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -115,7 +161,7 @@ func (in *NamespacedValidatingType) DeepCopyInto(out *NamespacedValidatingType)
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -180,6 +226,36 @@ func (in *NamespacedValidatingTypeSpec) DeepCopyInto(out *NamespacedValidatingTy
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedNamespaces != nil {
+		in, out := &in.DeniedNamespaces, &out.DeniedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.WebhookLimits != nil {
+		in, out := &in.WebhookLimits, &out.WebhookLimits
+		*out = new(WebhookLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UserInfo != nil {
+		in, out := &in.UserInfo, &out.UserInfo
+		*out = new(UserInfoMatch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Redactions != nil {
+		in, out := &in.Redactions, &out.Redactions
+		*out = make([]Redaction, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -196,6 +272,24 @@ func (in *NamespacedValidatingTypeSpec) DeepCopy() *NamespacedValidatingTypeSpec
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespacedValidatingTypeStatus) DeepCopyInto(out *NamespacedValidatingTypeStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EffectiveRules != nil {
+		in, out := &in.EffectiveRules, &out.EffectiveRules
+		*out = make([]admregv1.RuleWithOperations, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastWebhookSyncTime != nil {
+		in, out := &in.LastWebhookSyncTime, &out.LastWebhookSyncTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -208,3 +302,582 @@ func (in *NamespacedValidatingTypeStatus) DeepCopy() *NamespacedValidatingTypeSt
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedValidatingWebhook) DeepCopyInto(out *NamespacedValidatingWebhook) {
+	*out = *in
+	in.ValidatingWebhook.DeepCopyInto(&out.ValidatingWebhook)
+	if in.UserInfo != nil {
+		in, out := &in.UserInfo, &out.UserInfo
+		*out = new(UserInfoMatch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceNames != nil {
+		in, out := &in.ResourceNames, &out.ResourceNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UpdateFilter != nil {
+		in, out := &in.UpdateFilter, &out.UpdateFilter
+		*out = new(UpdateFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NamespaceMetadata != nil {
+		in, out := &in.NamespaceMetadata, &out.NamespaceMetadata
+		*out = new(NamespaceMetadataSelection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Projection != nil {
+		in, out := &in.Projection, &out.Projection
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Retry != nil {
+		in, out := &in.Retry, &out.Retry
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Failover != nil {
+		in, out := &in.Failover, &out.Failover
+		*out = make([]admregv1.WebhookClientConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Backends != nil {
+		in, out := &in.Backends, &out.Backends
+		*out = make([]WeightedBackend, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedValidatingWebhook.
+func (in *NamespacedValidatingWebhook) DeepCopy() *NamespacedValidatingWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedValidatingWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Redaction) DeepCopyInto(out *Redaction) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Redaction.
+func (in *Redaction) DeepCopy() *Redaction {
+	if in == nil {
+		return nil
+	}
+	out := new(Redaction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.HedgeAfterMilliseconds != nil {
+		in, out := &in.HedgeAfterMilliseconds, &out.HedgeAfterMilliseconds
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShadowStatus) DeepCopyInto(out *ShadowStatus) {
+	*out = *in
+	if in.LastDisagreementTime != nil {
+		in, out := &in.LastDisagreementTime, &out.LastDisagreementTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShadowStatus.
+func (in *ShadowStatus) DeepCopy() *ShadowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ShadowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpdateFilter) DeepCopyInto(out *UpdateFilter) {
+	*out = *in
+	if in.Watch != nil {
+		in, out := &in.Watch, &out.Watch
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Ignore != nil {
+		in, out := &in.Ignore, &out.Ignore
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpdateFilter.
+func (in *UpdateFilter) DeepCopy() *UpdateFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(UpdateFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserInfoMatch) DeepCopyInto(out *UserInfoMatch) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = new(UserInfoSubjects)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = new(UserInfoSubjects)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserInfoMatch.
+func (in *UserInfoMatch) DeepCopy() *UserInfoMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(UserInfoMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserInfoSubjects) DeepCopyInto(out *UserInfoSubjects) {
+	*out = *in
+	if in.Usernames != nil {
+		in, out := &in.Usernames, &out.Usernames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserInfoSubjects.
+func (in *UserInfoSubjects) DeepCopy() *UserInfoSubjects {
+	if in == nil {
+		return nil
+	}
+	out := new(UserInfoSubjects)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookLimits) DeepCopyInto(out *WebhookLimits) {
+	*out = *in
+	if in.MaxFailurePolicy != nil {
+		in, out := &in.MaxFailurePolicy, &out.MaxFailurePolicy
+		*out = new(admregv1.FailurePolicyType)
+		**out = **in
+	}
+	if in.MaxTimeoutSeconds != nil {
+		in, out := &in.MaxTimeoutSeconds, &out.MaxTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.IgnoreOperations != nil {
+		in, out := &in.IgnoreOperations, &out.IgnoreOperations
+		*out = make([]admregv1.OperationType, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookLimits.
+func (in *WebhookLimits) DeepCopy() *WebhookLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookQuota) DeepCopyInto(out *WebhookQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookQuota.
+func (in *WebhookQuota) DeepCopy() *WebhookQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WebhookQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookQuotaList) DeepCopyInto(out *WebhookQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WebhookQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookQuotaList.
+func (in *WebhookQuotaList) DeepCopy() *WebhookQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WebhookQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookQuotaSpec) DeepCopyInto(out *WebhookQuotaSpec) {
+	*out = *in
+	if in.MaxWebhooks != nil {
+		in, out := &in.MaxWebhooks, &out.MaxWebhooks
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxTimeoutSeconds != nil {
+		in, out := &in.MaxTimeoutSeconds, &out.MaxTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxFanOut != nil {
+		in, out := &in.MaxFanOut, &out.MaxFanOut
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookQuotaSpec.
+func (in *WebhookQuotaSpec) DeepCopy() *WebhookQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookQuotaStatus) DeepCopyInto(out *WebhookQuotaStatus) {
+	*out = *in
+	out.Used = in.Used
+	if in.Excess != nil {
+		in, out := &in.Excess, &out.Excess
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookQuotaStatus.
+func (in *WebhookQuotaStatus) DeepCopy() *WebhookQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookQuotaUsage) DeepCopyInto(out *WebhookQuotaUsage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookQuotaUsage.
+func (in *WebhookQuotaUsage) DeepCopy() *WebhookQuotaUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookQuotaUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookServiceGrant) DeepCopyInto(out *WebhookServiceGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookServiceGrant.
+func (in *WebhookServiceGrant) DeepCopy() *WebhookServiceGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookServiceGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WebhookServiceGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookServiceGrantFrom) DeepCopyInto(out *WebhookServiceGrantFrom) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookServiceGrantFrom.
+func (in *WebhookServiceGrantFrom) DeepCopy() *WebhookServiceGrantFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookServiceGrantFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookServiceGrantList) DeepCopyInto(out *WebhookServiceGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WebhookServiceGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookServiceGrantList.
+func (in *WebhookServiceGrantList) DeepCopy() *WebhookServiceGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookServiceGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WebhookServiceGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookServiceGrantSpec) DeepCopyInto(out *WebhookServiceGrantSpec) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]WebhookServiceGrantFrom, len(*in))
+		copy(*out, *in)
+	}
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]WebhookServiceGrantTo, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookServiceGrantSpec.
+func (in *WebhookServiceGrantSpec) DeepCopy() *WebhookServiceGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookServiceGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookServiceGrantStatus) DeepCopyInto(out *WebhookServiceGrantStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookServiceGrantStatus.
+func (in *WebhookServiceGrantStatus) DeepCopy() *WebhookServiceGrantStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookServiceGrantStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookServiceGrantTo) DeepCopyInto(out *WebhookServiceGrantTo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookServiceGrantTo.
+func (in *WebhookServiceGrantTo) DeepCopy() *WebhookServiceGrantTo {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookServiceGrantTo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookStatus) DeepCopyInto(out *WebhookStatus) {
+	*out = *in
+	if in.AcceptedRules != nil {
+		in, out := &in.AcceptedRules, &out.AcceptedRules
+		*out = make([]admregv1.RuleWithOperations, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RejectedRules != nil {
+		in, out := &in.RejectedRules, &out.RejectedRules
+		*out = make([]admregv1.RuleWithOperations, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeniedRules != nil {
+		in, out := &in.DeniedRules, &out.DeniedRules
+		*out = make([]admregv1.RuleWithOperations, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.UnauthorizedRules != nil {
+		in, out := &in.UnauthorizedRules, &out.UnauthorizedRules
+		*out = make([]admregv1.RuleWithOperations, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IgnoredRules != nil {
+		in, out := &in.IgnoredRules, &out.IgnoredRules
+		*out = make([]admregv1.RuleWithOperations, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeniedTargets != nil {
+		in, out := &in.DeniedTargets, &out.DeniedTargets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CABundleExpiry != nil {
+		in, out := &in.CABundleExpiry, &out.CABundleExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.Shadow != nil {
+		in, out := &in.Shadow, &out.Shadow
+		*out = new(ShadowStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookStatus.
+func (in *WebhookStatus) DeepCopy() *WebhookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WeightedBackend) DeepCopyInto(out *WeightedBackend) {
+	*out = *in
+	in.ClientConfig.DeepCopyInto(&out.ClientConfig)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WeightedBackend.
+func (in *WeightedBackend) DeepCopy() *WeightedBackend {
+	if in == nil {
+		return nil
+	}
+	out := new(WeightedBackend)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bypass
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+// Bypass is an administrator's request, through v1alpha1.BypassAnnotation, that gesher approve every request proxied
+// for a namespace or a type without calling any webhook
+type Bypass struct {
+	// Until is when the bypass expires, it never does when nil
+	Until *time.Time
+}
+
+// Parse returns the bypass requested by annotations, nil if none is.  The annotation is either "true", for a bypass
+// lasting until it is removed, or the RFC 3339 time the bypass expires at.
+func Parse(annotations map[string]string) (*Bypass, error) {
+	value, ok := annotations[v1alpha1.BypassAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "true") {
+		return &Bypass{}, nil
+	}
+
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%v must be \"true\" or an RFC 3339 time: %v", v1alpha1.BypassAnnotation, err)
+	}
+
+	return &Bypass{Until: &until}, nil
+}
+
+// Active returns true if b is in effect at now
+func (b *Bypass) Active(now time.Time) bool {
+	return b != nil && (b.Until == nil || now.Before(*b.Until))
+}
+
+// String describes b for events, conditions and audit annotations
+func (b *Bypass) String() string {
+	if b.Until == nil {
+		return "until removed"
+	}
+
+	return "until " + b.Until.UTC().Format(time.RFC3339)
+}
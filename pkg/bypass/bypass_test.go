@@ -0,0 +1,49 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bypass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+func TestParse(t *testing.T) {
+	b, err := Parse(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+	assert.False(t, b.Active(time.Now()))
+
+	b, err = Parse(map[string]string{v1alpha1.BypassAnnotation: "true"})
+	assert.Nil(t, err)
+	assert.True(t, b.Active(time.Now()))
+	assert.Equal(t, "until removed", b.String())
+
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	b, err = Parse(map[string]string{v1alpha1.BypassAnnotation: until.Format(time.RFC3339)})
+	assert.Nil(t, err)
+	assert.True(t, b.Active(until.Add(-time.Second)))
+	assert.False(t, b.Active(until))
+	assert.Equal(t, "until 2030-01-02T03:04:05Z", b.String())
+
+	b, err = Parse(map[string]string{v1alpha1.BypassAnnotation: "1h"})
+	assert.NotNil(t, err)
+	assert.Nil(t, b)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package clientauth lets namespaced webhooks verify that the calls they get come from gesher, which presents a
+// client certificate issued from its own CA and carrying a SPIFFE-like URI identity
+package clientauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// TrustDomain is the host of the URI identities gesher's client certificates carry
+	TrustDomain = "gesher.redislabs.com"
+
+	identityScheme = "spiffe"
+)
+
+// Identity returns the identity of the gesher deployed as service in namespace
+func Identity(namespace, service string) *url.URL {
+	return &url.URL{Scheme: identityScheme, Host: TrustDomain, Path: fmt.Sprintf("/ns/%v/svc/%v", namespace, service)}
+}
+
+// ServerTLSConfig returns the TLS config of a webhook server that requires callers to present a client certificate
+// issued from caBundle, the clientCABundle in the status of a NamespacedValidatingRule.  The server's own certificate
+// is left for the caller to set.
+func ServerTLSConfig(caBundle []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, errors.New("no certificate found in the CA bundle")
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// Verify returns the gesher identity of the verified client certificate of a connection, an error if it has none
+func Verify(state *tls.ConnectionState) (*url.URL, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, errors.New("no verified client certificate")
+	}
+
+	for _, uri := range state.VerifiedChains[0][0].URIs {
+		if uri.Scheme == identityScheme && uri.Host == TrustDomain && strings.HasPrefix(uri.Path, "/ns/") {
+			return uri, nil
+		}
+	}
+
+	return nil, errors.New("client certificate doesn't carry a gesher identity")
+}
+
+// VerifyRequest verifies the connection r came in on, as Verify does
+func VerifyRequest(r *http.Request) (*url.URL, error) {
+	return Verify(r.TLS)
+}
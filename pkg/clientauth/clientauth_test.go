@@ -0,0 +1,90 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientauth_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/redislabs/gesher/pkg/clientauth"
+	"github.com/redislabs/gesher/pkg/tls_manager"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	caKey, ca, err := tls_manager.NewClientCA("gesher")
+	assert.NoError(t, err)
+	privKey, cert, err := tls_manager.NewClientKeyPair("gesher-system", "gesher", caKey, ca)
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := clientauth.VerifyRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprint(w, identity)
+	}))
+	server.TLS, err = clientauth.ServerTLSConfig(ca)
+	assert.NoError(t, err)
+	server.StartTLS()
+	defer server.Close()
+
+	keyPair, err := tls.X509KeyPair(cert, privKey)
+	assert.NoError(t, err)
+
+	resp, err := clientWith(server, keyPair).Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "spiffe://gesher.redislabs.com/ns/gesher-system/svc/gesher", string(body))
+
+	// a certificate from another CA is refused
+	otherCAKey, otherCA, err := tls_manager.NewClientCA("gesher")
+	assert.NoError(t, err)
+	otherKey, otherCert, err := tls_manager.NewClientKeyPair("gesher-system", "gesher", otherCAKey, otherCA)
+	assert.NoError(t, err)
+	otherPair, err := tls.X509KeyPair(otherCert, otherKey)
+	assert.NoError(t, err)
+	_, err = clientWith(server, otherPair).Get(server.URL)
+	assert.Error(t, err)
+}
+
+// clientWith returns a client of server presenting keyPair, on connections of its own
+func clientWith(server *httptest.Server, keyPair tls.Certificate) *http.Client {
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{keyPair}
+
+	return &http.Client{Transport: transport}
+}
+
+func TestVerify(t *testing.T) {
+	_, err := clientauth.Verify(nil)
+	assert.Error(t, err)
+
+	_, err = clientauth.Verify(&tls.ConnectionState{})
+	assert.Error(t, err)
+
+	_, err = clientauth.ServerTLSConfig([]byte("not a certificate"))
+	assert.Error(t, err)
+}
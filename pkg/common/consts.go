@@ -21,4 +21,16 @@ const (
 	CertPem   = CertDir + "cert.pem"
 	PrivPem   = CertDir + "priv.pem"
 	ProxyPath = "/proxy"
+	// ValidatePath serves the admission webhook for gesher's own custom resources
+	ValidatePath = "/validate"
+	// MutatePath serves the admission webhook recording the creator of NamespacedValidatingRules
+	MutatePath = "/mutate"
+
+	// ClientCertPem and ClientPrivPem are the key pair the proxy presents to namespaced webhooks
+	ClientCertPem = CertDir + "client-cert.pem"
+	ClientPrivPem = CertDir + "client-priv.pem"
+	// ClientCAPem is the CA issuing the proxy's client certificate
+	ClientCAPem = CertDir + "client-ca.pem"
+	// ProxyClientCAPem is the CA the webhook server verifies its callers' client certificates with, if any
+	ProxyClientCAPem = CertDir + "proxy-client-ca.pem"
 )
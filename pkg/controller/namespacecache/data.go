@@ -0,0 +1,116 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecache
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/bypass"
+)
+
+var (
+	NamespaceData = &NamespaceDataType{
+		Namespaces: make(map[string]NamespaceInfo),
+	}
+)
+
+// NamespaceInfo is the metadata of a namespace the proxy needs at admission time
+type NamespaceInfo struct {
+	UID         types.UID
+	Labels      map[string]string
+	Annotations map[string]string
+	// Bypass is the namespace's bypass, nil when it has none or its annotation is invalid
+	Bypass *bypass.Bypass
+}
+
+type NamespaceDataType struct {
+	Namespaces map[string]NamespaceInfo
+}
+
+// Labels returns the labels of the named namespace, nil if it isn't known
+func (p *NamespaceDataType) Labels(name string) map[string]string {
+	return p.Namespaces[name].Labels
+}
+
+// Info returns the metadata of the named namespace, and whether it is known
+func (p *NamespaceDataType) Info(name string) (NamespaceInfo, bool) {
+	info, ok := p.Namespaces[name]
+	return info, ok
+}
+
+// Bypass returns the bypass of the named namespace, nil if it has none
+func (p *NamespaceDataType) Bypass(name string) *bypass.Bypass {
+	return p.Namespaces[name].Bypass
+}
+
+// Decision returns the strategy deciding requests in the named namespace for rules not setting theirs
+func (p *NamespaceDataType) Decision(name string) v1alpha1.DecisionStrategy {
+	switch decision := v1alpha1.DecisionStrategy(p.Namespaces[name].Annotations[v1alpha1.DecisionAnnotation]); decision {
+	case v1alpha1.DecisionAnyAllows, v1alpha1.DecisionMajority:
+		return decision
+	default:
+		return v1alpha1.DecisionAllMustAllow
+	}
+}
+
+func (p *NamespaceDataType) Update(ns *corev1.Namespace) *NamespaceDataType {
+	newP := copyNamespaceData(p)
+
+	if newP.Namespaces == nil {
+		newP.Namespaces = make(map[string]NamespaceInfo)
+	}
+
+	// an invalid bypass annotation is reported by the rule controller
+	b, _ := bypass.Parse(ns.Annotations)
+	newP.Namespaces[ns.Name] = NamespaceInfo{UID: ns.UID, Labels: ns.Labels, Annotations: ns.Annotations, Bypass: b}
+
+	return newP
+}
+
+// Delete removes a namespace by name, as a deleted namespace can't be retrieved to find it by
+func (p *NamespaceDataType) Delete(name string) *NamespaceDataType {
+	newP := copyNamespaceData(p)
+
+	delete(newP.Namespaces, name)
+
+	return newP
+}
+
+func copyNamespaceData(p *NamespaceDataType) *NamespaceDataType {
+	var newP NamespaceDataType
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	dec := gob.NewDecoder(&buf)
+
+	err := enc.Encode(p)
+	if err != nil {
+		return nil
+	}
+
+	err = dec.Decode(&newP)
+	if err != nil {
+		return nil
+	}
+
+	return &newP
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+func TestUpdateDelete(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"tenant": "true"}}}
+
+	p := (&NamespaceDataType{}).Update(ns)
+	assert.Equal(t, ns.Labels, p.Labels("test"))
+	assert.Nil(t, p.Labels("other"))
+
+	relabeled := ns.DeepCopy()
+	relabeled.Labels = map[string]string{"tenant": "false"}
+	newP := p.Update(relabeled)
+	assert.Equal(t, "false", newP.Labels("test")["tenant"])
+	// the original is untouched
+	assert.Equal(t, "true", p.Labels("test")["tenant"])
+
+	newP = newP.Delete("test")
+	assert.Nil(t, newP.Labels("test"))
+}
+
+func TestInfo(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test",
+		UID:         "uid",
+		Labels:      map[string]string{"tenant": "true"},
+		Annotations: map[string]string{"owner": "team-a"},
+	}}
+
+	p := (&NamespaceDataType{}).Update(ns)
+	info, ok := p.Info("test")
+	assert.True(t, ok)
+	assert.Equal(t, ns.UID, info.UID)
+	assert.Equal(t, ns.Labels, info.Labels)
+	assert.Equal(t, ns.Annotations, info.Annotations)
+
+	_, ok = p.Info("other")
+	assert.False(t, ok)
+}
+
+func TestBypass(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+
+	p := (&NamespaceDataType{}).Update(ns)
+	assert.Nil(t, p.Bypass("test"))
+
+	ns.Annotations = map[string]string{v1alpha1.BypassAnnotation: "true"}
+	p = p.Update(ns)
+	assert.True(t, p.Bypass("test").Active(time.Now()))
+
+	// an invalid annotation bypasses nothing
+	ns.Annotations[v1alpha1.BypassAnnotation] = "soon"
+	p = p.Update(ns)
+	assert.Nil(t, p.Bypass("test"))
+}
+
+func TestDecision(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+
+	p := (&NamespaceDataType{}).Update(ns)
+	assert.Equal(t, v1alpha1.DecisionAllMustAllow, p.Decision("test"))
+	assert.Equal(t, v1alpha1.DecisionAllMustAllow, p.Decision("other"))
+
+	ns.Annotations = map[string]string{v1alpha1.DecisionAnnotation: string(v1alpha1.DecisionMajority)}
+	p = p.Update(ns)
+	assert.Equal(t, v1alpha1.DecisionMajority, p.Decision("test"))
+
+	ns.Annotations[v1alpha1.DecisionAnnotation] = "Unanimous"
+	p = p.Update(ns)
+	assert.Equal(t, v1alpha1.DecisionAllMustAllow, p.Decision("test"))
+}
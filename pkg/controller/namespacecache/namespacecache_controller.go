@@ -0,0 +1,99 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecache
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_namespacecache")
+
+// Add creates a new namespace cache Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileNamespaceCache{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("namespacecache-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileNamespaceCache implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileNamespaceCache{}
+
+// ReconcileNamespaceCache keeps NamespaceData, the namespace metadata the admission proxy uses, up to date
+type ReconcileNamespaceCache struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+func (r *ReconcileNamespaceCache) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Name", request.Name)
+	reqLogger.V(2).Info("Reconciling Namespace")
+
+	var newNamespaceData *NamespaceDataType
+
+	ns := &corev1.Namespace{}
+	err := r.client.Get(ctx, request.NamespacedName, ns)
+	switch {
+	case errors.IsNotFound(err):
+		newNamespaceData = NamespaceData.Delete(request.Name)
+	case err != nil:
+		reqLogger.Error(err, "namespace retrieval failed")
+		return reconcile.Result{}, err
+	default:
+		newNamespaceData = NamespaceData.Update(ns)
+	}
+
+	if !reflect.DeepEqual(newNamespaceData, NamespaceData) {
+		reqLogger.V(1).Info("updating namespace data")
+		NamespaceData = newNamespaceData
+	}
+
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+)
+
+// Creator returns the user recorded in rule's CreatorAnnotation, nil if none was recorded
+func Creator(rule *v1alpha1.NamespacedValidatingRule) (*authenticationv1.UserInfo, error) {
+	value, ok := rule.Annotations[v1alpha1.CreatorAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	user := &authenticationv1.UserInfo{}
+	if err := json.Unmarshal([]byte(value), user); err != nil {
+		return nil, fmt.Errorf("invalid %v annotation: %v", v1alpha1.CreatorAnnotation, err)
+	}
+
+	return user, nil
+}
+
+// UseRequiringTypes returns the sorted names of the types covering some of rules that require the use permission
+func UseRequiringTypes(rules []admregv1.RuleWithOperations, typeData *namespacedvalidatingtype.NamespacedTypeData) []string {
+	nameSet := make(map[string]bool)
+
+	for _, rule := range rules {
+		accepted, _ := SplitRule(rule, typeData)
+		for _, r := range accepted {
+			kind := &metav1.GroupVersionKind{Group: r.APIGroups[0], Version: r.APIVersions[0], Kind: r.Resources[0]}
+			for _, op := range r.Operations {
+				for _, t := range typeData.CoveringTypes(kind, op) {
+					if t.RequireUsePermission {
+						nameSet[t.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	var ret []string
+	for name := range nameSet {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// SplitUsable splits rules, as returned by SplitRule, into the ones covered by a type that is either open to all or
+// that canUse allows, and the ones covered only by types requiring a use permission canUse doesn't allow
+func SplitUsable(rules []admregv1.RuleWithOperations, typeData *namespacedvalidatingtype.NamespacedTypeData, canUse func(string) bool) ([]admregv1.RuleWithOperations, []admregv1.RuleWithOperations) {
+	var usable, unusable []admregv1.RuleWithOperations
+
+	for _, rule := range rules {
+		kind := &metav1.GroupVersionKind{Group: rule.APIGroups[0], Version: rule.APIVersions[0], Kind: rule.Resources[0]}
+
+		var usableOps, unusableOps []admregv1.OperationType
+		for _, op := range rule.Operations {
+			if typesUsable(typeData.CoveringTypes(kind, op), canUse) {
+				usableOps = append(usableOps, op)
+			} else {
+				unusableOps = append(unusableOps, op)
+			}
+		}
+
+		if len(usableOps) > 0 {
+			usable = append(usable, singleRule(kind.Group, kind.Version, kind.Kind, rule.Scope, usableOps))
+		}
+		if len(unusableOps) > 0 {
+			unusable = append(unusable, singleRule(kind.Group, kind.Version, kind.Kind, rule.Scope, unusableOps))
+		}
+	}
+
+	return usable, unusable
+}
+
+func typesUsable(typeInfos []namespacedvalidatingtype.TypeInfo, canUse func(string) bool) bool {
+	if len(typeInfos) == 0 {
+		return true
+	}
+
+	for _, t := range typeInfos {
+		if !t.RequireUsePermission || canUse(t.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckUse asks the api server whether user holds the use verb on the named NamespacedValidatingType
+func CheckUse(ctx context.Context, c client.Client, user *authenticationv1.UserInfo, typeName string) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:     v1alpha1.UseVerb,
+				Group:    v1alpha1.SchemeGroupVersion.Group,
+				Version:  v1alpha1.SchemeGroupVersion.Version,
+				Resource: "namespacedvalidatingtypes",
+				Name:     typeName,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+
+	if err := c.Create(ctx, sar); err != nil {
+		return false, err
+	}
+
+	return sar.Status.Allowed, nil
+}
@@ -17,25 +17,44 @@ limitations under the License.
 package namespacedvalidatingrule
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"strings"
+
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
 )
 
 const (
 	proxyFinalizer = "proxy.finalizer.gesher"
 )
 
-
-func act(kubeClient client.Client, state *analyzedState, logger logr.Logger) error {
+func act(kubeClient client.Client, recorder record.EventRecorder, state *analyzedState, logger logr.Logger) error {
 	var fullChange bool
 	ret := manageFinalizer(state, logger)
 	fullChange = ret || fullChange
 
+	// before the status is replaced by the new one
+	manageShadows(recorder, state, logger)
+
 	var statusChange bool
 	ret = manageGeneration(state, logger)
 	statusChange = ret || statusChange
 
+	ret = manageStatus(state, logger)
+	statusChange = ret || statusChange
+
+	ret = manageBypass(recorder, state, logger)
+	statusChange = ret || statusChange
+
 	if fullChange {
 		logger.V(2).Info("doing full update")
 		err := kubeClient.Update(context.TODO(), state.customResource)
@@ -53,6 +72,10 @@ func act(kubeClient client.Client, state *analyzedState, logger logr.Logger) err
 	}
 
 	EndpointData = state.newEndpointData
+	if state.delete {
+		forgetTargets(state.customResource.Namespace, state.customResource.Name)
+		forgetShadowVerdicts(state.customResource.Namespace, state.customResource.Name)
+	}
 
 	return nil
 }
@@ -90,6 +113,219 @@ func manageGeneration(state *analyzedState, logger logr.Logger) bool {
 	return ret
 }
 
+// manageStatus keeps the per webhook status and the conditions summarizing it up to date
+func manageStatus(state *analyzedState, logger logr.Logger) bool {
+	var ret bool
+	status := &state.customResource.Status
+	generation := state.customResource.Generation
+
+	if !equality.Semantic.DeepEqual(status.Webhooks, state.webhookStatus) {
+		logger.V(2).Info("updating webhook status")
+		status.Webhooks = state.webhookStatus
+		ret = true
+	}
+
+	if !bytes.Equal(status.ClientCABundle, state.clientCABundle) {
+		logger.V(2).Info("updating client CA bundle")
+		status.ClientCABundle = state.clientCABundle
+		ret = true
+	}
+
+	var active, accepted, reachable, granted = false, true, true, true
+	var rejectedMessages, unreachableMessages, deniedMessages []string
+	var uncovered, namespaceDenied, unauthorized bool
+	for _, webhook := range state.webhookStatus {
+		if webhook.ReferenceDenied {
+			granted = false
+			deniedMessages = append(deniedMessages, fmt.Sprintf("%v: %v", webhook.Name, webhook.Message))
+			continue
+		}
+		if len(webhook.AcceptedRules) > 0 {
+			active = true
+		}
+		if len(webhook.RejectedRules) > 0 {
+			accepted = false
+			uncovered = true
+			rejectedMessages = append(rejectedMessages, fmt.Sprintf("%v: %v rules not covered", webhook.Name, len(webhook.RejectedRules)))
+		}
+		if len(webhook.UnauthorizedRules) > 0 {
+			accepted = false
+			unauthorized = true
+			rejectedMessages = append(rejectedMessages, fmt.Sprintf("%v: %v rules not usable by the rule's creator", webhook.Name, len(webhook.UnauthorizedRules)))
+		}
+		if len(webhook.DeniedRules) > 0 {
+			accepted = false
+			namespaceDenied = true
+			rejectedMessages = append(rejectedMessages, fmt.Sprintf("%v: %v rules not permitted in this namespace", webhook.Name, len(webhook.DeniedRules)))
+		}
+		if !webhook.ServiceFound || webhook.ReadyEndpoints == 0 || !webhook.CABundleValid {
+			reachable = false
+			unreachableMessages = append(unreachableMessages, fmt.Sprintf("%v: %v", webhook.Name, webhook.Message))
+		}
+	}
+
+	activeCondition := metav1.Condition{
+		Type:               v1alpha1.RuleConditionActive,
+		Status:             metav1.ConditionTrue,
+		Reason:             "RulesProxied",
+		ObservedGeneration: generation,
+	}
+	if !active {
+		activeCondition.Status = metav1.ConditionFalse
+		activeCondition.Reason = "NoRulesProxied"
+		activeCondition.Message = "no NamespacedValidatingType covers any of the rule's granted webhooks"
+	}
+	ret = setCondition(&status.Conditions, activeCondition) || ret
+
+	acceptedCondition := metav1.Condition{
+		Type:               v1alpha1.RuleConditionAccepted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AllRulesCovered",
+		ObservedGeneration: generation,
+	}
+	if !accepted {
+		acceptedCondition.Status = metav1.ConditionFalse
+		acceptedCondition.Reason = "RulesNotCovered"
+		switch {
+		case !uncovered && unauthorized:
+			acceptedCondition.Reason = "UsePermissionMissing"
+		case !uncovered && namespaceDenied:
+			acceptedCondition.Reason = "NamespaceNotPermitted"
+		}
+		acceptedCondition.Message = strings.Join(rejectedMessages, "; ")
+	}
+	ret = setCondition(&status.Conditions, acceptedCondition) || ret
+
+	reachableCondition := metav1.Condition{
+		Type:               v1alpha1.RuleConditionReachable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "WebhooksReachable",
+		ObservedGeneration: generation,
+	}
+	if !reachable {
+		reachableCondition.Status = metav1.ConditionFalse
+		reachableCondition.Reason = "WebhooksUnreachable"
+		reachableCondition.Message = strings.Join(unreachableMessages, "; ")
+	}
+	ret = setCondition(&status.Conditions, reachableCondition) || ret
+
+	grantedCondition := metav1.Condition{
+		Type:               v1alpha1.RuleConditionReferencesGranted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ReferencesGranted",
+		ObservedGeneration: generation,
+	}
+	if !granted {
+		grantedCondition.Status = metav1.ConditionFalse
+		grantedCondition.Reason = "ReferencesDenied"
+		grantedCondition.Message = strings.Join(deniedMessages, "; ")
+	}
+	ret = setCondition(&status.Conditions, grantedCondition) || ret
+
+	readyCondition := metav1.Condition{
+		Type:               v1alpha1.RuleConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		ObservedGeneration: generation,
+	}
+	switch {
+	case !active:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = activeCondition.Reason
+	case !accepted:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = acceptedCondition.Reason
+	case !granted:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = grantedCondition.Reason
+	case !reachable:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = reachableCondition.Reason
+	}
+	ret = setCondition(&status.Conditions, readyCondition) || ret
+
+	// a type that was force deleted from under the rule has been replaced
+	degraded := meta.FindStatusCondition(status.Conditions, v1alpha1.RuleConditionDegraded)
+	if degraded != nil && degraded.Status == metav1.ConditionTrue && accepted {
+		ret = setCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.RuleConditionDegraded,
+			Status:             metav1.ConditionFalse,
+			Reason:             "Recovered",
+			Message:            "all rules are covered again",
+			ObservedGeneration: generation,
+		}) || ret
+	}
+
+	return ret
+}
+
+// manageBypass keeps the Bypassed condition up to date, recording an event whenever a bypass starts or ends, or the
+// namespace's bypass annotation turns invalid
+func manageBypass(recorder record.EventRecorder, state *analyzedState, logger logr.Logger) bool {
+	conditions := &state.customResource.Status.Conditions
+	wasBypassed := meta.IsStatusConditionTrue(*conditions, v1alpha1.RuleConditionBypassed)
+	var previousMessage string
+	if previous := meta.FindStatusCondition(*conditions, v1alpha1.RuleConditionBypassed); previous != nil {
+		previousMessage = previous.Message
+	}
+	ret := setCondition(conditions, state.bypassCondition)
+
+	switch bypassed := state.bypassCondition.Status == metav1.ConditionTrue; {
+	case bypassed && (!wasBypassed || previousMessage != state.bypassCondition.Message):
+		// a changed bypass, e.g. one extended, is recorded as well
+		logger.Info("webhooks bypassed", "reason", state.bypassCondition.Reason)
+		recorder.Event(state.customResource, corev1.EventTypeWarning, state.bypassCondition.Reason, state.bypassCondition.Message)
+	case !bypassed && wasBypassed:
+		logger.Info("bypass ended")
+		recorder.Event(state.customResource, corev1.EventTypeNormal, "BypassEnded", "webhooks are called again")
+	}
+
+	if state.bypassCondition.Reason == v1alpha1.ReasonInvalidBypass && previousMessage != state.bypassCondition.Message {
+		logger.Info("ignoring invalid bypass annotation of the rule's namespace", "message", state.bypassCondition.Message)
+		recorder.Event(state.customResource, corev1.EventTypeWarning, v1alpha1.ReasonInvalidBypass, state.bypassCondition.Message)
+	}
+
+	return ret
+}
+
+// manageShadows records an event for each shadow webhook that disagreed with the enforced verdicts since the status
+// last reported it
+func manageShadows(recorder record.EventRecorder, state *analyzedState, logger logr.Logger) {
+	previous := make(map[string]int64)
+	for _, status := range state.customResource.Status.Webhooks {
+		if status.Shadow != nil {
+			previous[status.Name] = status.Shadow.Disagreements
+		}
+	}
+
+	for _, status := range state.webhookStatus {
+		if status.Shadow == nil || status.Shadow.Disagreements <= previous[status.Name] {
+			continue
+		}
+
+		disagreements := status.Shadow.Disagreements - previous[status.Name]
+		logger.Info("shadow webhook disagreed", "webhook", status.Name, "disagreements", disagreements)
+		recorder.Event(state.customResource, corev1.EventTypeWarning, "ShadowDisagreement",
+			fmt.Sprintf("shadow webhook %v disagreed with %v enforced verdicts, last: %v", status.Name, disagreements, status.Shadow.LastDisagreement))
+	}
+}
+
+// setCondition sets condition in conditions, returning true if anything but the transition time changed
+func setCondition(conditions *[]metav1.Condition, condition metav1.Condition) bool {
+	existing := meta.FindStatusCondition(*conditions, condition.Type)
+	if existing != nil &&
+		existing.Status == condition.Status &&
+		existing.Reason == condition.Reason &&
+		existing.Message == condition.Message &&
+		existing.ObservedGeneration == condition.ObservedGeneration {
+		return false
+	}
+
+	meta.SetStatusCondition(conditions, condition)
+
+	return true
+}
+
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
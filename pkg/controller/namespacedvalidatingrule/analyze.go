@@ -17,27 +17,57 @@ limitations under the License.
 package namespacedvalidatingrule
 
 import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/go-logr/logr"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
-	"reflect"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
+)
+
+const (
+	// useRecheckInterval is how often a rule covered by types requiring the use permission has its creator's
+	// permissions checked again
+	useRecheckInterval = 5 * time.Minute
 )
 
 type analyzedState struct {
-	customResource *v1alpha1.NamespacedValidatingRule
+	customResource  *v1alpha1.NamespacedValidatingRule
 	newEndpointData *EndpointDataType
-	update bool
-	delete bool
+	webhookStatus   []v1alpha1.WebhookStatus
+	update          bool
+	delete          bool
+	requeueAfter    time.Duration
+	// bypassCondition is the rule's Bypassed condition, false unless an administrator bypasses it
+	bypassCondition metav1.Condition
+	// clientCABundle is published in the rule's status for its webhooks to verify the proxy with
+	clientCABundle []byte
 }
 
 func analyze(observed *observeState, logger logr.Logger) (*analyzedState, error) {
 	state := &analyzedState{
 		customResource: observed.customResource,
+		clientCABundle: currentClientCABundle(),
+	}
+
+	for _, webhook := range observed.customResource.Spec.Webhooks {
+		state.webhookStatus = append(state.webhookStatus, analyzeWebhook(webhook, observed))
 	}
 
 	switch observed.customResource.DeletionTimestamp.IsZero() {
 	case true:
 		logger.V(2).Info("DeletionTimeStamp is zero")
-		state.newEndpointData = EndpointData.Update(observed.customResource)
+		state.newEndpointData = EndpointData.Update(proxiedRule(observed.customResource, state.webhookStatus))
 	case false:
 		logger.V(2).Info("DeletionTimeStamp is not zero, deleting")
 		state.newEndpointData = EndpointData.Delete(observed.customResource)
@@ -48,5 +78,418 @@ func analyze(observed *observeState, logger logr.Logger) (*analyzedState, error)
 		state.update = true
 	}
 
+	// losing the use permission on a type doesn't trigger a reconcile, so it has to be checked for periodically
+	if len(observed.usableTypes) > 0 {
+		state.requeueAfter = useRecheckInterval
+	}
+
+	var expiry *time.Time
+	state.bypassCondition, expiry = bypassCondition(observed, state.webhookStatus)
+	// nothing else triggers a reconcile when a bypass expires, the second makes sure it has by then
+	if expiry != nil {
+		if untilExpiry := expiry.Sub(observed.now) + time.Second; state.requeueAfter == 0 || untilExpiry < state.requeueAfter {
+			state.requeueAfter = untilExpiry
+		}
+	}
+
 	return state, nil
 }
+
+// bypassCondition returns the Bypassed condition of the observed rule, whose webhooks have webhookStatus, and when the
+// earliest of the bypasses it reports expires, nil if none does
+func bypassCondition(observed *observeState, webhookStatus []v1alpha1.WebhookStatus) (metav1.Condition, *time.Time) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.RuleConditionBypassed,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NotBypassed",
+		ObservedGeneration: observed.customResource.Generation,
+	}
+
+	if observed.namespaceBypass.Active(observed.now) {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = v1alpha1.ReasonNamespaceBypassed
+		condition.Message = fmt.Sprintf("namespace %v is bypassed %v, no webhook is called", observed.customResource.Namespace, observed.namespaceBypass)
+		return condition, observed.namespaceBypass.Until
+	}
+
+	var expiry *time.Time
+	var names []string
+	seen := make(map[string]bool)
+	for _, status := range webhookStatus {
+		for _, rule := range status.AcceptedRules {
+			kind := &metav1.GroupVersionKind{Group: rule.APIGroups[0], Version: rule.APIVersions[0], Kind: rule.Resources[0]}
+			for _, op := range rule.Operations {
+				name, b := observed.typeData.Bypassed(observed.customResource.Namespace, observed.namespaceLabels, kind, op, observed.now)
+				if b == nil || seen[name] {
+					continue
+				}
+				seen[name] = true
+				names = append(names, fmt.Sprintf("%v (%v)", name, b))
+
+				if b.Until != nil && (expiry == nil || b.Until.Before(*expiry)) {
+					expiry = b.Until
+				}
+			}
+		}
+	}
+
+	if len(names) > 0 {
+		sort.Strings(names)
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = v1alpha1.ReasonTypeBypassed
+		condition.Message = fmt.Sprintf("webhooks aren't called for the resources of bypassed NamespacedValidatingTypes: %v", strings.Join(names, ", "))
+	}
+
+	// the condition keeps reporting an invalid annotation of the namespace, so its event is only recorded once
+	if observed.namespaceBypassErr != nil {
+		invalid := fmt.Sprintf("the bypass annotation of namespace %v is ignored: %v", observed.customResource.Namespace, observed.namespaceBypassErr)
+		if condition.Status == metav1.ConditionTrue {
+			condition.Message += "; " + invalid
+		} else {
+			condition.Reason = v1alpha1.ReasonInvalidBypass
+			condition.Message = invalid
+		}
+	}
+
+	return condition, expiry
+}
+
+// proxiedRule returns a copy of rule holding only what may be proxied according to the webhooks' status.  Webhooks
+// pointing at services in other namespaces that no grant allows are left out, as are the rules of each webhook that
+// are only covered by types the rule's creator may not use and the backends no grant allows.
+func proxiedRule(rule *v1alpha1.NamespacedValidatingRule, webhookStatus []v1alpha1.WebhookStatus) *v1alpha1.NamespacedValidatingRule {
+	ret := rule.DeepCopy()
+	ret.Spec.Webhooks = nil
+
+	for i, webhook := range rule.Spec.Webhooks {
+		status := webhookStatus[i]
+		if status.ReferenceDenied {
+			continue
+		}
+
+		// only what the rule's types cover, and may be used, is proxied, wildcards included
+		webhook = *webhook.DeepCopy()
+		webhook.Rules = status.AcceptedRules
+
+		// the proxy skips failover targets it may not call, but a denied backend's share goes to the clientConfig
+		if len(status.DeniedTargets) > 0 {
+			webhook = *webhook.DeepCopy()
+			var backends []v1alpha1.WeightedBackend
+			for j, backend := range webhook.Backends {
+				if !containsString(status.DeniedTargets, backendName(j)) {
+					backends = append(backends, backend)
+				}
+			}
+			webhook.Backends = backends
+		}
+
+		ret.Spec.Webhooks = append(ret.Spec.Webhooks, webhook)
+	}
+
+	return ret
+}
+
+func referenceGranted(clientConfig admregv1.WebhookClientConfig, namespace string, grantData *webhookservicegrant.GrantDataType) bool {
+	if clientConfig.Service == nil {
+		return true
+	}
+
+	return grantData.Allowed(namespace, serviceKey(clientConfig.Service.Namespace, clientConfig.Service.Name, namespace))
+}
+
+// deniedTargets returns the names of the backends and failover targets of webhook that no grant allows, along with
+// the problems to report about them
+func deniedTargets(webhook v1alpha1.NamespacedValidatingWebhook, namespace string, grantData *webhookservicegrant.GrantDataType) ([]string, []string) {
+	var names, problems []string
+
+	deny := func(name string, clientConfig admregv1.WebhookClientConfig) {
+		if referenceGranted(clientConfig, namespace, grantData) {
+			return
+		}
+
+		key := serviceKey(clientConfig.Service.Namespace, clientConfig.Service.Name, namespace)
+		names = append(names, name)
+		problems = append(problems, fmt.Sprintf("no WebhookServiceGrant in namespace %v allows service %v of %v", key.Namespace, key, name))
+	}
+
+	for i, backend := range webhook.Backends {
+		deny(backendName(i), backend.ClientConfig)
+	}
+	for i, target := range webhook.Failover {
+		deny(TargetName(i+1), target)
+	}
+
+	return names, problems
+}
+
+// backendName names the i-th backend of a webhook in its status
+func backendName(i int) string {
+	return fmt.Sprintf("backends[%v]", i)
+}
+
+func analyzeWebhook(webhook v1alpha1.NamespacedValidatingWebhook, observed *observeState) v1alpha1.WebhookStatus {
+	status := v1alpha1.WebhookStatus{Name: webhook.Name}
+	var problems []string
+
+	for _, rule := range webhook.Rules {
+		accepted, rejected := SplitRule(rule, observed.typeData)
+		permitted, denied := splitPermitted(accepted, observed.typeData, observed.customResource.Namespace, observed.namespaceLabels)
+		usable, unusable := SplitUsable(permitted, observed.typeData, func(name string) bool { return observed.usableTypes[name] })
+		status.AcceptedRules = append(status.AcceptedRules, usable...)
+		status.DeniedRules = append(status.DeniedRules, denied...)
+		status.UnauthorizedRules = append(status.UnauthorizedRules, unusable...)
+		status.RejectedRules = append(status.RejectedRules, rejected...)
+	}
+	status.EffectiveFailurePolicy, status.EffectiveTimeoutSeconds, status.IgnoredRules = effectiveSettings(webhook, status.AcceptedRules, observed.typeData)
+
+	if len(status.RejectedRules) > 0 {
+		problems = append(problems, fmt.Sprintf("%v rules not covered by any NamespacedValidatingType", len(status.RejectedRules)))
+	}
+	if len(status.UnauthorizedRules) > 0 {
+		creator := "unknown"
+		if observed.creator != nil {
+			creator = observed.creator.Username
+		}
+		problems = append(problems, fmt.Sprintf("%v rules covered only by NamespacedValidatingTypes the rule's creator (%v) may not use",
+			len(status.UnauthorizedRules), creator))
+	}
+	if len(status.DeniedRules) > 0 {
+		problems = append(problems, fmt.Sprintf("%v rules covered only by NamespacedValidatingTypes that don't permit namespace %v",
+			len(status.DeniedRules), observed.customResource.Namespace))
+	}
+
+	switch {
+	case webhook.ClientConfig.Service == nil:
+		problems = append(problems, "only service client configs are supported")
+	case !referenceGranted(webhook.ClientConfig, observed.customResource.Namespace, observed.grantData):
+		// don't report on the state of a service the rule isn't allowed to use
+		status.ReferenceDenied = true
+		key := serviceKey(webhook.ClientConfig.Service.Namespace, webhook.ClientConfig.Service.Name, observed.customResource.Namespace)
+		problems = append(problems, fmt.Sprintf("no WebhookServiceGrant in namespace %v allows service %v", key.Namespace, key))
+	default:
+		key := serviceKey(webhook.ClientConfig.Service.Namespace, webhook.ClientConfig.Service.Name, observed.customResource.Namespace)
+		status.ServiceFound = observed.services[key] != nil
+		status.ReadyEndpoints = readyEndpoints(observed.endpoints[key])
+
+		switch {
+		case !status.ServiceFound:
+			problems = append(problems, fmt.Sprintf("service %v not found", key))
+		case status.ReadyEndpoints == 0:
+			problems = append(problems, fmt.Sprintf("service %v has no ready endpoints", key))
+		}
+	}
+
+	var denied []string
+	status.DeniedTargets, denied = deniedTargets(webhook, observed.customResource.Namespace, observed.grantData)
+	problems = append(problems, denied...)
+
+	expiry, err := ParseCABundle(webhook.ClientConfig.CABundle)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		status.CABundleValid = true
+		status.CABundleExpiry = expiry
+	}
+
+	if len(webhook.Failover) > 0 {
+		target := ActiveTarget(observed.customResource.Namespace, observed.customResource.Name, webhook.Name)
+		if target > len(webhook.Failover) {
+			target = 0
+		}
+		status.ActiveTarget = TargetName(target)
+	}
+
+	if webhook.Shadow {
+		status.Shadow = shadowStatus(observed.customResource.Namespace, observed.customResource.Name, webhook.Name)
+	}
+
+	status.Message = strings.Join(problems, "; ")
+
+	return status
+}
+
+// effectiveSettings returns the failure policy and the longest timeout webhook is called with for rules, as returned
+// by SplitRule, once typeData's limits apply, along with the rules for which the limits make it ignore failures it
+// asked to fail on
+func effectiveSettings(webhook v1alpha1.NamespacedValidatingWebhook, rules []admregv1.RuleWithOperations, typeData *namespacedvalidatingtype.NamespacedTypeData) (admregv1.FailurePolicyType, int32, []admregv1.RuleWithOperations) {
+	requested := createWebhookConfig(webhook, "", "")
+	if len(rules) == 0 {
+		return requested.FailurePolicy, requested.TimeoutSecs, nil
+	}
+
+	failurePolicy := admregv1.Ignore
+	var timeoutSecs int32
+	var ignored []admregv1.RuleWithOperations
+
+	for _, rule := range rules {
+		kind := &metav1.GroupVersionKind{Group: rule.APIGroups[0], Version: rule.APIVersions[0], Kind: rule.Resources[0]}
+
+		var ignoredOps []admregv1.OperationType
+		for _, op := range rule.Operations {
+			config := requested.limited(typeData.WebhookLimits(kind, op))
+			if config.TimeoutSecs > timeoutSecs {
+				timeoutSecs = config.TimeoutSecs
+			}
+
+			switch {
+			case config.FailurePolicy != admregv1.Ignore:
+				failurePolicy = config.FailurePolicy
+			case requested.FailurePolicy != admregv1.Ignore:
+				ignoredOps = append(ignoredOps, op)
+			}
+		}
+
+		if len(ignoredOps) > 0 {
+			ignored = append(ignored, singleRule(kind.Group, kind.Version, kind.Kind, rule.Scope, ignoredOps))
+		}
+	}
+
+	return failurePolicy, timeoutSecs, ignored
+}
+
+// SplitRule splits rule into the group/version/resource combinations some type covers and the ones no type does.  A
+// rule's wildcards are narrowed to the keys the types are registered under, so each accepted combination is covered
+// in full by the types that decide whether it's permitted and usable.
+func SplitRule(rule admregv1.RuleWithOperations, typeData *namespacedvalidatingtype.NamespacedTypeData) ([]admregv1.RuleWithOperations, []admregv1.RuleWithOperations) {
+	var accepted, rejected []admregv1.RuleWithOperations
+
+	for _, group := range rule.APIGroups {
+		for _, version := range rule.APIVersions {
+			for _, resource := range rule.Resources {
+				kind := &metav1.GroupVersionKind{Group: group, Version: version, Kind: resource}
+
+				var rejectedOps []admregv1.OperationType
+				for _, op := range rule.Operations {
+					keys := typeData.Expand(kind, op)
+					if len(keys) == 0 {
+						rejectedOps = append(rejectedOps, op)
+						continue
+					}
+
+					for _, key := range keys {
+						accepted = addOperation(accepted, key.Kind, rule.Scope, key.Op)
+					}
+				}
+
+				if len(rejectedOps) > 0 {
+					rejected = append(rejected, singleRule(group, version, resource, rule.Scope, rejectedOps))
+				}
+			}
+		}
+	}
+
+	return accepted, rejected
+}
+
+// addOperation adds op on kind to rules, to the single rule already there for kind if there is one
+func addOperation(rules []admregv1.RuleWithOperations, kind metav1.GroupVersionKind, scope *admregv1.ScopeType, op admregv1.OperationType) []admregv1.RuleWithOperations {
+	for i, rule := range rules {
+		if rule.APIGroups[0] == kind.Group && rule.APIVersions[0] == kind.Version && rule.Resources[0] == kind.Kind {
+			if !containsOperation(rule.Operations, op) {
+				rules[i].Operations = append(rule.Operations, op)
+			}
+			return rules
+		}
+	}
+
+	return append(rules, singleRule(kind.Group, kind.Version, kind.Kind, scope, []admregv1.OperationType{op}))
+}
+
+func containsOperation(ops []admregv1.OperationType, op admregv1.OperationType) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitPermitted splits rules, as returned by SplitRule, into the ones proxied for namespace and the ones whose
+// types don't permit it
+func splitPermitted(rules []admregv1.RuleWithOperations, typeData *namespacedvalidatingtype.NamespacedTypeData, namespace string, labels map[string]string) ([]admregv1.RuleWithOperations, []admregv1.RuleWithOperations) {
+	var permitted, denied []admregv1.RuleWithOperations
+
+	for _, rule := range rules {
+		kind := &metav1.GroupVersionKind{Group: rule.APIGroups[0], Version: rule.APIVersions[0], Kind: rule.Resources[0]}
+
+		var permittedOps, deniedOps []admregv1.OperationType
+		for _, op := range rule.Operations {
+			if typeData.Permits(namespace, labels, kind, op) {
+				permittedOps = append(permittedOps, op)
+			} else {
+				deniedOps = append(deniedOps, op)
+			}
+		}
+
+		if len(permittedOps) > 0 {
+			permitted = append(permitted, singleRule(kind.Group, kind.Version, kind.Kind, rule.Scope, permittedOps))
+		}
+		if len(deniedOps) > 0 {
+			denied = append(denied, singleRule(kind.Group, kind.Version, kind.Kind, rule.Scope, deniedOps))
+		}
+	}
+
+	return permitted, denied
+}
+
+func singleRule(group, version, resource string, scope *admregv1.ScopeType, ops []admregv1.OperationType) admregv1.RuleWithOperations {
+	return admregv1.RuleWithOperations{
+		Operations: ops,
+		Rule: admregv1.Rule{
+			APIGroups:   []string{group},
+			APIVersions: []string{version},
+			Resources:   []string{resource},
+			Scope:       scope,
+		},
+	}
+}
+
+func readyEndpoints(endpoints *corev1.Endpoints) int32 {
+	if endpoints == nil {
+		return 0
+	}
+
+	var ret int32
+	for _, subset := range endpoints.Subsets {
+		ret += int32(len(subset.Addresses))
+	}
+
+	return ret
+}
+
+// ParseCABundle verifies caBundle holds PEM certificates, returning when the first of them expires
+func ParseCABundle(caBundle []byte) (*metav1.Time, error) {
+	if len(caBundle) == 0 {
+		return nil, fmt.Errorf("caBundle is empty")
+	}
+
+	var expiry *metav1.Time
+	rest := caBundle
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("caBundle contains an invalid certificate: %v", err)
+		}
+
+		if expiry == nil || cert.NotAfter.Before(expiry.Time) {
+			notAfter := metav1.NewTime(cert.NotAfter)
+			expiry = &notAfter
+		}
+	}
+
+	if expiry == nil {
+		return nil, fmt.Errorf("caBundle doesn't contain any PEM certificates")
+	}
+
+	return expiry, nil
+}
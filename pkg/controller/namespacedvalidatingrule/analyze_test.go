@@ -0,0 +1,491 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/bypass"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
+	"github.com/redislabs/gesher/pkg/tls_manager"
+)
+
+const (
+	testService = "service"
+)
+
+var (
+	typeResource = &v1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: uid1, Name: "type"},
+		Spec: v1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{testOp1},
+				Rule: admregv1.Rule{
+					APIGroups:   []string{testGroup1},
+					APIVersions: []string{testVersion1},
+					Resources:   []string{testResource1},
+				},
+			}},
+		},
+	}
+)
+
+func TestSplitRule(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource)
+
+	accepted, rejected := SplitRule(admregv1.RuleWithOperations{
+		Operations: []admregv1.OperationType{testOp1, testOp2},
+		Rule: admregv1.Rule{
+			APIGroups:   []string{testGroup1},
+			APIVersions: []string{testVersion1},
+			Resources:   []string{testResource1},
+		},
+	}, typeData)
+
+	assert.Len(t, accepted, 1)
+	assert.Equal(t, []admregv1.OperationType{testOp1}, accepted[0].Operations)
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, []admregv1.OperationType{testOp2}, rejected[0].Operations)
+}
+
+func TestAnalyzeWebhookMissingService(t *testing.T) {
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource),
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	status := analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Len(t, status.AcceptedRules, 1)
+	assert.Empty(t, status.RejectedRules)
+	assert.False(t, status.ServiceFound)
+	assert.False(t, status.CABundleValid)
+	assert.Contains(t, status.Message, "not found")
+	assert.Contains(t, status.Message, "caBundle is empty")
+}
+
+func TestAnalyzeWebhookReachable(t *testing.T) {
+	caBundle, notAfter := testCABundle(t)
+
+	webhook := *resource2.Spec.Webhooks[0].DeepCopy()
+	webhook.ClientConfig.Service.Name = testService
+	webhook.ClientConfig.CABundle = caBundle
+
+	key := types.NamespacedName{Namespace: namespace, Name: testService}
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       &namespacedvalidatingtype.NamespacedTypeData{},
+		services:       map[types.NamespacedName]*corev1.Service{key: {}},
+		endpoints: map[types.NamespacedName]*corev1.Endpoints{key: {
+			Subsets: []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}}},
+		}},
+	}
+
+	status := analyzeWebhook(webhook, observed)
+	assert.Empty(t, status.AcceptedRules)
+	assert.Len(t, status.RejectedRules, 1)
+	assert.True(t, status.ServiceFound)
+	assert.Equal(t, int32(2), status.ReadyEndpoints)
+	assert.True(t, status.CABundleValid)
+	assert.True(t, notAfter.Equal(status.CABundleExpiry.Time))
+}
+
+func TestAnalyzeWebhookNamespaceDenied(t *testing.T) {
+	restricted := typeResource.DeepCopy()
+	restricted.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}}
+
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(restricted),
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	status := analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Empty(t, status.AcceptedRules)
+	assert.Empty(t, status.RejectedRules)
+	assert.Len(t, status.DeniedRules, 1)
+	assert.Contains(t, status.Message, "don't permit namespace")
+
+	observed.namespaceLabels = map[string]string{"tenant": "true"}
+	status = analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Len(t, status.AcceptedRules, 1)
+	assert.Empty(t, status.DeniedRules)
+}
+
+func TestAnalyzeWebhookUnauthorized(t *testing.T) {
+	restricted := typeResource.DeepCopy()
+	restricted.Spec.RequireUsePermission = true
+
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(restricted),
+		usableTypes:    map[string]bool{restricted.Name: false},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	status := analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Empty(t, status.AcceptedRules)
+	assert.Len(t, status.UnauthorizedRules, 1)
+	assert.Contains(t, status.Message, "creator (unknown) may not use")
+	assert.Empty(t, proxiedRule(resource2, []v1alpha1.WebhookStatus{status}).Spec.Webhooks[0].Rules)
+
+	observed.usableTypes[restricted.Name] = true
+	status = analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Len(t, status.AcceptedRules, 1)
+	assert.Empty(t, status.UnauthorizedRules)
+	assert.Equal(t, resource2.Spec.Webhooks[0].Rules, proxiedRule(resource2, []v1alpha1.WebhookStatus{status}).Spec.Webhooks[0].Rules)
+}
+
+func TestUseRequiringTypes(t *testing.T) {
+	restricted := typeResource.DeepCopy()
+	restricted.Spec.RequireUsePermission = true
+	open := typeResource.DeepCopy()
+	open.UID, open.Name = uid2, "open"
+
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(restricted)
+	assert.Equal(t, []string{restricted.Name}, UseRequiringTypes(resource2.Spec.Webhooks[0].Rules, typeData))
+
+	// a type open to all makes the restricted one unnecessary, but it's still checked
+	typeData = typeData.Add(open)
+	assert.Equal(t, []string{restricted.Name}, UseRequiringTypes(resource2.Spec.Webhooks[0].Rules, typeData))
+	usable, unusable := SplitUsable(resource2.Spec.Webhooks[0].Rules, typeData, func(string) bool { return false })
+	assert.Len(t, usable, 1)
+	assert.Empty(t, unusable)
+}
+
+func TestAnalyzeWebhookWildcardUnauthorized(t *testing.T) {
+	gated := typeResource.DeepCopy()
+	gated.UID, gated.Name = uid2, "gated"
+	gated.Spec.Types[0].Resources = []string{"gated"}
+	gated.Spec.RequireUsePermission = true
+
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].Rules[0].Resources = []string{"*"}
+
+	observed := &observeState{
+		customResource: rule,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource).Add(gated),
+		usableTypes:    map[string]bool{gated.Name: false},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	// the wildcard stands for each type's resources, and only the open type's is usable
+	status := analyzeWebhook(rule.Spec.Webhooks[0], observed)
+	assert.Len(t, status.AcceptedRules, 1)
+	assert.Equal(t, []string{testResource1}, status.AcceptedRules[0].Resources)
+	assert.Len(t, status.UnauthorizedRules, 1)
+	assert.Equal(t, []string{"gated"}, status.UnauthorizedRules[0].Resources)
+
+	e := (&EndpointDataType{}).Add(proxiedRule(rule, []v1alpha1.WebhookStatus{status}))
+	assert.Len(t, e.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1), 1)
+	assert.Empty(t, e.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: "gated"}, testOp1))
+}
+
+func TestCreator(t *testing.T) {
+	rule := resource2.DeepCopy()
+
+	creator, err := Creator(rule)
+	assert.Nil(t, err)
+	assert.Nil(t, creator)
+
+	rule.Annotations = map[string]string{v1alpha1.CreatorAnnotation: `{"username":"alice","groups":["tenants"]}`}
+	creator, err = Creator(rule)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", creator.Username)
+	assert.Equal(t, []string{"tenants"}, creator.Groups)
+
+	rule.Annotations[v1alpha1.CreatorAnnotation] = "garbage"
+	_, err = Creator(rule)
+	assert.NotNil(t, err)
+}
+
+func TestAnalyzeWebhookReferenceDenied(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].ClientConfig.Service.Namespace = "other"
+	rule.Spec.Webhooks[0].ClientConfig.Service.Name = testService
+
+	observed := &observeState{
+		customResource: rule,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource),
+		grantData:      &webhookservicegrant.GrantDataType{},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	status := analyzeWebhook(rule.Spec.Webhooks[0], observed)
+	assert.True(t, status.ReferenceDenied)
+	assert.False(t, status.ServiceFound)
+	assert.Contains(t, status.Message, "no WebhookServiceGrant")
+	assert.Empty(t, proxiedRule(rule, []v1alpha1.WebhookStatus{status}).Spec.Webhooks)
+
+	observed.grantData = webhookservicegrant.NewGrantData([]v1alpha1.WebhookServiceGrant{{
+		ObjectMeta: metav1.ObjectMeta{Name: "grant", Namespace: "other"},
+		Spec: v1alpha1.WebhookServiceGrantSpec{
+			From: []v1alpha1.WebhookServiceGrantFrom{{Namespace: namespace}},
+		},
+	}})
+
+	status = analyzeWebhook(rule.Spec.Webhooks[0], observed)
+	assert.False(t, status.ReferenceDenied)
+	assert.Len(t, proxiedRule(rule, []v1alpha1.WebhookStatus{status}).Spec.Webhooks, 1)
+}
+
+func TestAnalyzeWebhookDeniedTargets(t *testing.T) {
+	rule := resource2.DeepCopy()
+	other := func(name string) admregv1.WebhookClientConfig {
+		return admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Namespace: "other", Name: name}}
+	}
+	rule.Spec.Webhooks[0].Backends = []v1alpha1.WeightedBackend{
+		{Name: "local", Weight: 10, ClientConfig: admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Name: "local"}}},
+		{Name: "canary", Weight: 10, ClientConfig: other("canary")},
+	}
+	rule.Spec.Webhooks[0].Failover = []admregv1.WebhookClientConfig{other("standby")}
+
+	observed := &observeState{
+		customResource: rule,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource),
+		grantData:      &webhookservicegrant.GrantDataType{},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	status := analyzeWebhook(rule.Spec.Webhooks[0], observed)
+	assert.False(t, status.ReferenceDenied)
+	assert.Equal(t, []string{"backends[1]", "failover[0]"}, status.DeniedTargets)
+	assert.Contains(t, status.Message, "no WebhookServiceGrant in namespace other allows service other/canary of backends[1]")
+
+	// the denied backend is left out, the denied failover target is skipped by the proxy
+	proxied := proxiedRule(rule, []v1alpha1.WebhookStatus{status})
+	if assert.Len(t, proxied.Spec.Webhooks, 1) {
+		assert.Len(t, proxied.Spec.Webhooks[0].Backends, 1)
+		assert.Equal(t, "local", proxied.Spec.Webhooks[0].Backends[0].Name)
+		assert.Len(t, proxied.Spec.Webhooks[0].Failover, 1)
+	}
+	assert.Len(t, rule.Spec.Webhooks[0].Backends, 2)
+
+	// the rule is reconciled when grants or services change in the namespaces its alternatives point into
+	assert.True(t, referencesService(*rule, func(service *admregv1.ServiceReference) bool { return service.Name == "standby" }))
+	assert.True(t, referencesService(*rule, func(service *admregv1.ServiceReference) bool { return service.Name == "canary" }))
+	assert.False(t, referencesService(*rule, func(service *admregv1.ServiceReference) bool { return service.Name == "missing" }))
+
+	observed.grantData = webhookservicegrant.NewGrantData([]v1alpha1.WebhookServiceGrant{{
+		ObjectMeta: metav1.ObjectMeta{Name: "grant", Namespace: "other"},
+		Spec: v1alpha1.WebhookServiceGrantSpec{
+			From: []v1alpha1.WebhookServiceGrantFrom{{Namespace: namespace}},
+		},
+	}})
+	assert.Empty(t, analyzeWebhook(rule.Spec.Webhooks[0], observed).DeniedTargets)
+}
+
+func TestParseCABundleInvalid(t *testing.T) {
+	_, err := ParseCABundle([]byte("not a certificate"))
+	assert.NotNil(t, err)
+
+	_, err = ParseCABundle(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))
+	assert.NotNil(t, err)
+}
+
+func testCABundle(t *testing.T) ([]byte, time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), notAfter
+}
+
+func TestAnalyzeWebhookLimits(t *testing.T) {
+	ignore := admregv1.Ignore
+	five := int32(5)
+
+	limited := typeResource.DeepCopy()
+	limited.Spec.WebhookLimits = &v1alpha1.WebhookLimits{MaxFailurePolicy: &ignore, MaxTimeoutSeconds: &five}
+
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource),
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+
+	status := analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Equal(t, admregv1.Fail, status.EffectiveFailurePolicy)
+	assert.Equal(t, int32(30), status.EffectiveTimeoutSeconds)
+	assert.Empty(t, status.IgnoredRules)
+
+	observed.typeData = (&namespacedvalidatingtype.NamespacedTypeData{}).Add(limited)
+	status = analyzeWebhook(resource2.Spec.Webhooks[0], observed)
+	assert.Equal(t, ignore, status.EffectiveFailurePolicy)
+	assert.Equal(t, five, status.EffectiveTimeoutSeconds)
+	assert.Equal(t, status.AcceptedRules, status.IgnoredRules)
+}
+
+func TestBypassCondition(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+
+	bypassed := typeResource.DeepCopy()
+	bypassed.Annotations = map[string]string{v1alpha1.BypassAnnotation: until.Format(time.RFC3339)}
+
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource),
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+		now:            now,
+	}
+
+	state, err := analyze(observed, log)
+	assert.Nil(t, err)
+	assert.Equal(t, metav1.ConditionFalse, state.bypassCondition.Status)
+	assert.Zero(t, state.requeueAfter)
+
+	observed.typeData = (&namespacedvalidatingtype.NamespacedTypeData{}).Add(bypassed)
+	state, err = analyze(observed, log)
+	assert.Nil(t, err)
+	assert.Equal(t, metav1.ConditionTrue, state.bypassCondition.Status)
+	assert.Equal(t, v1alpha1.ReasonTypeBypassed, state.bypassCondition.Reason)
+	assert.Contains(t, state.bypassCondition.Message, bypassed.Name)
+	// the rule is reconciled again once the bypass expires
+	assert.True(t, state.requeueAfter > 59*time.Minute && state.requeueAfter <= time.Hour+time.Second)
+
+	observed.namespaceBypass = &bypass.Bypass{}
+	state, err = analyze(observed, log)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha1.ReasonNamespaceBypassed, state.bypassCondition.Reason)
+	assert.Zero(t, state.requeueAfter)
+
+	observed.now = until
+	observed.namespaceBypass = nil
+	state, err = analyze(observed, log)
+	assert.Nil(t, err)
+	assert.Equal(t, metav1.ConditionFalse, state.bypassCondition.Status)
+}
+
+func TestManageInvalidBypass(t *testing.T) {
+	rule := resource2.DeepCopy()
+	observed := &observeState{
+		customResource:     rule,
+		typeData:           (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource),
+		services:           map[types.NamespacedName]*corev1.Service{},
+		endpoints:          map[types.NamespacedName]*corev1.Endpoints{},
+		now:                time.Now(),
+		namespaceBypassErr: errors.New("not a time"),
+	}
+	recorder := record.NewFakeRecorder(10)
+
+	// the invalid annotation is reported by the condition, and by an event the first time around only
+	for i := 0; i < 2; i++ {
+		state, err := analyze(observed, log)
+		assert.Nil(t, err)
+		assert.Equal(t, metav1.ConditionFalse, state.bypassCondition.Status)
+		assert.Equal(t, v1alpha1.ReasonInvalidBypass, state.bypassCondition.Reason)
+		manageBypass(recorder, state, log)
+	}
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "Warning InvalidBypass the bypass annotation of namespace test is ignored: not a time")
+	}
+
+	// a different invalid value is reported again
+	observed.namespaceBypassErr = errors.New("still not a time")
+	state, err := analyze(observed, log)
+	assert.Nil(t, err)
+	manageBypass(recorder, state, log)
+	assert.Len(t, recorder.Events, 1)
+}
+
+func TestAnalyzeClientCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clientca")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file, bundle := clientCAFile, currentClientCABundle()
+	defer func() {
+		clientCAFile = file
+		clientCABundle.Store(bundle)
+	}()
+
+	caFile := filepath.Join(dir, "client-ca.pem")
+	clientCAFile = tls_manager.NewFileReloader(caFile)
+	_, err = reloadClientCABundle()
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(caFile, []byte("first"), 0600))
+	changed, err := reloadClientCABundle()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	observed := &observeState{
+		customResource: resource2,
+		typeData:       &namespacedvalidatingtype.NamespacedTypeData{},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+	state, err := analyze(observed, log)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), state.clientCABundle)
+
+	// a rotated CA is published without restarting
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, ioutil.WriteFile(caFile, []byte("second"), 0600))
+	assert.NoError(t, os.Chtimes(caFile, later, later))
+	changed, err = reloadClientCABundle()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	changed, err = reloadClientCABundle()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	state, err = analyze(observed, log)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second"), state.clientCABundle)
+}
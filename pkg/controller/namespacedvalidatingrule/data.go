@@ -19,27 +19,78 @@ package namespacedvalidatingrule
 import (
 	"bytes"
 	"encoding/gob"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
 
 	admregv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/common"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/tls_manager"
 )
 
 var (
 	EndpointData = &EndpointDataType{
 		Mapping: make(typeNamespaceMap),
 	}
+	// clientCAFile holds the CA bundle of the client certificate the proxy presents to webhooks
+	clientCAFile = tls_manager.NewFileReloader(filepath.Join(common.CertDir, common.ClientCAPem))
+	// clientCABundle is the []byte content of clientCAFile when last read, which rules publish in their status
+	clientCABundle atomic.Value
+	// clientCAChanges has all rules reconciled when the client CA bundle changes
+	clientCAChanges = make(chan event.GenericEvent, 1)
+	// proxyChanges are the rules whose webhooks the proxy saw change, failing over or disagreeing as shadows, for
+	// their status to report it
+	proxyChanges = make(chan event.GenericEvent, 100)
+	// typeSettings returns what the current types set on the webhooks called for op on resource
+	typeSettings = namespacedvalidatingtype.TypeSettings
 )
 
 type WebhookConfig struct {
+	// RuleName and Name identify the rule and webhook the config came from
+	RuleName      string
+	Name          string
 	ClientConfig  admregv1.WebhookClientConfig
 	FailurePolicy admregv1.FailurePolicyType
 	TimeoutSecs   int32
+	// UserInfo are the user matches of the webhook and of the types covering the request, all of which the request
+	// has to match for the webhook to be called
+	UserInfo []appv1alpha1.UserInfoMatch
+	// ResourceNames are the globs the name of the request's object has to match, if any
+	ResourceNames []string
+	// UpdateFilter selects the fields whose changes UPDATE requests are proxied for, if any
+	UpdateFilter *appv1alpha1.UpdateFilter
+	// NamespaceMetadata selects the namespace metadata added to the AdmissionReviews sent, nil when none is
+	NamespaceMetadata *appv1alpha1.NamespaceMetadataSelection
+	// Projection lists the fields of the objects sent, all of them are when empty
+	Projection []string
+	// Redactions are the types' redactions applied to the objects sent
+	Redactions []appv1alpha1.Redaction
+	// RequireMutualTLS fails calls the proxy has no client certificate for
+	RequireMutualTLS bool
+	// Order places the webhook among those called for a request, lower orders first
+	Order int32
+	// Evaluation is how the rule's webhooks are called, Parallel when empty
+	Evaluation appv1alpha1.EvaluationMode
+	// Decision combines the votes of the rule's webhooks, the namespace's strategy does when empty
+	Decision appv1alpha1.DecisionStrategy
+	// Retry retries the webhook's transient failures, nil when they aren't
+	Retry *appv1alpha1.RetryPolicy
+	// Failover are the targets tried after ClientConfig, in order
+	Failover []admregv1.WebhookClientConfig
+	// Backends receive their weight's percentage of the requests otherwise sent to ClientConfig
+	Backends []appv1alpha1.WeightedBackend
+	// Shadow webhooks are called without their verdict having a say
+	Shadow bool
 }
 
-type typeInstanceMap map[types.UID]WebhookConfig
+// typeInstanceMap maps a rule's uid to its webhooks by name, as several of a rule's webhooks may match the same request
+type typeInstanceMap map[types.UID]map[string]WebhookConfig
 type typeOpMap map[admregv1.OperationType]typeInstanceMap
 type typeResourceMap map[string]typeOpMap
 type typeVersionMap map[string]typeResourceMap
@@ -53,6 +104,11 @@ type EndpointDataType struct {
 func (p *EndpointDataType) Get(namespace string, resource metav1.GroupVersionResource, op admregv1.OperationType) []WebhookConfig {
 	var ret []WebhookConfig
 
+	// the types proxying the request may not let the namespace's rules see it
+	if !namespacedvalidatingtype.NamespacePermitted(namespace, resource, op) {
+		return nil
+	}
+
 	if groupMap, ok := p.Mapping[namespace]; ok {
 		groupList := []string{resource.Group, "*"}
 		var versionMapList []typeVersionMap
@@ -93,16 +149,51 @@ func (p *EndpointDataType) Get(namespace string, resource metav1.GroupVersionRes
 			}
 		}
 
+		// a webhook registered under both a request's own keys and wildcards is called once, with the config of its
+		// most specific keys, which come first
+		seen := make(map[types.UID]map[string]bool)
 		for _, instanceMap := range instanceMapList {
-			for _, webhookConfig := range instanceMap {
-				ret = append(ret, webhookConfig)
+			for uid, webhookMap := range instanceMap {
+				if seen[uid] == nil {
+					seen[uid] = make(map[string]bool)
+				}
+				for name, webhookConfig := range webhookMap {
+					if seen[uid][name] {
+						continue
+					}
+					seen[uid][name] = true
+					ret = append(ret, webhookConfig)
+				}
 			}
 		}
 	}
 
+	// the types' limits, user matches and redactions are those of the types covering the request, not of the keys the
+	// webhooks were found under
+	if len(ret) > 0 {
+		limits, userInfo, redactions := typeSettings(resource, op)
+		for i := range ret {
+			ret[i] = ret[i].limited(limits)
+			ret[i].UserInfo = append(append([]appv1alpha1.UserInfoMatch(nil), ret[i].UserInfo...), userInfo...)
+			ret[i].Redactions = redactions
+		}
+	}
+
+	// the maps are unordered, but the webhooks should always be called the same way
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Order != ret[j].Order {
+			return ret[i].Order < ret[j].Order
+		}
+		if ret[i].RuleName != ret[j].RuleName {
+			return ret[i].RuleName < ret[j].RuleName
+		}
+		return ret[i].Name < ret[j].Name
+	})
+
 	return ret
 }
 
+// Add registers t's webhooks, to which Get applies what the types covering each request set
 func (p *EndpointDataType) Add(t *appv1alpha1.NamespacedValidatingRule) *EndpointDataType {
 	newE := copyEndpointData(p)
 
@@ -118,50 +209,42 @@ func (p *EndpointDataType) Add(t *appv1alpha1.NamespacedValidatingRule) *Endpoin
 	groupMap := namespaceMap[t.Namespace]
 
 	for _, webhook := range t.Spec.Webhooks {
-		webhookConfig := createWebhookConfig(webhook, t.Namespace)
-
 		for _, webhookRule := range webhook.Rules {
-			var versionMapList []typeVersionMap
 			for _, group := range webhookRule.APIGroups {
 				versionMap, ok := groupMap[group]
 				if !ok {
 					groupMap[group] = make(typeVersionMap)
 					versionMap = groupMap[group]
 				}
-				versionMapList = append(versionMapList, versionMap)
-			}
-			var resourceMapList []typeResourceMap
-			for _, versionMap := range versionMapList {
 				for _, version := range webhookRule.APIVersions {
 					resourceMap, ok := versionMap[version]
 					if !ok {
 						versionMap[version] = make(typeResourceMap)
 						resourceMap = versionMap[version]
 					}
-					resourceMapList = append(resourceMapList, resourceMap)
-				}
-			}
-			var opMapList []typeOpMap
-			for _, resourceMap := range resourceMapList {
-				for _, resource := range webhookRule.Resources {
-					opMap, ok := resourceMap[resource]
-					if !ok {
-						resourceMap[resource] = make(typeOpMap)
-						opMap = resourceMap[resource]
+					for _, resource := range webhookRule.Resources {
+						opMap, ok := resourceMap[resource]
+						if !ok {
+							resourceMap[resource] = make(typeOpMap)
+							opMap = resourceMap[resource]
+						}
+						for _, op := range webhookRule.Operations {
+							instanceMap, ok := opMap[op]
+							if !ok {
+								opMap[op] = make(typeInstanceMap)
+								instanceMap = opMap[op]
+							}
+
+							if _, ok := instanceMap[t.UID]; !ok {
+								instanceMap[t.UID] = make(map[string]WebhookConfig)
+							}
+
+							config := createWebhookConfig(webhook, t.Name, t.Namespace)
+							config.Evaluation = t.Spec.Evaluation
+							config.Decision = t.Spec.Decision
+							instanceMap[t.UID][webhook.Name] = config
+						}
 					}
-					opMapList = append(opMapList, opMap)
-				}
-			}
-
-			for _, opMap := range opMapList {
-				for _, op := range webhookRule.Operations {
-					instanceMap, ok := opMap[op]
-					if !ok {
-						opMap[op] = make(typeInstanceMap)
-						instanceMap = opMap[op]
-					}
-
-					instanceMap[t.UID] = webhookConfig
 				}
 			}
 		}
@@ -170,11 +253,9 @@ func (p *EndpointDataType) Add(t *appv1alpha1.NamespacedValidatingRule) *Endpoin
 	return newE
 }
 
-func createWebhookConfig(webhook admregv1.ValidatingWebhook, namespace string) WebhookConfig {
-	var (
-		failurePolicy admregv1.FailurePolicyType
-		timeout       int32
-	)
+// createWebhookConfig returns the config webhook is called with, before the types' limits apply
+func createWebhookConfig(webhook appv1alpha1.NamespacedValidatingWebhook, ruleName, namespace string) WebhookConfig {
+	var failurePolicy admregv1.FailurePolicyType
 
 	if webhook.FailurePolicy == nil {
 		failurePolicy = admregv1.Fail
@@ -182,20 +263,111 @@ func createWebhookConfig(webhook admregv1.ValidatingWebhook, namespace string) W
 		failurePolicy = *webhook.FailurePolicy
 	}
 
-	if webhook.TimeoutSeconds == nil {
-		timeout = 30
-	} else {
-		timeout = *webhook.TimeoutSeconds
-	}
-
 	if webhook.ClientConfig.Service != nil && webhook.ClientConfig.Service.Namespace == "" {
 		webhook.ClientConfig.Service.Namespace = namespace
 	}
 
+	var failover []admregv1.WebhookClientConfig
+	for _, target := range webhook.Failover {
+		target = *target.DeepCopy()
+		if target.Service != nil && target.Service.Namespace == "" {
+			target.Service.Namespace = namespace
+		}
+		failover = append(failover, target)
+	}
+
+	var backends []appv1alpha1.WeightedBackend
+	for _, backend := range webhook.Backends {
+		backend = *backend.DeepCopy()
+		if backend.ClientConfig.Service != nil && backend.ClientConfig.Service.Namespace == "" {
+			backend.ClientConfig.Service.Namespace = namespace
+		}
+		backends = append(backends, backend)
+	}
+
+	var userInfo []appv1alpha1.UserInfoMatch
+	if webhook.UserInfo != nil {
+		userInfo = append(userInfo, *webhook.UserInfo)
+	}
+
 	return WebhookConfig{
-		ClientConfig:  webhook.ClientConfig,
-		FailurePolicy: failurePolicy,
-		TimeoutSecs:   timeout,
+		RuleName:          ruleName,
+		Name:              webhook.Name,
+		ClientConfig:      webhook.ClientConfig,
+		FailurePolicy:     failurePolicy,
+		TimeoutSecs:       WebhookTimeout(webhook.ValidatingWebhook),
+		UserInfo:          userInfo,
+		ResourceNames:     webhook.ResourceNames,
+		UpdateFilter:      webhook.UpdateFilter,
+		NamespaceMetadata: webhook.NamespaceMetadata,
+		Projection:        webhook.Projection,
+		RequireMutualTLS:  webhook.RequireMutualTLS,
+		Order:             webhook.Order,
+		Retry:             webhook.Retry,
+		Failover:          failover,
+		Backends:          backends,
+		Shadow:            webhook.Shadow,
+	}
+}
+
+// limited returns c with its failure policy and timeout clamped to limits
+func (c WebhookConfig) limited(limits appv1alpha1.WebhookLimits) WebhookConfig {
+	if limits.MaxFailurePolicy != nil && *limits.MaxFailurePolicy == admregv1.Ignore {
+		c.FailurePolicy = admregv1.Ignore
+	}
+	c.TimeoutSecs = clampTimeout(c.TimeoutSecs, limits)
+
+	return c
+}
+
+// WebhookTimeout returns the webhook's timeout in seconds, which defaults to the api server's maximum
+func WebhookTimeout(webhook admregv1.ValidatingWebhook) int32 {
+	if webhook.TimeoutSeconds == nil {
+		return 30
+	}
+
+	return *webhook.TimeoutSeconds
+}
+
+// ClampedTimeout returns the longest timeout webhook is called with, once clamped to the limits typeData's types set
+// on each of the resources it is proxied for
+func ClampedTimeout(webhook appv1alpha1.NamespacedValidatingWebhook, typeData *namespacedvalidatingtype.NamespacedTypeData) int32 {
+	timeoutSecs := WebhookTimeout(webhook.ValidatingWebhook)
+
+	var ret int32
+	for _, webhookRule := range webhook.Rules {
+		// the limits are those of the types covering each key a rule's wildcards stand for
+		accepted, rejected := SplitRule(webhookRule, typeData)
+		for _, rule := range append(accepted, rejected...) {
+			kind := &metav1.GroupVersionKind{Group: rule.APIGroups[0], Version: rule.APIVersions[0], Kind: rule.Resources[0]}
+			for _, op := range rule.Operations {
+				if clamped := clampTimeout(timeoutSecs, typeData.WebhookLimits(kind, op)); clamped > ret {
+					ret = clamped
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func clampTimeout(timeoutSecs int32, limits appv1alpha1.WebhookLimits) int32 {
+	if limits.MaxTimeoutSeconds != nil && timeoutSecs > *limits.MaxTimeoutSeconds {
+		return *limits.MaxTimeoutSeconds
+	}
+
+	return timeoutSecs
+}
+
+// requeue has the rule reconciled for its status to report what the proxy saw of its webhooks
+func requeue(namespace, rule string) {
+	select {
+	case proxyChanges <- event.GenericEvent{Object: &appv1alpha1.NamespacedValidatingRule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: rule},
+	}}:
+	default:
+		// the rule's status catches up on its next reconcile
+		log.Info("too many proxy changes to report, dropping one", "namespace", namespace, "rule", rule)
 	}
 }
 
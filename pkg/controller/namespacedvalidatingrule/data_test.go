@@ -23,8 +23,10 @@ import (
 
 	admregv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
 )
 
 const (
@@ -47,7 +49,7 @@ var (
 			Namespace: namespace,
 		},
 		Spec: v1alpha1.NamespacedValidatingRuleSpec{
-			Webhooks: []admregv1.ValidatingWebhook{{
+			Webhooks: []v1alpha1.NamespacedValidatingWebhook{{ValidatingWebhook: admregv1.ValidatingWebhook{
 				Name:         "resource1",
 				ClientConfig: admregv1.WebhookClientConfig{},
 				Rules: []admregv1.RuleWithOperations{{
@@ -58,7 +60,7 @@ var (
 						Resources:   []string{testResource1},
 					},
 				}},
-			}},
+			}}},
 		},
 	}
 
@@ -68,7 +70,7 @@ var (
 			Namespace: namespace,
 		},
 		Spec: v1alpha1.NamespacedValidatingRuleSpec{
-			Webhooks: []admregv1.ValidatingWebhook{{
+			Webhooks: []v1alpha1.NamespacedValidatingWebhook{{ValidatingWebhook: admregv1.ValidatingWebhook{
 				Name:         "resource1",
 				ClientConfig: admregv1.WebhookClientConfig{},
 				Rules: []admregv1.RuleWithOperations{{
@@ -79,7 +81,7 @@ var (
 						Resources:   []string{testResource1},
 					},
 				}},
-			}},
+			}}},
 		},
 	}
 
@@ -89,7 +91,7 @@ var (
 			Namespace: namespace,
 		},
 		Spec: v1alpha1.NamespacedValidatingRuleSpec{
-			Webhooks: []admregv1.ValidatingWebhook{{
+			Webhooks: []v1alpha1.NamespacedValidatingWebhook{{ValidatingWebhook: admregv1.ValidatingWebhook{
 				Name: "resource2",
 				ClientConfig: admregv1.WebhookClientConfig{
 					Service:  &admregv1.ServiceReference{Namespace: namespace},
@@ -103,7 +105,7 @@ var (
 						Resources:   []string{testResource1},
 					},
 				}},
-			}},
+			}}},
 		},
 	}
 
@@ -113,7 +115,7 @@ var (
 			Namespace: namespace,
 		},
 		Spec: v1alpha1.NamespacedValidatingRuleSpec{
-			Webhooks: []admregv1.ValidatingWebhook{{
+			Webhooks: []v1alpha1.NamespacedValidatingWebhook{{ValidatingWebhook: admregv1.ValidatingWebhook{
 				Name: "resource2",
 				ClientConfig: admregv1.WebhookClientConfig{
 					Service:  &admregv1.ServiceReference{},
@@ -127,7 +129,7 @@ var (
 						Resources:   []string{testResource1},
 					},
 				}},
-			}},
+			}}},
 		},
 	}
 )
@@ -235,3 +237,214 @@ func TestRuleNoNamespace(t *testing.T) {
 	assert.Len(t, w, 1)
 	assert.Equal(t, w[0].ClientConfig.Service.Namespace, namespace)
 }
+
+func TestGetSeveralWebhooks(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Name = "rule"
+	second := rule.Spec.Webhooks[0].DeepCopy()
+	second.Name = "another"
+	rule.Spec.Webhooks = append(rule.Spec.Webhooks, *second)
+
+	newE := (&EndpointDataType{}).Add(rule)
+	w := newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1)
+	assert.Len(t, w, 2)
+	assert.Equal(t, "another", w[0].Name)
+	assert.Equal(t, "resource2", w[1].Name)
+	assert.Equal(t, "rule", w[0].RuleName)
+}
+
+func TestGetWildcardDuplicates(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Name = "rule"
+	webhookRule := &rule.Spec.Webhooks[0].Rules[0]
+	webhookRule.APIGroups = append(webhookRule.APIGroups, "*")
+	webhookRule.Resources = append(webhookRule.Resources, "*")
+	webhookRule.Operations = append(webhookRule.Operations, admregv1.OperationAll)
+	second := rule.Spec.Webhooks[0].DeepCopy()
+	second.Name = "another"
+	second.Rules = append(second.Rules, admregv1.RuleWithOperations{
+		Operations: []admregv1.OperationType{testOp1},
+		Rule:       admregv1.Rule{APIGroups: []string{"*"}, APIVersions: []string{"*"}, Resources: []string{"*"}},
+	})
+	rule.Spec.Webhooks = append(rule.Spec.Webhooks, *second)
+
+	// each webhook is returned once, however many of its keys the request matches
+	newE := (&EndpointDataType{}).Add(rule)
+	w := newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1)
+	if assert.Len(t, w, 2) {
+		assert.Equal(t, "another", w[0].Name)
+		assert.Equal(t, "resource2", w[1].Name)
+	}
+
+	w = newE.Get(namespace, metav1.GroupVersionResource{Group: "otherGroup", Version: testVersion1, Resource: "other"}, testOp1)
+	if assert.Len(t, w, 2) {
+		assert.Equal(t, "another", w[0].Name)
+		assert.Equal(t, "resource2", w[1].Name)
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	first := resource2.DeepCopy()
+	first.Name = "b"
+	first.Spec.Evaluation = v1alpha1.EvaluationSequential
+	first.Spec.Decision = v1alpha1.DecisionMajority
+	first.Spec.Webhooks[0].Order = -1
+	second := first.Spec.Webhooks[0].DeepCopy()
+	second.Name = "later"
+	second.Order = 1
+	first.Spec.Webhooks = append(first.Spec.Webhooks, *second)
+
+	other := resource1.DeepCopy()
+	other.Name = "a"
+
+	newE := (&EndpointDataType{}).Add(first).Add(other)
+	w := newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1)
+	if assert.Len(t, w, 3) {
+		assert.Equal(t, []string{"b/resource2", "a/resource1", "b/later"},
+			[]string{w[0].RuleName + "/" + w[0].Name, w[1].RuleName + "/" + w[1].Name, w[2].RuleName + "/" + w[2].Name})
+		assert.Equal(t, v1alpha1.EvaluationSequential, w[0].Evaluation)
+		assert.Equal(t, v1alpha1.DecisionMajority, w[0].Decision)
+		assert.Equal(t, v1alpha1.EvaluationMode(""), w[1].Evaluation)
+	}
+}
+
+func TestAddWebhookLimits(t *testing.T) {
+	ignore := admregv1.Ignore
+	five := int32(5)
+
+	limited := &v1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: uid1, Name: "type"},
+		Spec: v1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{testOp1, testOp2},
+				Rule: admregv1.Rule{
+					APIGroups:   []string{testGroup1},
+					APIVersions: []string{testVersion1},
+					Resources:   []string{testResource1},
+				},
+			}},
+			WebhookLimits: &v1alpha1.WebhookLimits{MaxTimeoutSeconds: &five, IgnoreOperations: []admregv1.OperationType{testOp2}},
+		},
+	}
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(limited)
+
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].Rules[0].Operations = []admregv1.OperationType{testOp1, testOp2}
+
+	defer useTypes(typeData)()
+
+	newE := (&EndpointDataType{}).Add(rule)
+	gvr := metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}
+
+	w := newE.Get(namespace, gvr, testOp1)
+	assert.Len(t, w, 1)
+	assert.Equal(t, admregv1.Fail, w[0].FailurePolicy)
+	assert.Equal(t, five, w[0].TimeoutSecs)
+
+	w = newE.Get(namespace, gvr, testOp2)
+	assert.Len(t, w, 1)
+	assert.Equal(t, ignore, w[0].FailurePolicy)
+}
+
+func TestAddUserInfo(t *testing.T) {
+	exempt := &v1alpha1.UserInfoMatch{Exclude: &v1alpha1.UserInfoSubjects{Groups: []string{"system:masters"}}}
+	humans := &v1alpha1.UserInfoMatch{Exclude: &v1alpha1.UserInfoSubjects{ServiceAccounts: []string{"*/*"}}}
+
+	typeResource := &v1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: uid1, Name: "type"},
+		Spec: v1alpha1.NamespacedValidatingTypeSpec{
+			Types:      resource2.Spec.Webhooks[0].Rules,
+			UserInfo:   exempt,
+			Redactions: []v1alpha1.Redaction{{Path: "data"}},
+		},
+	}
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(typeResource)
+
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].UserInfo = humans
+	rule.Spec.Webhooks[0].ResourceNames = []string{"billing-*"}
+	rule.Spec.Webhooks[0].Projection = []string{"spec"}
+
+	defer useTypes(typeData)()
+
+	w := (&EndpointDataType{}).Add(rule).Get(namespace,
+		metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1)
+	assert.Len(t, w, 1)
+	assert.Equal(t, []v1alpha1.UserInfoMatch{*humans, *exempt}, w[0].UserInfo)
+	assert.Equal(t, []string{"billing-*"}, w[0].ResourceNames)
+	assert.Equal(t, []string{"spec"}, w[0].Projection)
+	assert.Equal(t, typeResource.Spec.Redactions, w[0].Redactions)
+}
+
+func TestGetWildcardTypeSettings(t *testing.T) {
+	exempt := &v1alpha1.UserInfoMatch{Exclude: &v1alpha1.UserInfoSubjects{Groups: []string{"system:masters"}}}
+	five := int32(5)
+
+	typeOn := func(uid types.UID, resource string) *v1alpha1.NamespacedValidatingType {
+		return &v1alpha1.NamespacedValidatingType{
+			ObjectMeta: metav1.ObjectMeta{UID: uid, Name: resource},
+			Spec: v1alpha1.NamespacedValidatingTypeSpec{
+				Types: []admregv1.RuleWithOperations{{
+					Operations: []admregv1.OperationType{testOp1},
+					Rule:       admregv1.Rule{APIGroups: []string{testGroup1}, APIVersions: []string{"*"}, Resources: []string{resource}},
+				}},
+			},
+		}
+	}
+	secrets := typeOn(uid1, "secrets")
+	secrets.Spec.UserInfo = exempt
+	secrets.Spec.Redactions = []v1alpha1.Redaction{{Path: "data"}}
+	secrets.Spec.WebhookLimits = &v1alpha1.WebhookLimits{MaxTimeoutSeconds: &five}
+	// a type on all of a version's resources overlaps the secrets one without being covered by it
+	everything := typeOn(uid2, "*")
+	everything.Spec.Types[0].APIVersions = []string{testVersion1}
+	defer useTypes((&namespacedvalidatingtype.NamespacedTypeData{}).Add(secrets).Add(everything))()
+
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].Rules[0].Resources = []string{"*"}
+	newE := (&EndpointDataType{}).Add(rule)
+
+	// what the secrets type sets only applies to secrets, whichever of the rule's keys the webhook is found under
+	w := newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: "pods"}, testOp1)
+	if assert.Len(t, w, 1) {
+		assert.Empty(t, w[0].UserInfo)
+		assert.Empty(t, w[0].Redactions)
+		assert.Equal(t, int32(30), w[0].TimeoutSecs)
+	}
+
+	w = newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: "secrets"}, testOp1)
+	if assert.Len(t, w, 1) {
+		assert.Equal(t, []v1alpha1.UserInfoMatch{*exempt}, w[0].UserInfo)
+		assert.Equal(t, secrets.Spec.Redactions, w[0].Redactions)
+		assert.Equal(t, five, w[0].TimeoutSecs)
+	}
+}
+
+// useTypes has Get apply what typeData's types set, until the returned func restores the current types
+func useTypes(typeData *namespacedvalidatingtype.NamespacedTypeData) func() {
+	saved := typeSettings
+	typeSettings = func(resource metav1.GroupVersionResource, op admregv1.OperationType) (v1alpha1.WebhookLimits, []v1alpha1.UserInfoMatch, []v1alpha1.Redaction) {
+		kind := &metav1.GroupVersionKind{Group: resource.Group, Version: resource.Version, Kind: resource.Resource}
+		return typeData.WebhookLimits(kind, op), typeData.UserInfo(kind, op), typeData.Redactions(kind, op)
+	}
+
+	return func() { typeSettings = saved }
+}
+
+func TestAddBackends(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].Backends = []v1alpha1.WeightedBackend{{
+		Name:         "canary",
+		Weight:       10,
+		ClientConfig: admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Name: "canary"}},
+	}}
+
+	newE := (&EndpointDataType{}).Add(rule)
+	w := newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1)
+	if assert.Len(t, w, 1) && assert.Len(t, w[0].Backends, 1) {
+		assert.Equal(t, int32(10), w[0].Backends[0].Weight)
+		assert.Equal(t, namespace, w[0].Backends[0].ClientConfig.Service.Namespace)
+	}
+	// the rule itself is untouched
+	assert.Empty(t, rule.Spec.Webhooks[0].Backends[0].ClientConfig.Service.Namespace)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"fmt"
+	"sync"
+)
+
+// activeTargets are the targets the proxy last reached the webhooks with failover targets at, by namespace, rule and
+// webhook name.  Target 0 is a webhook's clientConfig, and target i its i-th failover target.
+var activeTargets = struct {
+	mu      sync.Mutex
+	targets map[webhookKey]int
+}{targets: make(map[webhookKey]int)}
+
+// webhookKey identifies a webhook by its namespace, rule and name
+type webhookKey struct {
+	namespace, rule, webhook string
+}
+
+// ActiveTarget returns the target the proxy last reached the webhook at, 0 if it never failed over
+func ActiveTarget(namespace, rule, webhook string) int {
+	activeTargets.mu.Lock()
+	defer activeTargets.mu.Unlock()
+
+	return activeTargets.targets[webhookKey{namespace, rule, webhook}]
+}
+
+// SetActiveTarget records the target the proxy reached the webhook at, requeuing its rule when it changed
+func SetActiveTarget(namespace, rule, webhook string, target int) {
+	activeTargets.mu.Lock()
+	key := webhookKey{namespace, rule, webhook}
+	changed := activeTargets.targets[key] != target
+	activeTargets.targets[key] = target
+	activeTargets.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.Info("webhook failed over", "namespace", namespace, "rule", rule, "webhook", webhook, "target", TargetName(target))
+	requeue(namespace, rule)
+}
+
+// forgetTargets drops the active targets of a deleted rule's webhooks
+func forgetTargets(namespace, rule string) {
+	activeTargets.mu.Lock()
+	defer activeTargets.mu.Unlock()
+
+	for key := range activeTargets.targets {
+		if key.namespace == namespace && key.rule == rule {
+			delete(activeTargets.targets, key)
+		}
+	}
+}
+
+// TargetName returns the field of a webhook target i is
+func TargetName(i int) string {
+	if i == 0 {
+		return "clientConfig"
+	}
+
+	return fmt.Sprintf("failover[%v]", i-1)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+)
+
+func TestActiveTarget(t *testing.T) {
+	defer forgetTargets(namespace, "rule")
+
+	assert.Equal(t, 0, ActiveTarget(namespace, "rule", "webhook"))
+
+	SetActiveTarget(namespace, "rule", "webhook", 2)
+	assert.Equal(t, 2, ActiveTarget(namespace, "rule", "webhook"))
+	if assert.Len(t, proxyChanges, 1) {
+		e := <-proxyChanges
+		assert.Equal(t, namespace, e.Object.GetNamespace())
+		assert.Equal(t, "rule", e.Object.GetName())
+	}
+
+	// the rule is only requeued when the target changes
+	SetActiveTarget(namespace, "rule", "webhook", 2)
+	assert.Len(t, proxyChanges, 0)
+
+	forgetTargets(namespace, "rule")
+	assert.Equal(t, 0, ActiveTarget(namespace, "rule", "webhook"))
+}
+
+func TestTargetName(t *testing.T) {
+	assert.Equal(t, "clientConfig", TargetName(0))
+	assert.Equal(t, "failover[1]", TargetName(2))
+}
+
+func TestAnalyzeWebhookActiveTarget(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Name = "rule"
+	webhook := rule.Spec.Webhooks[0]
+	webhook.Failover = []admregv1.WebhookClientConfig{{Service: &admregv1.ServiceReference{Name: "new"}}}
+
+	observed := &observeState{
+		customResource: rule,
+		typeData:       &namespacedvalidatingtype.NamespacedTypeData{},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+	assert.Equal(t, "clientConfig", analyzeWebhook(webhook, observed).ActiveTarget)
+
+	defer forgetTargets(namespace, "rule")
+	SetActiveTarget(namespace, "rule", webhook.Name, 1)
+	<-proxyChanges
+	assert.Equal(t, "failover[0]", analyzeWebhook(webhook, observed).ActiveTarget)
+
+	// webhooks without failover targets don't report one
+	webhook.Failover = nil
+	assert.Empty(t, analyzeWebhook(webhook, observed).ActiveTarget)
+}
+
+func TestAddFailover(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Spec.Webhooks[0].Failover = []admregv1.WebhookClientConfig{{Service: &admregv1.ServiceReference{Name: "new"}}}
+
+	newE := (&EndpointDataType{}).Add(rule)
+	w := newE.Get(namespace, metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testResource1}, testOp1)
+	if assert.Len(t, w, 1) && assert.Len(t, w[0].Failover, 1) {
+		assert.Equal(t, namespace, w[0].Failover[0].Service.Namespace)
+	}
+	// the rule itself is untouched
+	assert.Empty(t, rule.Spec.Webhooks[0].Failover[0].Service.Namespace)
+}
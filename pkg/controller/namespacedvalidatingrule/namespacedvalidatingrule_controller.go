@@ -17,13 +17,21 @@ limitations under the License.
 package namespacedvalidatingrule
 
 import (
+	"bytes"
 	"context"
+	"time"
 
 	"github.com/operator-framework/operator-lib/handler"
 	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	crhandler "sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -32,15 +40,83 @@ import (
 
 var log = logf.Log.WithName("controller_namespacedvalidatingrule")
 
+// clientCAInterval is how often the client CA bundle is checked for changes
+const clientCAInterval = time.Minute
+
 // Add creates a new NamespacedValidatingRule Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	if _, err := reloadClientCABundle(); err != nil {
+		return err
+	}
+
+	err := add(mgr, newReconciler(mgr))
+	if err != nil {
+		return err
+	}
+
+	return mgr.Add(manager.RunnableFunc(watchClientCABundle))
+}
+
+// watchClientCABundle reads the client CA bundle again every clientCAInterval, having all rules reconciled when it
+// changed for their status to publish the new bundle
+func watchClientCABundle(ctx context.Context) error {
+	ticker := time.NewTicker(clientCAInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		changed, err := reloadClientCABundle()
+		if err != nil {
+			log.Error(err, "client CA bundle reload failed")
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		log.Info("client CA bundle changed, reconciling all rules")
+		select {
+		case clientCAChanges <- event.GenericEvent{Object: &appv1alpha1.NamespacedValidatingRule{}}:
+		default:
+			// all rules are already about to be reconciled
+		}
+	}
+}
+
+// reloadClientCABundle reads the client CA bundle, returning true if it changed since it last was
+func reloadClientCABundle() (bool, error) {
+	bundle, err := clientCAFile.Load()
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(bundle, currentClientCABundle()) {
+		return false, nil
+	}
+	clientCABundle.Store(bundle)
+
+	return true, nil
+}
+
+// currentClientCABundle returns the client CA bundle as last read, nil before it is
+func currentClientCABundle() []byte {
+	bundle, _ := clientCABundle.Load().([]byte)
+	return bundle
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileNamespacedValidatingRule{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileNamespacedValidatingRule{
+		client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor("namespacedvalidatingrule-controller"),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -57,9 +133,154 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// A rule's status reflects the services it points at
+	referencingRules := crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return rulesReferencing(mgr.GetClient(), o.GetNamespace(), o.GetName())
+		},
+	)
+
+	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, referencingRules)
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Endpoints{}}, referencingRules)
+	if err != nil {
+		return err
+	}
+
+	// and the types that cover it
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.NamespacedValidatingType{}}, crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return allRules(mgr.GetClient())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
+	// and the labels of its namespace, which types may select on
+	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return rulesInNamespace(mgr.GetClient(), o.GetName())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
+	// and the grants that let it use services in other namespaces
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.WebhookServiceGrant{}}, crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return rulesReferencingNamespace(mgr.GetClient(), o.GetNamespace())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
+	// and the bundle of the client CA its webhooks verify the proxy with
+	err = c.Watch(&source.Channel{Source: clientCAChanges}, crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return allRules(mgr.GetClient())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
+	// and what the proxy sees of its webhooks
+	err = c.Watch(&source.Channel{Source: proxyChanges}, &crhandler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+func listRules(c client.Client) []appv1alpha1.NamespacedValidatingRule {
+	ruleList := &appv1alpha1.NamespacedValidatingRuleList{}
+	err := c.List(context.TODO(), ruleList)
+	if err != nil {
+		log.Error(err, "rule list failed")
+		return nil
+	}
+
+	return ruleList.Items
+}
+
+func allRules(c client.Client) []reconcile.Request {
+	var ret []reconcile.Request
+	for _, rule := range listRules(c) {
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rule.Namespace, Name: rule.Name}})
+	}
+
+	return ret
+}
+
+func rulesInNamespace(c client.Client, namespace string) []reconcile.Request {
+	ruleList := &appv1alpha1.NamespacedValidatingRuleList{}
+	err := c.List(context.TODO(), ruleList, client.InNamespace(namespace))
+	if err != nil {
+		log.Error(err, "rule list failed")
+		return nil
+	}
+
+	var ret []reconcile.Request
+	for _, rule := range ruleList.Items {
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rule.Namespace, Name: rule.Name}})
+	}
+
+	return ret
+}
+
+// rulesReferencing returns the rules with a webhook pointing at the given service
+func rulesReferencing(c client.Client, namespace, name string) []reconcile.Request {
+	var ret []reconcile.Request
+
+	for _, rule := range listRules(c) {
+		if referencesService(rule, func(service *admregv1.ServiceReference) bool {
+			return serviceKey(service.Namespace, service.Name, rule.Namespace) == types.NamespacedName{Namespace: namespace, Name: name}
+		}) {
+			ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rule.Namespace, Name: rule.Name}})
+		}
+	}
+
+	return ret
+}
+
+// rulesReferencingNamespace returns the rules with a webhook pointing at a service in another namespace, namespace
+func rulesReferencingNamespace(c client.Client, namespace string) []reconcile.Request {
+	var ret []reconcile.Request
+
+	for _, rule := range listRules(c) {
+		if rule.Namespace == namespace {
+			continue
+		}
+
+		if referencesService(rule, func(service *admregv1.ServiceReference) bool { return service.Namespace == namespace }) {
+			ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rule.Namespace, Name: rule.Name}})
+		}
+	}
+
+	return ret
+}
+
+// referencesService returns true if match matches the service of any of rule's client configs, be it a webhook's
+// clientConfig, backend or failover target
+func referencesService(rule appv1alpha1.NamespacedValidatingRule, match func(service *admregv1.ServiceReference) bool) bool {
+	for _, webhook := range rule.Spec.Webhooks {
+		for _, clientConfig := range clientConfigs(webhook) {
+			if clientConfig.Service != nil && match(clientConfig.Service) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // blank assignment to verify that ReconcileNamespacedValidatingRule implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileNamespacedValidatingRule{}
 
@@ -67,8 +288,9 @@ var _ reconcile.Reconciler = &ReconcileNamespacedValidatingRule{}
 type ReconcileNamespacedValidatingRule struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for a NamespacedValidatingRule object and makes changes based on the state read
@@ -94,10 +316,10 @@ func (r *ReconcileNamespacedValidatingRule) Reconcile(ctx context.Context, reque
 		return reconcile.Result{}, err
 	}
 
-	err = act(r.client, analyzedState, reqLogger)
+	err = act(r.client, r.recorder, analyzedState, reqLogger)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: analyzedState.requeueAfter}, nil
 }
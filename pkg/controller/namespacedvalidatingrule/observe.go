@@ -18,26 +18,190 @@ package namespacedvalidatingrule
 
 import (
 	"context"
+	"time"
+
 	"github.com/go-logr/logr"
-	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/bypass"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
 )
 
 type observeState struct {
 	customResource *v1alpha1.NamespacedValidatingRule
+	typeData       *namespacedvalidatingtype.NamespacedTypeData
+	// namespaceLabels are the labels of the rule's namespace, which types may select on
+	namespaceLabels map[string]string
+	// namespaceBypass is the bypass of the rule's namespace, nil when it has none or namespaceBypassErr is set
+	namespaceBypass    *bypass.Bypass
+	namespaceBypassErr error
+	// now is when the rule was observed, which bypasses are checked against
+	now time.Time
+	// creator is the user recorded as the rule's creator, nil when unknown
+	creator *authenticationv1.UserInfo
+	// usableTypes holds whether the creator may use each of the types covering the rule that require it
+	usableTypes map[string]bool
+	// grantData holds the grants of the other namespaces the rule's webhooks point at
+	grantData *webhookservicegrant.GrantDataType
+	// services and endpoints referenced by the rule's webhooks, nil when they don't exist
+	services  map[types.NamespacedName]*corev1.Service
+	endpoints map[types.NamespacedName]*corev1.Endpoints
 }
 
 func observe(kubeClient client.Client, request reconcile.Request, logger logr.Logger) (*observeState, error) {
 	ret := &observeState{
 		customResource: &v1alpha1.NamespacedValidatingRule{},
+		now:            time.Now(),
+		services:       make(map[types.NamespacedName]*corev1.Service),
+		endpoints:      make(map[types.NamespacedName]*corev1.Endpoints),
 	}
 
 	err := kubeClient.Get(context.TODO(), request.NamespacedName, ret.customResource)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.V(2).Info("didn't find resource")
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// build the coverage from the types themselves, rather than depend on the type controller having run first
+	typeList := &v1alpha1.NamespacedValidatingTypeList{}
+	err = kubeClient.List(context.TODO(), typeList)
+	if err != nil {
+		logger.Error(err, "type list failed")
+		return nil, err
+	}
+	ret.typeData = namespacedvalidatingtype.NewNamespacedTypeData(typeList.Items)
+
+	ns := &corev1.Namespace{}
+	err = kubeClient.Get(context.TODO(), types.NamespacedName{Name: ret.customResource.Namespace}, ns)
+	if err != nil {
+		logger.Error(err, "namespace retrieval failed")
 		return nil, err
 	}
+	ret.namespaceLabels = ns.Labels
+	ret.namespaceBypass, ret.namespaceBypassErr = bypass.Parse(ns.Annotations)
+
+	var rules []admregv1.RuleWithOperations
+	for _, webhook := range ret.customResource.Spec.Webhooks {
+		rules = append(rules, webhook.Rules...)
+	}
+
+	useRequiringTypes := UseRequiringTypes(rules, ret.typeData)
+	if len(useRequiringTypes) > 0 {
+		ret.creator, err = Creator(ret.customResource)
+		if err != nil {
+			// an unreadable creator is treated as an unknown one
+			logger.Error(err, "creator retrieval failed")
+		}
+
+		ret.usableTypes = make(map[string]bool)
+		for _, name := range useRequiringTypes {
+			if ret.creator == nil {
+				ret.usableTypes[name] = false
+				continue
+			}
+
+			ret.usableTypes[name], err = CheckUse(context.TODO(), kubeClient, ret.creator, name)
+			if err != nil {
+				logger.Error(err, "subject access review failed", "Type", name)
+				return nil, err
+			}
+		}
+	}
+
+	// only the grants of namespaces the rule points into matter
+	var grants []v1alpha1.WebhookServiceGrant
+	grantNamespaces := make(map[string]bool)
+	for _, webhook := range ret.customResource.Spec.Webhooks {
+		for _, clientConfig := range clientConfigs(webhook) {
+			if clientConfig.Service == nil {
+				continue
+			}
+
+			key := serviceKey(clientConfig.Service.Namespace, clientConfig.Service.Name, ret.customResource.Namespace)
+			if key.Namespace == ret.customResource.Namespace || grantNamespaces[key.Namespace] {
+				continue
+			}
+			grantNamespaces[key.Namespace] = true
+
+			grantList := &v1alpha1.WebhookServiceGrantList{}
+			err = kubeClient.List(context.TODO(), grantList, client.InNamespace(key.Namespace))
+			if err != nil {
+				logger.Error(err, "grant list failed")
+				return nil, err
+			}
+			grants = append(grants, grantList.Items...)
+		}
+	}
+	ret.grantData = webhookservicegrant.NewGrantData(grants)
+
+	for _, webhook := range ret.customResource.Spec.Webhooks {
+		if webhook.ClientConfig.Service == nil {
+			continue
+		}
+
+		key := serviceKey(webhook.ClientConfig.Service.Namespace, webhook.ClientConfig.Service.Name, ret.customResource.Namespace)
+		if _, ok := ret.services[key]; ok {
+			continue
+		}
+
+		// a service the rule isn't granted isn't looked at, so its state isn't exposed in the rule's status
+		if !ret.grantData.Allowed(ret.customResource.Namespace, key) {
+			continue
+		}
+
+		service := &corev1.Service{}
+		err = kubeClient.Get(context.TODO(), key, service)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				logger.Error(err, "service retrieval failed")
+				return nil, err
+			}
+			service = nil
+		}
+		ret.services[key] = service
+
+		endpoints := &corev1.Endpoints{}
+		err = kubeClient.Get(context.TODO(), key, endpoints)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				logger.Error(err, "endpoints retrieval failed")
+				return nil, err
+			}
+			endpoints = nil
+		}
+		ret.endpoints[key] = endpoints
+	}
 
 	return ret, nil
 }
 
+// clientConfigs returns all the client configs of webhook: its clientConfig, then those of its backends and its
+// failover targets
+func clientConfigs(webhook v1alpha1.NamespacedValidatingWebhook) []admregv1.WebhookClientConfig {
+	ret := []admregv1.WebhookClientConfig{webhook.ClientConfig}
+	for _, backend := range webhook.Backends {
+		ret = append(ret, backend.ClientConfig)
+	}
+
+	return append(ret, webhook.Failover...)
+}
+
+// serviceKey returns the name of a webhook's service, which defaults to the rule's namespace
+func serviceKey(namespace, name, ruleNamespace string) types.NamespacedName {
+	if namespace == "" {
+		namespace = ruleNamespace
+	}
+
+	return types.NamespacedName{Namespace: namespace, Name: name}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"encoding/json"
+
+	admv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MatchesResourceName returns true if the name of request's object matches any of globs, or there are none
+func MatchesResourceName(globs []string, request *admv1.AdmissionRequest) bool {
+	if len(globs) == 0 {
+		return true
+	}
+
+	name := request.Name
+	if name == "" {
+		name = generateName(request)
+	}
+
+	return name != "" && matchesAny(globs, name)
+}
+
+// generateName returns the generateName of the object being created by request, empty if it has none
+func generateName(request *admv1.AdmissionRequest) string {
+	if request.Operation != admv1.Create || len(request.Object.Raw) == 0 {
+		return ""
+	}
+
+	object := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(request.Object.Raw, object); err != nil {
+		return ""
+	}
+
+	if object.Name != "" {
+		return object.Name
+	}
+
+	return object.GenerateName
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMatchesResourceName(t *testing.T) {
+	globs := []string{"billing-*", "config"}
+
+	named := &admv1.AdmissionRequest{Name: "billing-db", Operation: admv1.Update}
+	assert.True(t, MatchesResourceName(nil, named))
+	assert.True(t, MatchesResourceName(globs, named))
+
+	named.Name = "frontend"
+	assert.False(t, MatchesResourceName(globs, named))
+
+	generated := &admv1.AdmissionRequest{
+		Operation: admv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(`{"metadata":{"generateName":"billing-"}}`)},
+	}
+	assert.True(t, MatchesResourceName(globs, generated))
+
+	generated.Object.Raw = []byte(`{"metadata":{"generateName":"frontend-"}}`)
+	assert.False(t, MatchesResourceName(globs, generated))
+
+	generated.Object.Raw = []byte(`not json`)
+	assert.False(t, MatchesResourceName(globs, generated))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+// shadowVerdicts compare the verdicts of shadow webhooks with those enforced since the proxy started
+var shadowVerdicts = struct {
+	mu       sync.Mutex
+	verdicts map[webhookKey]appv1alpha1.ShadowStatus
+}{verdicts: make(map[webhookKey]appv1alpha1.ShadowStatus)}
+
+// RecordShadowVerdict records whether a shadow webhook agreed with the verdict enforced on a request, requeuing its
+// rule when it didn't for its status and events to report it
+func RecordShadowVerdict(namespace, rule, webhook string, agreed bool, message string, now time.Time) {
+	shadowVerdicts.mu.Lock()
+	key := webhookKey{namespace, rule, webhook}
+	status := shadowVerdicts.verdicts[key]
+	if agreed {
+		status.Agreements++
+	} else {
+		status.Disagreements++
+		status.LastDisagreementTime = &metav1.Time{Time: now}
+		status.LastDisagreement = message
+	}
+	shadowVerdicts.verdicts[key] = status
+	shadowVerdicts.mu.Unlock()
+
+	if !agreed {
+		requeue(namespace, rule)
+	}
+}
+
+// RecordShadowFailure records a shadow webhook failing to decide a request
+func RecordShadowFailure(namespace, rule, webhook string) {
+	shadowVerdicts.mu.Lock()
+	defer shadowVerdicts.mu.Unlock()
+
+	key := webhookKey{namespace, rule, webhook}
+	status := shadowVerdicts.verdicts[key]
+	status.Failures++
+	shadowVerdicts.verdicts[key] = status
+}
+
+// shadowStatus returns how the shadow webhook's verdicts compared with those enforced
+func shadowStatus(namespace, rule, webhook string) *appv1alpha1.ShadowStatus {
+	shadowVerdicts.mu.Lock()
+	defer shadowVerdicts.mu.Unlock()
+
+	status := shadowVerdicts.verdicts[webhookKey{namespace, rule, webhook}]
+	return status.DeepCopy()
+}
+
+// forgetShadowVerdicts drops the verdicts of a deleted rule's shadow webhooks
+func forgetShadowVerdicts(namespace, rule string) {
+	shadowVerdicts.mu.Lock()
+	defer shadowVerdicts.mu.Unlock()
+
+	for key := range shadowVerdicts.verdicts {
+		if key.namespace == namespace && key.rule == rule {
+			delete(shadowVerdicts.verdicts, key)
+		}
+	}
+}
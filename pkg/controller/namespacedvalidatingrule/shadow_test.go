@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+)
+
+func TestRecordShadowVerdict(t *testing.T) {
+	defer forgetShadowVerdicts(namespace, "rule")
+	now := time.Now()
+
+	RecordShadowVerdict(namespace, "rule", "webhook", true, "", now)
+	RecordShadowFailure(namespace, "rule", "webhook")
+	assert.Len(t, proxyChanges, 0)
+
+	RecordShadowVerdict(namespace, "rule", "webhook", false, "denied", now)
+	if assert.Len(t, proxyChanges, 1) {
+		e := <-proxyChanges
+		assert.Equal(t, namespace, e.Object.GetNamespace())
+		assert.Equal(t, "rule", e.Object.GetName())
+	}
+
+	status := shadowStatus(namespace, "rule", "webhook")
+	assert.Equal(t, int64(1), status.Agreements)
+	assert.Equal(t, int64(1), status.Disagreements)
+	assert.Equal(t, int64(1), status.Failures)
+	assert.Equal(t, "denied", status.LastDisagreement)
+	if assert.NotNil(t, status.LastDisagreementTime) {
+		assert.True(t, now.Equal(status.LastDisagreementTime.Time))
+	}
+
+	forgetShadowVerdicts(namespace, "rule")
+	assert.Equal(t, &v1alpha1.ShadowStatus{}, shadowStatus(namespace, "rule", "webhook"))
+}
+
+func TestAnalyzeWebhookShadow(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Name = "rule"
+	webhook := rule.Spec.Webhooks[0]
+
+	observed := &observeState{
+		customResource: rule,
+		typeData:       &namespacedvalidatingtype.NamespacedTypeData{},
+		services:       map[types.NamespacedName]*corev1.Service{},
+		endpoints:      map[types.NamespacedName]*corev1.Endpoints{},
+	}
+	assert.Nil(t, analyzeWebhook(webhook, observed).Shadow)
+
+	defer forgetShadowVerdicts(namespace, "rule")
+	RecordShadowVerdict(namespace, "rule", webhook.Name, true, "", time.Now())
+	webhook.Shadow = true
+	assert.Equal(t, &v1alpha1.ShadowStatus{Agreements: 1}, analyzeWebhook(webhook, observed).Shadow)
+}
+
+func TestManageShadows(t *testing.T) {
+	rule := resource2.DeepCopy()
+	rule.Status.Webhooks = []v1alpha1.WebhookStatus{{Name: "webhook", Shadow: &v1alpha1.ShadowStatus{Disagreements: 1}}}
+	state := &analyzedState{
+		customResource: rule,
+		webhookStatus:  []v1alpha1.WebhookStatus{{Name: "webhook", Shadow: &v1alpha1.ShadowStatus{Disagreements: 1}}},
+	}
+	recorder := record.NewFakeRecorder(10)
+
+	manageShadows(recorder, state, logr.Discard())
+	assert.Len(t, recorder.Events, 0)
+
+	state.webhookStatus[0].Shadow = &v1alpha1.ShadowStatus{Disagreements: 3, LastDisagreement: "denied"}
+	manageShadows(recorder, state, logr.Discard())
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Equal(t, "Warning ShadowDisagreement shadow webhook webhook disagreed with 2 enforced verdicts, last: denied", <-recorder.Events)
+	}
+}
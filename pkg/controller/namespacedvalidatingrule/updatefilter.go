@@ -0,0 +1,104 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"encoding/json"
+	"strings"
+
+	admv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+// noopFields are changed by the API server on any update, an update changing nothing else is a no-op
+var noopFields = []string{"metadata.managedFields", "metadata.resourceVersion"}
+
+// Update is the change an UPDATE admission request makes to its object
+type Update struct {
+	object    map[string]interface{}
+	oldObject map[string]interface{}
+	noop      bool
+}
+
+// NewUpdate returns the change request makes, nil when it is not an UPDATE or its objects cannot be compared
+func NewUpdate(request *admv1.AdmissionRequest) *Update {
+	if request.Operation != admv1.Update || len(request.Object.Raw) == 0 || len(request.OldObject.Raw) == 0 {
+		return nil
+	}
+
+	u := &Update{}
+	if err := json.Unmarshal(request.Object.Raw, &u.object); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(request.OldObject.Raw, &u.oldObject); err != nil {
+		return nil
+	}
+
+	u.noop = !u.changedExcept(noopFields)
+
+	return u
+}
+
+// Noop returns true if the update changes nothing but what the API server changes on any update
+func (u *Update) Noop() bool {
+	return u != nil && u.noop
+}
+
+// Selected returns true if the update changes any of the fields filter selects, or there is no filter
+func (u *Update) Selected(filter *v1alpha1.UpdateFilter) bool {
+	if u == nil || filter == nil {
+		return true
+	}
+
+	if len(filter.Watch) > 0 {
+		for _, path := range filter.Watch {
+			if u.changed(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ignored := append(append([]string{}, filter.Ignore...), noopFields...)
+	return u.changedExcept(ignored)
+}
+
+// changed returns true if the field at path differs between the old and new object
+func (u *Update) changed(path string) bool {
+	fields := strings.Split(path, ".")
+	value, found, _ := unstructured.NestedFieldNoCopy(u.object, fields...)
+	oldValue, oldFound, _ := unstructured.NestedFieldNoCopy(u.oldObject, fields...)
+
+	return found != oldFound || !equality.Semantic.DeepEqual(value, oldValue)
+}
+
+// changedExcept returns true if the old and new object differ outside of the fields at paths
+func (u *Update) changedExcept(paths []string) bool {
+	object := runtime.DeepCopyJSON(u.object)
+	oldObject := runtime.DeepCopyJSON(u.oldObject)
+	for _, path := range paths {
+		fields := strings.Split(path, ".")
+		unstructured.RemoveNestedField(object, fields...)
+		unstructured.RemoveNestedField(oldObject, fields...)
+	}
+
+	return !equality.Semantic.DeepEqual(object, oldObject)
+}
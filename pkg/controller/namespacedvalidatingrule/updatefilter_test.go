@@ -0,0 +1,71 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+func updateRequest(object, oldObject string) *admv1.AdmissionRequest {
+	return &admv1.AdmissionRequest{
+		Operation: admv1.Update,
+		Object:    runtime.RawExtension{Raw: []byte(object)},
+		OldObject: runtime.RawExtension{Raw: []byte(oldObject)},
+	}
+}
+
+func TestUpdateNoop(t *testing.T) {
+	old := `{"metadata":{"name":"a","resourceVersion":"1"},"spec":{"replicas":1}}`
+
+	assert.Nil(t, NewUpdate(&admv1.AdmissionRequest{Operation: admv1.Create}))
+	assert.Nil(t, NewUpdate(updateRequest(`not json`, old)))
+
+	noop := NewUpdate(updateRequest(`{"metadata":{"name":"a","resourceVersion":"2","managedFields":[{}]},"spec":{"replicas":1}}`, old))
+	assert.True(t, noop.Noop())
+	assert.True(t, noop.Selected(nil))
+
+	scaled := NewUpdate(updateRequest(`{"metadata":{"name":"a","resourceVersion":"2"},"spec":{"replicas":2}}`, old))
+	assert.False(t, scaled.Noop())
+
+	var none *Update
+	assert.False(t, none.Noop())
+	assert.True(t, none.Selected(&v1alpha1.UpdateFilter{Watch: []string{"spec"}}))
+}
+
+func TestUpdateSelected(t *testing.T) {
+	old := `{"metadata":{"name":"a","labels":{"app":"a"}},"spec":{"replicas":1},"status":{"ready":1}}`
+	statusOnly := NewUpdate(updateRequest(`{"metadata":{"name":"a","labels":{"app":"a"}},"spec":{"replicas":1},"status":{"ready":2}}`, old))
+	labelAdded := NewUpdate(updateRequest(`{"metadata":{"name":"a","labels":{"app":"a","team":"b"}},"spec":{"replicas":1},"status":{"ready":1}}`, old))
+
+	watch := &v1alpha1.UpdateFilter{Watch: []string{"spec", "metadata.labels"}}
+	assert.False(t, statusOnly.Selected(watch))
+	assert.True(t, labelAdded.Selected(watch))
+
+	ignore := &v1alpha1.UpdateFilter{Ignore: []string{"status"}}
+	assert.False(t, statusOnly.Selected(ignore))
+	assert.True(t, labelAdded.Selected(ignore))
+	assert.Equal(t, []string{"status"}, ignore.Ignore)
+
+	assert.True(t, statusOnly.Selected(&v1alpha1.UpdateFilter{Watch: []string{"status.ready"}}))
+	assert.False(t, statusOnly.Selected(&v1alpha1.UpdateFilter{Watch: []string{"spec.missing"}}))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"path"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+const (
+	// serviceAccountPrefix starts the username of every service account, followed by its namespace and name
+	serviceAccountPrefix = "system:serviceaccount:"
+)
+
+// MatchesUserInfo returns true if the request of user matches every one of matches, so it should be proxied
+func MatchesUserInfo(matches []v1alpha1.UserInfoMatch, user authenticationv1.UserInfo) bool {
+	for _, match := range matches {
+		if match.Include != nil && !listed(match.Include, user) {
+			return false
+		}
+		if match.Exclude != nil && listed(match.Exclude, user) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listed returns true if any of subjects matches user
+func listed(subjects *v1alpha1.UserInfoSubjects, user authenticationv1.UserInfo) bool {
+	if matchesAny(subjects.Usernames, user.Username) {
+		return true
+	}
+
+	for _, group := range user.Groups {
+		if matchesAny(subjects.Groups, group) {
+			return true
+		}
+	}
+
+	if strings.HasPrefix(user.Username, serviceAccountPrefix) {
+		parts := strings.SplitN(strings.TrimPrefix(user.Username, serviceAccountPrefix), ":", 2)
+		if len(parts) == 2 && matchesAny(subjects.ServiceAccounts, parts[0]+"/"+parts[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAny returns true if s matches any of the globs, invalid ones matching nothing
+func matchesAny(globs []string, s string) bool {
+	for _, glob := range globs {
+		if matched, err := path.Match(glob, s); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacedvalidatingrule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+func TestMatchesUserInfo(t *testing.T) {
+	operator := authenticationv1.UserInfo{
+		Username: "system:serviceaccount:test:operator",
+		Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:test"},
+	}
+	human := authenticationv1.UserInfo{Username: "jane@example.com", Groups: []string{"developers"}}
+
+	assert.True(t, MatchesUserInfo(nil, operator))
+
+	skipOperator := v1alpha1.UserInfoMatch{Exclude: &v1alpha1.UserInfoSubjects{ServiceAccounts: []string{"test/operator"}}}
+	assert.False(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{skipOperator}, operator))
+	assert.True(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{skipOperator}, human))
+
+	humansOnly := v1alpha1.UserInfoMatch{Exclude: &v1alpha1.UserInfoSubjects{Groups: []string{"system:*"}}}
+	assert.False(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{humansOnly}, operator))
+	assert.True(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{humansOnly}, human))
+
+	developers := v1alpha1.UserInfoMatch{
+		Include: &v1alpha1.UserInfoSubjects{Usernames: []string{"*@example.com"}},
+		Exclude: &v1alpha1.UserInfoSubjects{Usernames: []string{"admin@example.com"}},
+	}
+	assert.True(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{developers}, human))
+	assert.False(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{developers}, operator))
+	assert.False(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{developers}, authenticationv1.UserInfo{Username: "admin@example.com"}))
+
+	// every match has to hold
+	assert.False(t, MatchesUserInfo([]v1alpha1.UserInfoMatch{developers, skipOperator, {Include: &v1alpha1.UserInfoSubjects{}}}, human))
+}
@@ -18,8 +18,17 @@ package namespacedvalidatingtype
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
 )
 
 const (
@@ -41,6 +50,12 @@ func act(c client.Client, state *analyzedState, logger logr.Logger) error {
 		return nil
 	}
 
+	// rules losing their coverage to a forced deletion have to know about it before the type is gone
+	err := manageDegradedRules(c, state, logger)
+	if err != nil {
+		return err
+	}
+
 	// keep resource status up to date
 	var fullChange bool
 	ret := manageFinalizer(state, logger)
@@ -50,6 +65,12 @@ func act(c client.Client, state *analyzedState, logger logr.Logger) error {
 	ret = manageGeneration(state, logger)
 	statusChange = ret || statusChange
 
+	ret = manageDeletionCondition(state, logger)
+	statusChange = ret || statusChange
+
+	ret = manageStatus(state, logger)
+	statusChange = ret || statusChange
+
 	if fullChange {
 		logger.Info("doing full update")
 		err := c.Update(context.TODO(), state.customResource)
@@ -83,6 +104,155 @@ func manageGeneration(state *analyzedState, logger logr.Logger) bool {
 	return ret
 }
 
+func manageDeletionCondition(state *analyzedState, logger logr.Logger) bool {
+	condition := metav1.Condition{
+		Type:               v1alpha1.TypeConditionDeletionBlocked,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NotBlocked",
+		ObservedGeneration: state.customResource.Generation,
+	}
+
+	if state.blocked {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DependentRules"
+		condition.Message = dependentRulesMessage(state.dependentRules)
+	} else if meta.FindStatusCondition(state.customResource.Status.Conditions, condition.Type) == nil {
+		// nothing was ever blocked, no need to clutter the status
+		return false
+	}
+
+	ret := setCondition(&state.customResource.Status.Conditions, condition)
+	if ret {
+		logger.Info("updating deletion blocked condition", "status", condition.Status)
+	}
+
+	return ret
+}
+
+// manageStatus keeps the type's coverage and consumer information up to date
+func manageStatus(state *analyzedState, logger logr.Logger) bool {
+	var ret bool
+	status := &state.customResource.Status
+	generation := state.customResource.Generation
+
+	if !reflect.DeepEqual(status.EffectiveRules, state.effectiveRules) {
+		logger.Info("updating effective rules in status")
+		status.EffectiveRules = state.effectiveRules
+		ret = true
+	}
+
+	if status.ConsumingRules != state.consumingRules || status.ConsumingNamespaces != state.consumingNamespaces {
+		logger.Info("updating consumers in status", "rules", state.consumingRules, "namespaces", state.consumingNamespaces)
+		status.ConsumingRules = state.consumingRules
+		status.ConsumingNamespaces = state.consumingNamespaces
+		ret = true
+	}
+
+	applied := len(state.effectiveRules) > 0
+	if applied && (state.update || status.LastWebhookSyncTime == nil) {
+		now := metav1.Now()
+		status.LastWebhookSyncTime = &now
+		ret = true
+	}
+
+	appliedCondition := metav1.Condition{
+		Type:               v1alpha1.TypeConditionApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "WebhookSynced",
+		Message:            fmt.Sprintf("%v rules applied to %v", len(state.effectiveRules), ProxyWebhookName),
+		ObservedGeneration: generation,
+	}
+	if !applied {
+		appliedCondition.Status = metav1.ConditionFalse
+		appliedCondition.Reason = "NoRules"
+		appliedCondition.Message = "type doesn't contribute any rules"
+	}
+	ret = setCondition(&status.Conditions, appliedCondition) || ret
+
+	conflictingCondition := metav1.Condition{
+		Type:               v1alpha1.TypeConditionConflicting,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NoOverlap",
+		ObservedGeneration: generation,
+	}
+	if len(state.conflictingTypes) > 0 {
+		conflictingCondition.Status = metav1.ConditionTrue
+		conflictingCondition.Reason = "OverlappingTypes"
+		conflictingCondition.Message = fmt.Sprintf("overlaps with types [%v]", strings.Join(state.conflictingTypes, ", "))
+	}
+	ret = setCondition(&status.Conditions, conflictingCondition) || ret
+
+	readyCondition := metav1.Condition{
+		Type:               v1alpha1.TypeConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		ObservedGeneration: generation,
+	}
+	switch {
+	case state.blocked:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = "Deleting"
+	case !applied:
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = appliedCondition.Reason
+	}
+	ret = setCondition(&status.Conditions, readyCondition) || ret
+
+	return ret
+}
+
+func dependentRulesMessage(rules []v1alpha1.NamespacedValidatingRule) string {
+	namespaceSet := make(map[string]bool)
+	var names []string
+	for _, rule := range rules {
+		namespaceSet[rule.Namespace] = true
+		names = append(names, rule.Namespace+"/"+rule.Name)
+	}
+
+	var namespaces []string
+	for namespace := range namespaceSet {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+	sort.Strings(names)
+
+	return fmt.Sprintf("deletion blocked, still used in namespaces [%v] by rules [%v]; set %v=true to force",
+		strings.Join(namespaces, ", "), strings.Join(names, ", "), v1alpha1.ForceDeleteAnnotation)
+}
+
+// manageDegradedRules marks the rules that depended on a force deleted type as degraded
+func manageDegradedRules(c client.Client, state *analyzedState, logger logr.Logger) error {
+	if !state.delete {
+		return nil
+	}
+
+	for i := range state.dependentRules {
+		rule := &state.dependentRules[i]
+
+		condition := metav1.Condition{
+			Type:               v1alpha1.RuleConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             v1alpha1.ReasonTypeForceDeleted,
+			Message:            fmt.Sprintf("NamespacedValidatingType %v was force deleted while the rule depended on it", state.customResource.Name),
+			ObservedGeneration: rule.Generation,
+		}
+
+		if !setCondition(&rule.Status.Conditions, condition) {
+			continue
+		}
+
+		logger.Info("marking rule as degraded", "Rule.Namespace", rule.Namespace, "Rule.Name", rule.Name)
+		err := c.Status().Update(context.TODO(), rule)
+		if err != nil {
+			logger.Error(err, "failed to mark rule as degraded")
+			return err
+		}
+	}
+
+	return nil
+}
+
 func manageFinalizer(state *analyzedState, logger logr.Logger) bool {
 	var ret bool
 
@@ -124,6 +294,22 @@ func manageWebhookConfig(c client.Client, state *analyzedState, logger logr.Logg
 	return nil
 }
 
+// setCondition sets condition in conditions, returning true if anything but the transition time changed
+func setCondition(conditions *[]metav1.Condition, condition metav1.Condition) bool {
+	existing := meta.FindStatusCondition(*conditions, condition.Type)
+	if existing != nil &&
+		existing.Status == condition.Status &&
+		existing.Reason == condition.Reason &&
+		existing.Message == condition.Message &&
+		existing.ObservedGeneration == condition.ObservedGeneration {
+		return false
+	}
+
+	meta.SetStatusCondition(conditions, condition)
+
+	return true
+}
+
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
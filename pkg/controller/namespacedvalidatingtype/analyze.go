@@ -32,6 +32,15 @@ type analyzedState struct {
 	create                bool
 	update                bool
 	delete                bool
+	// rules that still depend on the type being deleted
+	dependentRules []v1alpha1.NamespacedValidatingRule
+	// true if the dependent rules are keeping the type from being deleted
+	blocked bool
+	// status information
+	effectiveRules      []admregv1.RuleWithOperations
+	conflictingTypes    []string
+	consumingRules      int32
+	consumingNamespaces int32
 }
 
 func analyze(observed *observedState, logger logr.Logger) (*analyzedState, error) {
@@ -49,9 +58,24 @@ func analyze(observed *observedState, logger logr.Logger) (*analyzedState, error
 			logger.V(2).Info("DeletionTimeStamp is not zero, deleting")
 			state.newNamespacedTypeData = namespacedTypeData.Delete(observed.customResource)
 			state.delete = true
+
+			state.dependentRules = dependentRules(observed.rules, namespacedTypeData, state.newNamespacedTypeData)
+			if len(state.dependentRules) > 0 && !forceDelete(observed.customResource) {
+				logger.Info("deletion blocked by dependent rules", "rules", len(state.dependentRules))
+				// keep proxying the type until the rules using it are gone
+				state.newNamespacedTypeData = namespacedTypeData.Update(observed.customResource)
+				state.delete = false
+				state.blocked = true
+			}
 		}
 	}
 
+	if state.customResource != nil {
+		state.effectiveRules = state.newNamespacedTypeData.effectiveRules(state.customResource.UID)
+		state.conflictingTypes = state.newNamespacedTypeData.conflicts(state.customResource)
+		state.consumingRules, state.consumingNamespaces = consumers(state.customResource, observed.rules)
+	}
+
 	webhook := state.newNamespacedTypeData.GenerateGlobalWebhook()
 
 	// code is ugly to make sure we handle the instance being deleted out from under us
@@ -71,6 +95,62 @@ func analyze(observed *observedState, logger logr.Logger) (*analyzedState, error
 	return state, nil
 }
 
+// dependentRules returns the live rules that have coverage under current, which they will lose under remaining
+func dependentRules(rules []v1alpha1.NamespacedValidatingRule, current, remaining *NamespacedTypeData) []v1alpha1.NamespacedValidatingRule {
+	var ret []v1alpha1.NamespacedValidatingRule
+
+	for _, rule := range rules {
+		if !rule.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+	webhooks:
+		for _, webhook := range rule.Spec.Webhooks {
+			for _, webhookRule := range webhook.Rules {
+				if current.dependsOn(webhookRule, remaining) {
+					ret = append(ret, rule)
+					break webhooks
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+// consumers counts the live rules, and the namespaces they are in, that use some of t's coverage
+func consumers(t *v1alpha1.NamespacedValidatingType, rules []v1alpha1.NamespacedValidatingRule) (int32, int32) {
+	typeOnly := (&NamespacedTypeData{}).Add(t)
+
+	var ruleCount int32
+	namespaces := make(map[string]bool)
+
+	for _, rule := range rules {
+		if !rule.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+	webhooks:
+		for _, webhook := range rule.Spec.Webhooks {
+			for _, webhookRule := range webhook.Rules {
+				for _, rk := range expandRule(webhookRule) {
+					if typeOnly.Exist(&rk.kind, rk.op) {
+						ruleCount++
+						namespaces[rule.Namespace] = true
+						break webhooks
+					}
+				}
+			}
+		}
+	}
+
+	return ruleCount, int32(len(namespaces))
+}
+
+func forceDelete(t *v1alpha1.NamespacedValidatingType) bool {
+	return t.Annotations[v1alpha1.ForceDeleteAnnotation] == "true"
+}
+
 func webhooksDiffer(new, old *admregv1.ValidatingWebhookConfiguration) bool {
 	if old == nil {
 		return true
@@ -98,3 +98,147 @@ func TestAnalyzeDifferent(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, state.update)
 }
+
+func TestAnalyzeDeleteBlocked(t *testing.T) {
+	deletionTime := metav1.Now()
+	customResource := &appv1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: uid, DeletionTimestamp: &deletionTime},
+		Spec: appv1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{testOp},
+				Rule:       rule,
+			}},
+		},
+	}
+
+	namespacedTypeData = (&NamespacedTypeData{}).Add(customResource)
+
+	observed := &observedState{
+		customResource: customResource,
+		clusterWebhook: namespacedTypeData.GenerateGlobalWebhook(),
+		rules:          []appv1alpha1.NamespacedValidatingRule{dependentRule()},
+	}
+
+	state, err := analyze(observed, logger)
+	assert.Nil(t, err)
+	assert.True(t, state.blocked)
+	assert.False(t, state.delete)
+	assert.Len(t, state.dependentRules, 1)
+	assert.False(t, state.update)
+	assert.True(t, state.newNamespacedTypeData.Exist(&metav1.GroupVersionKind{Group: testGroup, Version: testVersion, Kind: testKind}, testOp))
+}
+
+func TestAnalyzeDeleteForced(t *testing.T) {
+	deletionTime := metav1.Now()
+	customResource := &appv1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:               uid,
+			DeletionTimestamp: &deletionTime,
+			Annotations:       map[string]string{appv1alpha1.ForceDeleteAnnotation: "true"},
+		},
+		Spec: appv1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{testOp},
+				Rule:       rule,
+			}},
+		},
+	}
+
+	namespacedTypeData = (&NamespacedTypeData{}).Add(customResource)
+
+	observed := &observedState{
+		customResource: customResource,
+		clusterWebhook: namespacedTypeData.GenerateGlobalWebhook(),
+		rules:          []appv1alpha1.NamespacedValidatingRule{dependentRule()},
+	}
+
+	state, err := analyze(observed, logger)
+	assert.Nil(t, err)
+	assert.False(t, state.blocked)
+	assert.True(t, state.delete)
+	assert.Len(t, state.dependentRules, 1)
+	assert.True(t, state.update)
+}
+
+func TestAnalyzeDeleteNoDependents(t *testing.T) {
+	deletionTime := metav1.Now()
+	customResource := &appv1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: uid, DeletionTimestamp: &deletionTime},
+		Spec: appv1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{testOp},
+				Rule:       rule,
+			}},
+		},
+	}
+
+	// the rule only depends on an operation the type doesn't proxy
+	depRule := dependentRule()
+	depRule.Spec.Webhooks[0].Rules[0].Operations = []admregv1.OperationType{testDiffOp}
+
+	namespacedTypeData = (&NamespacedTypeData{}).Add(customResource)
+
+	observed := &observedState{
+		customResource: customResource,
+		clusterWebhook: namespacedTypeData.GenerateGlobalWebhook(),
+		rules:          []appv1alpha1.NamespacedValidatingRule{depRule},
+	}
+
+	state, err := analyze(observed, logger)
+	assert.Nil(t, err)
+	assert.False(t, state.blocked)
+	assert.True(t, state.delete)
+	assert.Empty(t, state.dependentRules)
+}
+
+func dependentRule() appv1alpha1.NamespacedValidatingRule {
+	return appv1alpha1.NamespacedValidatingRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "rule", Namespace: "test"},
+		Spec: appv1alpha1.NamespacedValidatingRuleSpec{
+			Webhooks: []appv1alpha1.NamespacedValidatingWebhook{{ValidatingWebhook: admregv1.ValidatingWebhook{
+				Name: "webhook",
+				Rules: []admregv1.RuleWithOperations{{
+					Operations: []admregv1.OperationType{testOp},
+					Rule:       rule,
+				}},
+			}}},
+		},
+	}
+}
+
+func TestAnalyzeConsumers(t *testing.T) {
+	customResource := &appv1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: uid},
+		Spec: appv1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{testOp},
+				Rule:       rule,
+			}},
+		},
+	}
+
+	rule1 := dependentRule()
+	rule2 := dependentRule()
+	rule2.Name = "rule2"
+	rule3 := dependentRule()
+	rule3.Namespace = "other"
+	unrelated := dependentRule()
+	unrelated.Spec.Webhooks[0].Rules[0].Operations = []admregv1.OperationType{testDiffOp}
+	wildcard := dependentRule()
+	wildcard.Name = "wildcard"
+	wildcard.Spec.Webhooks[0].Rules[0].Resources = []string{"*"}
+
+	namespacedTypeData = &NamespacedTypeData{}
+
+	observed := &observedState{
+		customResource: customResource,
+		rules:          []appv1alpha1.NamespacedValidatingRule{rule1, rule2, rule3, unrelated, wildcard},
+	}
+
+	state, err := analyze(observed, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), state.consumingRules)
+	assert.Equal(t, int32(2), state.consumingNamespaces)
+	assert.Len(t, state.effectiveRules, 1)
+	assert.Empty(t, state.conflictingTypes)
+}
@@ -19,14 +19,19 @@ package namespacedvalidatingtype
 import (
 	"bytes"
 	"encoding/gob"
+	"sort"
+	"time"
 
 	"github.com/redislabs/gesher/cmd/manager/flags"
 
 	admregv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 
 	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/bypass"
+	"github.com/redislabs/gesher/pkg/controller/namespacecache"
 )
 
 var (
@@ -42,49 +47,473 @@ type typeGroupMap map[string]typeVersionMap
 
 type NamespacedTypeData struct {
 	Mapping typeGroupMap
+	Types   map[types.UID]TypeInfo
 }
 
+// TypeInfo holds what is known about a NamespacedValidatingType beyond the resources it proxies
+type TypeInfo struct {
+	Name                 string
+	NamespaceSelector    *metav1.LabelSelector
+	AllowedNamespaces    []string
+	DeniedNamespaces     []string
+	RequireUsePermission bool
+	WebhookLimits        *appv1alpha1.WebhookLimits
+	UserInfo             *appv1alpha1.UserInfoMatch
+	Redactions           []appv1alpha1.Redaction
+	// Bypass is the type's bypass, nil when it has none or its annotation is invalid
+	Bypass *bypass.Bypass
+}
+
+// permits returns true if rules in the namespace with the given name and labels may use the type
+func (t TypeInfo) permits(namespace string, labels map[string]string) bool {
+	if containsString(t.DeniedNamespaces, namespace) {
+		return false
+	}
+
+	if len(t.AllowedNamespaces) == 0 && t.NamespaceSelector == nil {
+		return true
+	}
+
+	if containsString(t.AllowedNamespaces, namespace) {
+		return true
+	}
+
+	if t.NamespaceSelector == nil {
+		return false
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(t.NamespaceSelector)
+	if err != nil {
+		// an invalid selector selects nothing
+		return false
+	}
+
+	return selector.Matches(k8slabels.Set(labels))
+}
+
+// NewNamespacedTypeData returns the data describing what the given types proxy
+func NewNamespacedTypeData(namespacedTypes []appv1alpha1.NamespacedValidatingType) *NamespacedTypeData {
+	ret := &NamespacedTypeData{}
+	for i := range namespacedTypes {
+		ret = ret.Add(&namespacedTypes[i])
+	}
+
+	return ret
+}
+
+// Exist returns true if the types proxy op on kind, or some of it when a rule's wildcards are in kind or op
 func (p *NamespacedTypeData) Exist(kind *metav1.GroupVersionKind, op admregv1.OperationType) bool {
-	groupList := []string{kind.Group, "*"}
-	var versionMapList []typeVersionMap
-	for _, group := range groupList {
-		if versionMap, ok := p.Mapping[group]; ok {
-			versionMapList = append(versionMapList, versionMap)
+	return len(p.overlapping(kind, op)) > 0
+}
+
+// TypeKey is a group/version/resource/operation combination that types proxy
+type TypeKey struct {
+	Kind metav1.GroupVersionKind
+	Op   admregv1.OperationType
+}
+
+// Expand returns the keys the types are registered under that overlap op on kind, each narrowed to what kind and op
+// match of it, so that a rule's wildcards stand for what the types proxy rather than for everything.  A nil p
+// proxies nothing.
+func (p *NamespacedTypeData) Expand(kind *metav1.GroupVersionKind, op admregv1.OperationType) []TypeKey {
+	if p == nil {
+		return nil
+	}
+
+	var ret []TypeKey
+	seen := make(map[TypeKey]bool)
+
+	p.walk(kind, op, true, func(key metav1.GroupVersionKind, keyOp admregv1.OperationType, _ typeInstanceMap) {
+		typeKey := TypeKey{
+			Kind: metav1.GroupVersionKind{
+				Group:   intersect(key.Group, kind.Group),
+				Version: intersect(key.Version, kind.Version),
+				Kind:    intersect(key.Kind, kind.Kind),
+			},
+			Op: admregv1.OperationType(intersect(string(keyOp), string(op))),
+		}
+		if !seen[typeKey] {
+			seen[typeKey] = true
+			ret = append(ret, typeKey)
+		}
+	})
+
+	// rule statuses are built from the keys and compared on every reconcile, so they can't depend on map ordering
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if a.Kind.Group != b.Kind.Group {
+			return a.Kind.Group < b.Kind.Group
+		}
+		if a.Kind.Version != b.Kind.Version {
+			return a.Kind.Version < b.Kind.Version
+		}
+		if a.Kind.Kind != b.Kind.Kind {
+			return a.Kind.Kind < b.Kind.Kind
+		}
+		return a.Op < b.Op
+	})
+
+	return ret
+}
+
+// Permits returns true if a rule in the namespace with the given name and labels may have op on kind proxied,
+// i.e. one of the types covering all of it permits the namespace.  Nothing is decided here when no type covers it.
+func (p *NamespacedTypeData) Permits(namespace string, labels map[string]string, kind *metav1.GroupVersionKind, op admregv1.OperationType) bool {
+	uids := p.covering(kind, op)
+	if len(uids) == 0 {
+		return true
+	}
+
+	for _, uid := range uids {
+		if p.Types[uid].permits(namespace, labels) {
+			return true
 		}
 	}
 
-	versionList := []string{kind.Version, "*"}
-	var kindMapList []typeKindMap
-	for _, versionMap := range versionMapList {
-		for _, version := range versionList {
-			if kindMap, ok := versionMap[version]; ok {
-				kindMapList = append(kindMapList, kindMap)
+	return false
+}
+
+// NamespacePermitted checks Permits against the current types and namespace labels
+func NamespacePermitted(namespace string, resource metav1.GroupVersionResource, op admregv1.OperationType) bool {
+	kind := &metav1.GroupVersionKind{Group: resource.Group, Version: resource.Version, Kind: resource.Resource}
+
+	return namespacedTypeData.Permits(namespace, namespacecache.NamespaceData.Labels(namespace), kind, op)
+}
+
+// CoveringTypes returns what is known about the types that proxy all of op on kind
+func (p *NamespacedTypeData) CoveringTypes(kind *metav1.GroupVersionKind, op admregv1.OperationType) []TypeInfo {
+	var ret []TypeInfo
+	for _, uid := range p.covering(kind, op) {
+		ret = append(ret, p.Types[uid])
+	}
+
+	return ret
+}
+
+// Bypassed returns the name and bypass of a type covering all of op on kind that is bypassed at now, provided every
+// such type permitting the namespace with the given name and labels is, as the namespace's rules may be proxied
+// through any of them.  Of several bypassed types, the one whose bypass ends first is returned.  It's nil when op on
+// kind isn't bypassed in the namespace.
+func (p *NamespacedTypeData) Bypassed(namespace string, labels map[string]string, kind *metav1.GroupVersionKind, op admregv1.OperationType, now time.Time) (string, *bypass.Bypass) {
+	var name string
+	var ret *bypass.Bypass
+
+	for _, uid := range p.covering(kind, op) {
+		info := p.Types[uid]
+		if !info.permits(namespace, labels) {
+			continue
+		}
+		if !info.Bypass.Active(now) {
+			return "", nil
+		}
+		if ret == nil || endsBefore(info.Bypass, ret) || (!endsBefore(ret, info.Bypass) && info.Name < name) {
+			name, ret = info.Name, info.Bypass
+		}
+	}
+
+	return name, ret
+}
+
+// endsBefore returns true if bypass a expires before b does
+func endsBefore(a, b *bypass.Bypass) bool {
+	return a.Until != nil && (b.Until == nil || a.Until.Before(*b.Until))
+}
+
+// TypeBypassed checks Bypassed against the current types and namespace labels
+func TypeBypassed(namespace string, resource metav1.GroupVersionResource, op admregv1.OperationType, now time.Time) (string, *bypass.Bypass) {
+	kind := &metav1.GroupVersionKind{Group: resource.Group, Version: resource.Version, Kind: resource.Resource}
+
+	return namespacedTypeData.Bypassed(namespace, namespacecache.NamespaceData.Labels(namespace), kind, op, now)
+}
+
+// TypeSettings returns the webhook limits, user matches and redactions the current types set on the webhooks called
+// for op on resource
+func TypeSettings(resource metav1.GroupVersionResource, op admregv1.OperationType) (appv1alpha1.WebhookLimits, []appv1alpha1.UserInfoMatch, []appv1alpha1.Redaction) {
+	kind := &metav1.GroupVersionKind{Group: resource.Group, Version: resource.Version, Kind: resource.Resource}
+	p := namespacedTypeData
+
+	return p.WebhookLimits(kind, op), p.UserInfo(kind, op), p.Redactions(kind, op)
+}
+
+// UserInfo returns the user matches of the types that proxy op on kind, all of which a request has to match for
+// webhooks to be called.  A nil p has none.
+func (p *NamespacedTypeData) UserInfo(kind *metav1.GroupVersionKind, op admregv1.OperationType) []appv1alpha1.UserInfoMatch {
+	if p == nil {
+		return nil
+	}
+
+	var ret []appv1alpha1.UserInfoMatch
+	for _, uid := range p.covering(kind, op) {
+		if match := p.Types[uid].UserInfo; match != nil {
+			ret = append(ret, *match)
+		}
+	}
+
+	return ret
+}
+
+// Redactions returns the redactions of the types that proxy op on kind, all of which apply to the objects sent to
+// webhooks.  A nil p has none.
+func (p *NamespacedTypeData) Redactions(kind *metav1.GroupVersionKind, op admregv1.OperationType) []appv1alpha1.Redaction {
+	if p == nil {
+		return nil
+	}
+
+	var ret []appv1alpha1.Redaction
+	for _, uid := range p.covering(kind, op) {
+		ret = append(ret, p.Types[uid].Redactions...)
+	}
+
+	return ret
+}
+
+// WebhookLimits returns the strictest of the webhook limits of the types that proxy op on kind, with their
+// IgnoreOperations already applied to MaxFailurePolicy.  A nil p has no limits.
+func (p *NamespacedTypeData) WebhookLimits(kind *metav1.GroupVersionKind, op admregv1.OperationType) appv1alpha1.WebhookLimits {
+	var ret appv1alpha1.WebhookLimits
+	if p == nil {
+		return ret
+	}
+
+	for _, uid := range p.covering(kind, op) {
+		limits := p.Types[uid].WebhookLimits
+		if limits == nil {
+			continue
+		}
+
+		if limits.MaxTimeoutSeconds != nil && (ret.MaxTimeoutSeconds == nil || *limits.MaxTimeoutSeconds < *ret.MaxTimeoutSeconds) {
+			maxTimeoutSeconds := *limits.MaxTimeoutSeconds
+			ret.MaxTimeoutSeconds = &maxTimeoutSeconds
+		}
+
+		failurePolicy := limits.MaxFailurePolicy
+		if ignoresOperation(limits.IgnoreOperations, op) {
+			ignore := admregv1.Ignore
+			failurePolicy = &ignore
+		}
+		if failurePolicy != nil && (ret.MaxFailurePolicy == nil || *failurePolicy == admregv1.Ignore) {
+			maxFailurePolicy := *failurePolicy
+			ret.MaxFailurePolicy = &maxFailurePolicy
+		}
+	}
+
+	return ret
+}
+
+func ignoresOperation(ops []admregv1.OperationType, op admregv1.OperationType) bool {
+	for _, o := range ops {
+		if o == op || o == admregv1.OperationAll {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covering returns the UIDs of the types that proxy all of op on kind, wildcards included.  A type proxying only some
+// of a rule's "*" doesn't cover it, and it's for Expand to break such a rule into the keys types do cover.
+func (p *NamespacedTypeData) covering(kind *metav1.GroupVersionKind, op admregv1.OperationType) []types.UID {
+	return p.instances(kind, op, false)
+}
+
+// overlapping returns the UIDs of the types that proxy op on kind, or some of it when kind or op are wildcards
+func (p *NamespacedTypeData) overlapping(kind *metav1.GroupVersionKind, op admregv1.OperationType) []types.UID {
+	return p.instances(kind, op, true)
+}
+
+func (p *NamespacedTypeData) instances(kind *metav1.GroupVersionKind, op admregv1.OperationType, partial bool) []types.UID {
+	var ret []types.UID
+	seen := make(map[types.UID]bool)
+
+	p.walk(kind, op, partial, func(_ metav1.GroupVersionKind, _ admregv1.OperationType, instanceMap typeInstanceMap) {
+		for uid := range instanceMap {
+			if !seen[uid] {
+				seen[uid] = true
+				ret = append(ret, uid)
+			}
+		}
+	})
+
+	return ret
+}
+
+// covers returns true if the types proxy all of op on kind, wildcards included
+func (p *NamespacedTypeData) covers(kind *metav1.GroupVersionKind, op admregv1.OperationType) bool {
+	var covered bool
+	p.walk(kind, op, false, func(metav1.GroupVersionKind, admregv1.OperationType, typeInstanceMap) {
+		covered = true
+	})
+
+	return covered
+}
+
+// walk calls f with each key of p covering op on kind, or just some of it when partial, and the types registered
+// under it
+func (p *NamespacedTypeData) walk(kind *metav1.GroupVersionKind, op admregv1.OperationType, partial bool,
+	f func(key metav1.GroupVersionKind, op admregv1.OperationType, instanceMap typeInstanceMap)) {
+	for _, group := range candidateKeys(kind.Group, partial, func() (keys []string) {
+		for k := range p.Mapping {
+			keys = append(keys, k)
+		}
+		return
+	}) {
+		versionMap := p.Mapping[group]
+		for _, version := range candidateKeys(kind.Version, partial, func() (keys []string) {
+			for k := range versionMap {
+				keys = append(keys, k)
+			}
+			return
+		}) {
+			kindMap := versionMap[version]
+			for _, k := range candidateKeys(kind.Kind, partial, func() (keys []string) {
+				for k := range kindMap {
+					keys = append(keys, k)
+				}
+				return
+			}) {
+				opMap := kindMap[k]
+				for _, o := range candidateKeys(string(op), partial, func() (keys []string) {
+					for k := range opMap {
+						keys = append(keys, k)
+					}
+					return
+				}) {
+					if instanceMap := opMap[o]; len(instanceMap) > 0 {
+						f(metav1.GroupVersionKind{Group: group, Version: version, Kind: k}, admregv1.OperationType(o), instanceMap)
+					}
+				}
 			}
 		}
 	}
+}
 
-	kindList := []string{kind.Kind, "*"}
-	var opMapList []typeOpMap
-	for _, kindMap := range kindMapList {
-		for _, kind := range kindList {
-			if opMap, ok := kindMap[kind]; ok {
-				opMapList = append(opMapList, opMap)
+// candidateKeys returns the keys that may cover value, which are all those listed when value is a wildcard that only
+// needs to be covered partially
+func candidateKeys(value string, partial bool, list func() []string) []string {
+	switch {
+	case value != "*":
+		return []string{value, "*"}
+	case partial:
+		return list()
+	default:
+		return []string{"*"}
+	}
+}
+
+// intersect returns what both a key of p and value cover, given that they overlap
+func intersect(key, value string) string {
+	if value == "*" {
+		return key
+	}
+	return value
+}
+
+// ruleKind is a single group/version/resource/operation combination matched by a rule
+type ruleKind struct {
+	kind metav1.GroupVersionKind
+	op   admregv1.OperationType
+}
+
+func expandRule(rule admregv1.RuleWithOperations) []ruleKind {
+	var ret []ruleKind
+
+	for _, group := range rule.APIGroups {
+		for _, version := range rule.APIVersions {
+			for _, resource := range rule.Resources {
+				for _, op := range rule.Operations {
+					ret = append(ret, ruleKind{
+						kind: metav1.GroupVersionKind{Group: group, Version: version, Kind: resource},
+						op:   op,
+					})
+				}
 			}
 		}
 	}
 
-	opList := []string{string(op), "*"}
-	for _, opMap := range opMapList {
-		for _, op := range opList {
-			if opList, ok := opMap[op]; ok {
+	return ret
+}
+
+// dependsOn returns true if some combination matched by rule, wildcards included, is proxied by p, but wouldn't be
+// by without
+func (p *NamespacedTypeData) dependsOn(rule admregv1.RuleWithOperations, without *NamespacedTypeData) bool {
+	for _, rk := range expandRule(rule) {
+		for _, key := range p.Expand(&rk.kind, rk.op) {
+			if !without.covers(&key.Kind, key.Op) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// effectiveRules returns the rules of the global webhook that are there because of the type with the given uid
+func (p *NamespacedTypeData) effectiveRules(uid types.UID) []admregv1.RuleWithOperations {
+	var rules []admregv1.RuleWithOperations
+
+	scope := admregv1.NamespacedScope
+
+	for group, versionMap := range p.Mapping {
+		for version, kindMap := range versionMap {
+			for kind, opMap := range kindMap {
+				var opList []admregv1.OperationType
+				for op, instanceMap := range opMap {
+					if instanceMap[uid] {
+						opList = append(opList, admregv1.OperationType(op))
+					}
+				}
 				if len(opList) > 0 {
-					return true
+					sort.Slice(opList, func(i, j int) bool { return opList[i] < opList[j] })
+					rules = append(rules, admregv1.RuleWithOperations{
+						Rule: admregv1.Rule{
+							APIGroups:   []string{group},
+							APIVersions: []string{version},
+							Resources:   []string{kind},
+							Scope:       &scope,
+						},
+						Operations: opList,
+					})
 				}
 			}
 		}
 	}
 
-	return false
+	// the status is compared on every reconcile, so it can't depend on map ordering
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i].Rule, rules[j].Rule
+		if a.APIGroups[0] != b.APIGroups[0] {
+			return a.APIGroups[0] < b.APIGroups[0]
+		}
+		if a.APIVersions[0] != b.APIVersions[0] {
+			return a.APIVersions[0] < b.APIVersions[0]
+		}
+		return a.Resources[0] < b.Resources[0]
+	})
+
+	return rules
+}
+
+// conflicts returns the sorted names of the other types that proxy some of the same operations as t
+func (p *NamespacedTypeData) conflicts(t *appv1alpha1.NamespacedValidatingType) []string {
+	nameSet := make(map[string]bool)
+
+	for _, namespacedType := range t.Spec.Types {
+		for _, rk := range expandRule(namespacedType) {
+			for _, uid := range p.overlapping(&rk.kind, rk.op) {
+				if uid != t.UID {
+					nameSet[p.Types[uid].Name] = true
+				}
+			}
+		}
+	}
+
+	var ret []string
+	for name := range nameSet {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+
+	return ret
 }
 
 func (p *NamespacedTypeData) Add(t *appv1alpha1.NamespacedValidatingType) *NamespacedTypeData {
@@ -94,6 +523,23 @@ func (p *NamespacedTypeData) Add(t *appv1alpha1.NamespacedValidatingType) *Names
 		newP.Mapping = make(typeGroupMap)
 	}
 
+	if newP.Types == nil {
+		newP.Types = make(map[types.UID]TypeInfo)
+	}
+	// invalid bypass annotations are rejected when the type is admitted
+	b, _ := bypass.Parse(t.Annotations)
+	newP.Types[t.UID] = TypeInfo{
+		Name:                 t.Name,
+		NamespaceSelector:    t.Spec.NamespaceSelector,
+		AllowedNamespaces:    t.Spec.AllowedNamespaces,
+		DeniedNamespaces:     t.Spec.DeniedNamespaces,
+		RequireUsePermission: t.Spec.RequireUsePermission,
+		WebhookLimits:        t.Spec.WebhookLimits,
+		UserInfo:             t.Spec.UserInfo,
+		Redactions:           t.Spec.Redactions,
+		Bypass:               b,
+	}
+
 	groupMap := newP.Mapping
 
 	for _, namespacedType := range t.Spec.Types {
@@ -131,7 +577,12 @@ func (p *NamespacedTypeData) Add(t *appv1alpha1.NamespacedValidatingType) *Names
 
 		for _, opMap := range opMapList {
 			for _, op := range namespacedType.Operations {
-				opMap[string(op)] = map[types.UID]bool{t.UID: true}
+				instanceMap, ok := opMap[string(op)]
+				if !ok {
+					opMap[string(op)] = make(typeInstanceMap)
+					instanceMap = opMap[string(op)]
+				}
+				instanceMap[t.UID] = true
 			}
 		}
 	}
@@ -162,6 +613,8 @@ func copyNamespacedTypeData(p *NamespacedTypeData) *NamespacedTypeData {
 func (p *NamespacedTypeData) Delete(t *appv1alpha1.NamespacedValidatingType) *NamespacedTypeData {
 	newP := copyNamespacedTypeData(p)
 
+	delete(newP.Types, t.UID)
+
 	for _, versionMap := range newP.Mapping {
 		for _, kindMap := range versionMap {
 			for _, opMap := range kindMap {
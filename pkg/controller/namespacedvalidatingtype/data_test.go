@@ -18,6 +18,7 @@ package namespacedvalidatingtype
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -239,3 +240,213 @@ func TestGenerate(t *testing.T) {
 		assert.Contains(t, config.Webhooks[0].Rules[1].Operations, testOp1)
 	}
 }
+
+func TestEffectiveRules(t *testing.T) {
+	namespacedTypeData = &NamespacedTypeData{}
+	namespacedTypeData = namespacedTypeData.Add(resource1)
+	namespacedTypeData = namespacedTypeData.Add(resource2a)
+	namespacedTypeData = namespacedTypeData.Add(resource3)
+
+	rules := namespacedTypeData.effectiveRules(uid1)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, []string{testGroup1}, rules[0].APIGroups)
+	assert.Equal(t, []admregv1.OperationType{testOp1}, rules[0].Operations)
+
+	rules = namespacedTypeData.effectiveRules(uid3)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, []string{testGroup2}, rules[0].APIGroups)
+}
+
+func TestConflicts(t *testing.T) {
+	namespacedTypeData = &NamespacedTypeData{}
+	named1 := resource1.DeepCopy()
+	named1.Name = "type1"
+	named2 := resource2.DeepCopy()
+	named2.Name = "type2"
+	named3 := resource3.DeepCopy()
+	named3.Name = "type3"
+
+	namespacedTypeData = namespacedTypeData.Add(named1)
+	namespacedTypeData = namespacedTypeData.Add(named2)
+	namespacedTypeData = namespacedTypeData.Add(named3)
+
+	assert.Equal(t, []string{"type2"}, namespacedTypeData.conflicts(named1))
+	assert.Equal(t, []string{"type1"}, namespacedTypeData.conflicts(named2))
+	assert.Empty(t, namespacedTypeData.conflicts(named3))
+
+	namespacedTypeData = namespacedTypeData.Delete(named2)
+	assert.Empty(t, namespacedTypeData.conflicts(named1))
+}
+
+func TestPermits(t *testing.T) {
+	restricted := resource1.DeepCopy()
+	restricted.Spec.AllowedNamespaces = []string{"allowed"}
+	restricted.Spec.DeniedNamespaces = []string{"denied"}
+	restricted.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}}
+
+	kind := &metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind1}
+	tenant := map[string]string{"tenant": "true"}
+
+	p := (&NamespacedTypeData{}).Add(restricted)
+	assert.True(t, p.Permits("allowed", nil, kind, testOp1))
+	assert.True(t, p.Permits("selected", tenant, kind, testOp1))
+	assert.False(t, p.Permits("other", nil, kind, testOp1))
+	assert.False(t, p.Permits("denied", tenant, kind, testOp1))
+	// nothing covers testOp2, so there's nothing to restrict
+	assert.True(t, p.Permits("other", nil, kind, testOp2))
+
+	// another type covering the same kind opens it up
+	p = p.Add(resource2)
+	assert.True(t, p.Permits("other", nil, kind, testOp1))
+	assert.True(t, p.Permits("denied", nil, kind, testOp1))
+}
+
+func TestWebhookLimits(t *testing.T) {
+	fail, ignore := admregv1.Fail, admregv1.Ignore
+	ten, twenty := int32(10), int32(20)
+
+	limited1 := resource1.DeepCopy()
+	limited1.Spec.Types[0].Operations = []admregv1.OperationType{testOp1, testOp2}
+	limited1.Spec.WebhookLimits = &v1alpha1.WebhookLimits{
+		MaxFailurePolicy:  &fail,
+		MaxTimeoutSeconds: &twenty,
+		IgnoreOperations:  []admregv1.OperationType{testOp2},
+	}
+
+	kind := &metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind1}
+
+	p := (&NamespacedTypeData{}).Add(limited1)
+	limits := p.WebhookLimits(kind, testOp1)
+	assert.Equal(t, fail, *limits.MaxFailurePolicy)
+	assert.Equal(t, twenty, *limits.MaxTimeoutSeconds)
+	assert.Equal(t, ignore, *p.WebhookLimits(kind, testOp2).MaxFailurePolicy)
+
+	// the strictest limits of the covering types apply
+	limited2 := resource2.DeepCopy()
+	limited2.Spec.WebhookLimits = &v1alpha1.WebhookLimits{MaxFailurePolicy: &ignore, MaxTimeoutSeconds: &ten}
+	p = p.Add(limited2)
+	limits = p.WebhookLimits(kind, testOp1)
+	assert.Equal(t, ignore, *limits.MaxFailurePolicy)
+	assert.Equal(t, ten, *limits.MaxTimeoutSeconds)
+
+	assert.Equal(t, v1alpha1.WebhookLimits{}, p.WebhookLimits(&metav1.GroupVersionKind{Group: testGroup2, Version: testVersion2, Kind: testKind2}, testOp1))
+	assert.Equal(t, v1alpha1.WebhookLimits{}, (*NamespacedTypeData)(nil).WebhookLimits(kind, testOp1))
+}
+
+func TestRedactions(t *testing.T) {
+	redacting1 := resource1.DeepCopy()
+	redacting1.Spec.Redactions = []v1alpha1.Redaction{{Path: "data", Mode: v1alpha1.RedactionHash}}
+	redacting2 := resource2.DeepCopy()
+	redacting2.Spec.Redactions = []v1alpha1.Redaction{{Path: "stringData"}}
+
+	kind := &metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind1}
+
+	// the redactions of all the covering types apply
+	p := (&NamespacedTypeData{}).Add(redacting1).Add(redacting2)
+	assert.ElementsMatch(t, append(redacting1.Spec.Redactions, redacting2.Spec.Redactions...), p.Redactions(kind, testOp1))
+
+	assert.Empty(t, p.Redactions(&metav1.GroupVersionKind{Group: testGroup2, Version: testVersion2, Kind: testKind2}, testOp1))
+	assert.Nil(t, (*NamespacedTypeData)(nil).Redactions(kind, testOp1))
+}
+
+func TestDependsOnWildcards(t *testing.T) {
+	wildcard := resource2.DeepCopy()
+	wildcard.Spec.Types[0].Resources = []string{"*"}
+
+	withWildcard := (&NamespacedTypeData{}).Add(resource1).Add(wildcard)
+	onlyResource1 := withWildcard.Delete(wildcard)
+
+	ruleOn := func(group, version, resource string) admregv1.RuleWithOperations {
+		return admregv1.RuleWithOperations{
+			Operations: []admregv1.OperationType{"*"},
+			Rule:       admregv1.Rule{APIGroups: []string{group}, APIVersions: []string{version}, Resources: []string{resource}},
+		}
+	}
+
+	// a rule with wildcards depends on the types covering any of it
+	assert.True(t, onlyResource1.dependsOn(ruleOn("*", testVersion1, "*"), &NamespacedTypeData{}))
+	assert.True(t, onlyResource1.Exist(&metav1.GroupVersionKind{Group: "*", Version: "*", Kind: "*"}, testOp1))
+	assert.False(t, onlyResource1.dependsOn(ruleOn(testGroup2, "*", "*"), &NamespacedTypeData{}))
+
+	// removing a type with wildcards takes what the remaining types don't cover
+	assert.True(t, withWildcard.dependsOn(ruleOn(testGroup1, testVersion1, "*"), onlyResource1))
+	assert.True(t, withWildcard.dependsOn(ruleOn(testGroup1, testVersion1, testKind2), onlyResource1))
+	assert.False(t, withWildcard.dependsOn(ruleOn(testGroup1, testVersion1, testKind1), onlyResource1))
+
+	// a concrete request is only covered by keys matching it
+	assert.False(t, onlyResource1.covers(&metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: "*"}, testOp1))
+	assert.True(t, withWildcard.covers(&metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: "*"}, testOp1))
+}
+
+func TestExpand(t *testing.T) {
+	wildcard := resource3.DeepCopy()
+	wildcard.Spec.Types[0].APIVersions = []string{"*"}
+	gated := resource2.DeepCopy()
+	gated.Spec.Types[0].Resources = []string{testKind2}
+	gated.Spec.RequireUsePermission = true
+
+	p := (&NamespacedTypeData{}).Add(resource1).Add(gated).Add(wildcard)
+	all := &metav1.GroupVersionKind{Group: "*", Version: "*", Kind: "*"}
+
+	// a rule's wildcards stand for the keys the types are registered under, narrowed to the rule
+	assert.Equal(t, []TypeKey{
+		{Kind: metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind1}, Op: testOp1},
+		{Kind: metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind2}, Op: testOp1},
+		{Kind: metav1.GroupVersionKind{Group: testGroup2, Version: "*", Kind: testKind2}, Op: testOp1},
+	}, p.Expand(all, "*"))
+	assert.Equal(t, []TypeKey{
+		{Kind: metav1.GroupVersionKind{Group: testGroup2, Version: testVersion1, Kind: testKind2}, Op: testOp1},
+	}, p.Expand(&metav1.GroupVersionKind{Group: testGroup2, Version: testVersion1, Kind: "*"}, testOp1))
+	assert.Empty(t, p.Expand(all, testOp2))
+	assert.Nil(t, (*NamespacedTypeData)(nil).Expand(all, testOp1))
+
+	// only the types covering all of a key count for it, not those covering just some of a rule's wildcards
+	assert.Empty(t, p.CoveringTypes(all, testOp1))
+	infos := p.CoveringTypes(&metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind2}, testOp1)
+	assert.Len(t, infos, 1)
+	assert.True(t, infos[0].RequireUsePermission)
+}
+
+func TestBypassed(t *testing.T) {
+	now := time.Now()
+	kind := &metav1.GroupVersionKind{Group: testGroup1, Version: testVersion1, Kind: testKind1}
+
+	bypassed := resource1.DeepCopy()
+	bypassed.Name = "bypassed"
+	bypassed.Annotations = map[string]string{v1alpha1.BypassAnnotation: "true"}
+	bypassed.Spec.AllowedNamespaces = []string{"a", "b"}
+	other := resource2.DeepCopy()
+	other.Name = "other"
+	other.Spec.AllowedNamespaces = []string{"b"}
+
+	p := (&NamespacedTypeData{}).Add(bypassed)
+	name, b := p.Bypassed("a", nil, kind, testOp1, now)
+	assert.Equal(t, bypassed.Name, name)
+	assert.NotNil(t, b)
+
+	// a type's bypass doesn't reach namespaces it doesn't permit
+	_, b = p.Bypassed("c", nil, kind, testOp1, now)
+	assert.Nil(t, b)
+
+	// nor those whose rules may be proxied through another type that isn't bypassed
+	p = p.Add(other)
+	_, b = p.Bypassed("b", nil, kind, testOp1, now)
+	assert.Nil(t, b)
+	_, b = p.Bypassed("a", nil, kind, testOp1, now)
+	assert.NotNil(t, b)
+
+	// of several bypassed types, the bypass ending first is the one that counts
+	until := now.Add(time.Hour)
+	other.Annotations = map[string]string{v1alpha1.BypassAnnotation: until.Format(time.RFC3339)}
+	p = p.Update(other)
+	name, b = p.Bypassed("b", nil, kind, testOp1, now)
+	assert.Equal(t, other.Name, name)
+	if assert.NotNil(t, b) {
+		assert.NotNil(t, b.Until)
+	}
+
+	namespacedTypeData = p
+	defer func() { namespacedTypeData = &NamespacedTypeData{} }()
+	_, b = TypeBypassed("c", metav1.GroupVersionResource{Group: testGroup1, Version: testVersion1, Resource: testKind1}, testOp1, now)
+	assert.Nil(t, b)
+}
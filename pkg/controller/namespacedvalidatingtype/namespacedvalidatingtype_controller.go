@@ -26,6 +26,7 @@ import (
 
 	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -81,9 +82,35 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Types report the rules that use them, and types being deleted wait on the rules that depend on them
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.NamespacedValidatingRule{}}, handler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return allTypes(mgr.GetClient())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+func allTypes(c client.Client) []reconcile.Request {
+	typeList := &appv1alpha1.NamespacedValidatingTypeList{}
+	err := c.List(context.TODO(), typeList)
+	if err != nil {
+		log.Error(err, "type list failed")
+		return nil
+	}
+
+	var ret []reconcile.Request
+	for _, t := range typeList.Items {
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Name: t.Name}})
+	}
+
+	return ret
+}
+
 // blank assignment to verify that ReconcileNamespacedValidatingType implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileNamespacedValidatingType{}
 
@@ -33,6 +33,7 @@ import (
 type observedState struct {
 	customResource *appv1alpha1.NamespacedValidatingType
 	clusterWebhook *admregv1.ValidatingWebhookConfiguration
+	rules          []appv1alpha1.NamespacedValidatingRule
 }
 
 func observe(client client.Client, request reconcile.Request, logger logr.Logger) (*observedState, error) {
@@ -61,6 +62,17 @@ func observe(client client.Client, request reconcile.Request, logger logr.Logger
 		state.customResource = nil
 	}
 
+	// The type's status reports the rules using it, and a type being deleted has to know which rules still depend on it
+	if state.customResource != nil {
+		ruleList := &appv1alpha1.NamespacedValidatingRuleList{}
+		err := client.List(context.TODO(), ruleList)
+		if err != nil {
+			logger.Error(err, "rule list failed")
+			return nil, err
+		}
+		state.rules = ruleList.Items
+	}
+
 	// Fetch the managed ValidatingWebhookConfiguration instance
 	// code is ugly to make sure we handle the instance being deleted out from under us
 	err := client.Get(context.TODO(), types.NamespacedName{Name: ProxyWebhookName}, state.clusterWebhook)
@@ -0,0 +1,52 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookquota
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func act(kubeClient client.Client, state *analyzedState, logger logr.Logger) error {
+	for i := range state.quotas {
+		quota := &state.quotas[i]
+
+		status := state.status
+		status.ObservedGeneration = quota.Generation
+		if equality.Semantic.DeepEqual(quota.Status, status) {
+			continue
+		}
+
+		logger.V(2).Info("doing status update", "Quota", quota.Name)
+		quota.Status = status
+		err := kubeClient.Status().Update(context.TODO(), quota)
+		if err != nil {
+			logger.Error(err, "failed to do status update", "Quota", quota.Name)
+			return err
+		}
+	}
+
+	if state.update {
+		logger.V(1).Info("updating quota data")
+	}
+	QuotaData = state.newQuotaData
+
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookquota
+
+import (
+	"reflect"
+
+	"github.com/go-logr/logr"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+type analyzedState struct {
+	quotas       []v1alpha1.WebhookQuota
+	newQuotaData *QuotaDataType
+	// status is the status all of the namespace's quotas should have
+	status v1alpha1.WebhookQuotaStatus
+	update bool
+}
+
+func analyze(observed *observeState, logger logr.Logger) (*analyzedState, error) {
+	state := &analyzedState{
+		quotas: observed.quotas,
+	}
+
+	if len(observed.quotas) == 0 {
+		logger.V(2).Info("namespace has no quotas")
+		state.newQuotaData = QuotaData.Delete(observed.namespace)
+	} else {
+		quota := Evaluate(Limits(observed.quotas), observed.rules, observed.typeData)
+		state.newQuotaData = QuotaData.Update(observed.namespace, quota)
+		state.status = v1alpha1.WebhookQuotaStatus{
+			Used:   quota.Usage,
+			Excess: quota.ExcessList(),
+		}
+	}
+
+	if !reflect.DeepEqual(state.newQuotaData, QuotaData) {
+		state.update = true
+	}
+
+	return state, nil
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookquota
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+
+	admregv1 "k8s.io/api/admissionregistration/v1"
+
+	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+)
+
+var (
+	QuotaData = &QuotaDataType{
+		Namespaces: make(map[string]NamespaceQuota),
+	}
+)
+
+// NamespaceQuota is the quota state of a single namespace
+type NamespaceQuota struct {
+	// Limits are the strictest of each limit of the namespace's quotas
+	Limits appv1alpha1.WebhookQuotaSpec
+	Usage  appv1alpha1.WebhookQuotaUsage
+	// Excess holds why each webhook over quota exceeds it, by the webhook's WebhookKey
+	Excess map[string]string
+}
+
+type QuotaDataType struct {
+	Namespaces map[string]NamespaceQuota
+}
+
+// WebhookKey identifies a webhook within a namespace
+func WebhookKey(ruleName, webhookName string) string {
+	return ruleName + "/" + webhookName
+}
+
+// Excess returns why the named webhook is over its namespace's quota, empty if it isn't
+func (p *QuotaDataType) Excess(namespace, ruleName, webhookName string) string {
+	return p.Namespaces[namespace].Excess[WebhookKey(ruleName, webhookName)]
+}
+
+func (p *QuotaDataType) Update(namespace string, quota NamespaceQuota) *QuotaDataType {
+	newP := copyQuotaData(p)
+
+	if newP.Namespaces == nil {
+		newP.Namespaces = make(map[string]NamespaceQuota)
+	}
+
+	newP.Namespaces[namespace] = quota
+
+	return newP
+}
+
+// Delete removes the quota of a namespace that no longer has any
+func (p *QuotaDataType) Delete(namespace string) *QuotaDataType {
+	newP := copyQuotaData(p)
+
+	delete(newP.Namespaces, namespace)
+
+	return newP
+}
+
+func copyQuotaData(p *QuotaDataType) *QuotaDataType {
+	var newP QuotaDataType
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	dec := gob.NewDecoder(&buf)
+
+	err := enc.Encode(p)
+	if err != nil {
+		return nil
+	}
+
+	err = dec.Decode(&newP)
+	if err != nil {
+		return nil
+	}
+
+	return &newP
+}
+
+// Limits returns the strictest of each of quotas' limits
+func Limits(quotas []appv1alpha1.WebhookQuota) appv1alpha1.WebhookQuotaSpec {
+	var ret appv1alpha1.WebhookQuotaSpec
+
+	for _, quota := range quotas {
+		ret.MaxWebhooks = minLimit(ret.MaxWebhooks, quota.Spec.MaxWebhooks)
+		ret.MaxTimeoutSeconds = minLimit(ret.MaxTimeoutSeconds, quota.Spec.MaxTimeoutSeconds)
+		ret.MaxFanOut = minLimit(ret.MaxFanOut, quota.Spec.MaxFanOut)
+	}
+
+	return ret
+}
+
+func minLimit(a, b *int32) *int32 {
+	if a == nil {
+		return b
+	}
+	if b == nil || *a <= *b {
+		return a
+	}
+
+	return b
+}
+
+// Evaluate returns the usage of rules, all in the same namespace, and which of their webhooks are over limits.
+// Webhooks are admitted first come first served: in order of their rule's creation, then name, then the webhook's
+// position in the rule.  Rules being deleted don't count.  A webhook's timeout is the one the proxy calls it with,
+// clamped by the limits of typeData's types.  Shadow webhooks count towards MaxWebhooks and MaxFanOut, as requests are
+// sent to them like to any other webhook, but not towards MaxTimeoutSeconds, as nothing waits for them.
+func Evaluate(limits appv1alpha1.WebhookQuotaSpec, rules []appv1alpha1.NamespacedValidatingRule, typeData *namespacedvalidatingtype.NamespacedTypeData) NamespaceQuota {
+	ret := NamespaceQuota{
+		Limits: limits,
+		Excess: make(map[string]string),
+	}
+
+	var sorted []appv1alpha1.NamespacedValidatingRule
+	for _, rule := range rules {
+		if rule.DeletionTimestamp.IsZero() {
+			sorted = append(sorted, rule)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+
+	var admitted appv1alpha1.WebhookQuotaUsage
+	var admittedRules [][]admregv1.RuleWithOperations
+	for _, rule := range sorted {
+		for _, webhook := range rule.Spec.Webhooks {
+			var timeout int32
+			if !webhook.Shadow {
+				timeout = namespacedvalidatingrule.ClampedTimeout(webhook, typeData)
+			}
+
+			ret.Usage.Webhooks++
+			ret.Usage.TimeoutSeconds += timeout
+
+			if reason := excess(limits, admitted, admittedRules, timeout, webhook.Rules); reason != "" {
+				ret.Excess[WebhookKey(rule.Name, webhook.Name)] = reason
+				continue
+			}
+
+			admitted.Webhooks++
+			admitted.TimeoutSeconds += timeout
+			admittedRules = append(admittedRules, webhook.Rules)
+		}
+	}
+
+	return ret
+}
+
+// excess returns why a webhook with timeout and webhookRules is over limits, once admitted is used by the webhooks
+// already admitted, whose rules are admittedRules.  It returns an empty string when the webhook is within limits.
+func excess(limits appv1alpha1.WebhookQuotaSpec, admitted appv1alpha1.WebhookQuotaUsage, admittedRules [][]admregv1.RuleWithOperations,
+	timeout int32, webhookRules []admregv1.RuleWithOperations) string {
+	if limits.MaxWebhooks != nil && admitted.Webhooks+1 > *limits.MaxWebhooks {
+		return fmt.Sprintf("more than the %v webhooks allowed", *limits.MaxWebhooks)
+	}
+
+	if limits.MaxTimeoutSeconds != nil && admitted.TimeoutSeconds+timeout > *limits.MaxTimeoutSeconds {
+		return fmt.Sprintf("timeouts adding up to more than the %v seconds allowed", *limits.MaxTimeoutSeconds)
+	}
+
+	if limits.MaxFanOut != nil {
+		for i, webhookRule := range webhookRules {
+			if fanOut := fanOut(admittedRules, webhookRule) + 1; fanOut > *limits.MaxFanOut {
+				return fmt.Sprintf("requests matching rules[%v] proxied to %v webhooks, more than the %v allowed", i, fanOut, *limits.MaxFanOut)
+			}
+		}
+	}
+
+	return ""
+}
+
+// ExcessList returns the sorted keys of the webhooks over quota
+func (q NamespaceQuota) ExcessList() []string {
+	var ret []string
+	for key := range q.Excess {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// fanOut returns how many of the webhooks, whose rules are webhooksRules, a request matching webhookRule could be
+// proxied to
+func fanOut(webhooksRules [][]admregv1.RuleWithOperations, webhookRule admregv1.RuleWithOperations) int32 {
+	var ret int32
+
+	for _, rules := range webhooksRules {
+		for _, r := range rules {
+			if overlaps(r, webhookRule) {
+				ret++
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+func overlaps(a, b admregv1.RuleWithOperations) bool {
+	var aOps, bOps []string
+	for _, op := range a.Operations {
+		aOps = append(aOps, string(op))
+	}
+	for _, op := range b.Operations {
+		bOps = append(bOps, string(op))
+	}
+
+	return intersects(aOps, bOps) &&
+		intersects(a.APIGroups, b.APIGroups) &&
+		intersects(a.APIVersions, b.APIVersions) &&
+		intersects(a.Resources, b.Resources)
+}
+
+// intersects returns true if a and b share an item, "*" matching anything
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y || x == "*" || y == "*" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
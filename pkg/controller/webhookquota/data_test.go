@@ -0,0 +1,188 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookquota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+)
+
+const (
+	namespace = "test"
+)
+
+var (
+	testRule = admregv1.RuleWithOperations{
+		Operations: []admregv1.OperationType{admregv1.Create},
+		Rule: admregv1.Rule{
+			APIGroups:   []string{"testGroup"},
+			APIVersions: []string{"testVersion"},
+			Resources:   []string{"testResource"},
+		},
+	}
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func testRuleResource(name string, created time.Time, timeouts ...int32) v1alpha1.NamespacedValidatingRule {
+	rule := v1alpha1.NamespacedValidatingRule{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, CreationTimestamp: metav1.NewTime(created)},
+	}
+
+	for i, timeout := range timeouts {
+		rule.Spec.Webhooks = append(rule.Spec.Webhooks, v1alpha1.NamespacedValidatingWebhook{ValidatingWebhook: admregv1.ValidatingWebhook{
+			Name:           string(rune('a' + i)),
+			TimeoutSeconds: int32Ptr(timeout),
+			Rules:          []admregv1.RuleWithOperations{testRule},
+		}})
+	}
+
+	return rule
+}
+
+func TestLimits(t *testing.T) {
+	quotas := []v1alpha1.WebhookQuota{
+		{Spec: v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(5), MaxFanOut: int32Ptr(2)}},
+		{Spec: v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(3), MaxTimeoutSeconds: int32Ptr(20)}},
+	}
+
+	limits := Limits(quotas)
+	assert.Equal(t, int32(3), *limits.MaxWebhooks)
+	assert.Equal(t, int32(20), *limits.MaxTimeoutSeconds)
+	assert.Equal(t, int32(2), *limits.MaxFanOut)
+
+	assert.Equal(t, v1alpha1.WebhookQuotaSpec{}, Limits(nil))
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	older := testRuleResource("older", now.Add(-time.Hour), 10, 10)
+	newer := testRuleResource("newer", now, 5, 10)
+
+	quota := Evaluate(v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(3), MaxTimeoutSeconds: int32Ptr(25)},
+		[]v1alpha1.NamespacedValidatingRule{newer, older}, nil)
+
+	assert.Equal(t, v1alpha1.WebhookQuotaUsage{Webhooks: 4, TimeoutSeconds: 35}, quota.Usage)
+	// the older rule's webhooks come first, then newer/a fits the timeout budget, newer/b fits neither
+	assert.Equal(t, []string{WebhookKey("newer", "b")}, quota.ExcessList())
+
+	quota = Evaluate(v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(1)}, []v1alpha1.NamespacedValidatingRule{newer, older}, nil)
+	assert.Equal(t, []string{WebhookKey("newer", "a"), WebhookKey("newer", "b"), WebhookKey("older", "b")}, quota.ExcessList())
+}
+
+func TestEvaluateDeleted(t *testing.T) {
+	deleted := testRuleResource("deleted", time.Now().Add(-time.Hour), 10)
+	deletionTimestamp := metav1.Now()
+	deleted.DeletionTimestamp = &deletionTimestamp
+	rule := testRuleResource("rule", time.Now(), 10)
+
+	quota := Evaluate(v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(1)}, []v1alpha1.NamespacedValidatingRule{deleted, rule}, nil)
+	assert.Empty(t, quota.Excess)
+	assert.Equal(t, int32(1), quota.Usage.Webhooks)
+}
+
+func TestEvaluateClampedTimeouts(t *testing.T) {
+	five := int32(5)
+	limited := &v1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: "type", Name: "type"},
+		Spec: v1alpha1.NamespacedValidatingTypeSpec{
+			Types:         []admregv1.RuleWithOperations{testRule},
+			WebhookLimits: &v1alpha1.WebhookLimits{MaxTimeoutSeconds: &five},
+		},
+	}
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(limited)
+
+	older := testRuleResource("older", time.Now().Add(-time.Hour), 10)
+	newer := testRuleResource("newer", time.Now(), 30)
+	limits := v1alpha1.WebhookQuotaSpec{MaxTimeoutSeconds: int32Ptr(10)}
+
+	// the proxy calls both webhooks with the type's 5 seconds timeout
+	quota := Evaluate(limits, []v1alpha1.NamespacedValidatingRule{newer, older}, typeData)
+	assert.Equal(t, v1alpha1.WebhookQuotaUsage{Webhooks: 2, TimeoutSeconds: 10}, quota.Usage)
+	assert.Empty(t, quota.Excess)
+
+	quota = Evaluate(limits, []v1alpha1.NamespacedValidatingRule{newer, older}, nil)
+	assert.Equal(t, v1alpha1.WebhookQuotaUsage{Webhooks: 2, TimeoutSeconds: 40}, quota.Usage)
+	assert.Equal(t, []string{WebhookKey("newer", "a")}, quota.ExcessList())
+}
+
+func TestEvaluateShadow(t *testing.T) {
+	older := testRuleResource("older", time.Now().Add(-time.Hour), 10)
+	shadow := testRuleResource("shadow", time.Now(), 10)
+	shadow.Spec.Webhooks[0].Shadow = true
+
+	// nothing waits for shadow webhooks, but they are still called
+	quota := Evaluate(v1alpha1.WebhookQuotaSpec{MaxTimeoutSeconds: int32Ptr(10)}, []v1alpha1.NamespacedValidatingRule{shadow, older}, nil)
+	assert.Equal(t, v1alpha1.WebhookQuotaUsage{Webhooks: 2, TimeoutSeconds: 10}, quota.Usage)
+	assert.Empty(t, quota.Excess)
+
+	quota = Evaluate(v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(1)}, []v1alpha1.NamespacedValidatingRule{shadow, older}, nil)
+	assert.Equal(t, []string{WebhookKey("shadow", "a")}, quota.ExcessList())
+}
+
+func TestEvaluateFanOut(t *testing.T) {
+	now := time.Now()
+	rule := testRuleResource("rule", now.Add(-time.Hour), 10, 10)
+	other := testRuleResource("other", now, 5)
+	other.Spec.Webhooks[0].Rules = []admregv1.RuleWithOperations{{
+		Operations: []admregv1.OperationType{admregv1.OperationAll},
+		Rule: admregv1.Rule{
+			APIGroups:   []string{"*"},
+			APIVersions: []string{"*"},
+			Resources:   []string{"otherResource"},
+		},
+	}}
+	limits := v1alpha1.WebhookQuotaSpec{MaxFanOut: int32Ptr(2)}
+
+	quota := Evaluate(limits, []v1alpha1.NamespacedValidatingRule{rule, other}, nil)
+	assert.Empty(t, quota.Excess)
+
+	// requests for testResource would reach all three webhooks, the newest of which is over quota
+	other.Spec.Webhooks[0].Rules[0].Resources = []string{"*"}
+	quota = Evaluate(limits, []v1alpha1.NamespacedValidatingRule{rule, other}, nil)
+	assert.Equal(t, []string{WebhookKey("other", "a")}, quota.ExcessList())
+	assert.Contains(t, quota.Excess[WebhookKey("other", "a")], "rules[0]")
+
+	// and the webhooks over quota aren't called, so don't count towards the fan-out of others
+	limits.MaxTimeoutSeconds = int32Ptr(15)
+	quota = Evaluate(limits, []v1alpha1.NamespacedValidatingRule{rule, other}, nil)
+	assert.Equal(t, []string{WebhookKey("rule", "b")}, quota.ExcessList())
+}
+
+func TestQuotaDataUpdateDelete(t *testing.T) {
+	q := &QuotaDataType{}
+	newQ := q.Update(namespace, NamespaceQuota{
+		Limits: v1alpha1.WebhookQuotaSpec{MaxWebhooks: int32Ptr(1)},
+		Excess: map[string]string{WebhookKey("rule", "a"): "more than the 1 webhooks allowed"},
+	})
+
+	assert.Equal(t, "more than the 1 webhooks allowed", newQ.Excess(namespace, "rule", "a"))
+	assert.Empty(t, newQ.Excess(namespace, "rule", "b"))
+	assert.Empty(t, q.Excess(namespace, "rule", "a"))
+
+	newQ = newQ.Delete(namespace)
+	assert.Empty(t, newQ.Excess(namespace, "rule", "a"))
+}
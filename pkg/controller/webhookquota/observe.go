@@ -0,0 +1,71 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookquota
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+)
+
+// observeState is the state of the request's namespace, as quotas apply to namespaces rather than to single objects
+type observeState struct {
+	namespace string
+	quotas    []v1alpha1.WebhookQuota
+	rules     []v1alpha1.NamespacedValidatingRule
+	// typeData clamps the timeouts of the rules' webhooks as the proxy does
+	typeData *namespacedvalidatingtype.NamespacedTypeData
+}
+
+func observe(kubeClient client.Client, request reconcile.Request, logger logr.Logger) (*observeState, error) {
+	ret := &observeState{namespace: request.Namespace}
+
+	quotaList := &v1alpha1.WebhookQuotaList{}
+	err := kubeClient.List(context.TODO(), quotaList, client.InNamespace(request.Namespace))
+	if err != nil {
+		logger.Error(err, "quota list failed")
+		return nil, err
+	}
+	ret.quotas = quotaList.Items
+
+	if len(ret.quotas) == 0 {
+		return ret, nil
+	}
+
+	ruleList := &v1alpha1.NamespacedValidatingRuleList{}
+	err = kubeClient.List(context.TODO(), ruleList, client.InNamespace(request.Namespace))
+	if err != nil {
+		logger.Error(err, "rule list failed")
+		return nil, err
+	}
+	ret.rules = ruleList.Items
+
+	typeList := &v1alpha1.NamespacedValidatingTypeList{}
+	err = kubeClient.List(context.TODO(), typeList)
+	if err != nil {
+		logger.Error(err, "type list failed")
+		return nil, err
+	}
+	ret.typeData = namespacedvalidatingtype.NewNamespacedTypeData(typeList.Items)
+
+	return ret, nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookquota
+
+import (
+	"context"
+
+	"github.com/operator-framework/operator-lib/handler"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	crhandler "sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+var log = logf.Log.WithName("controller_webhookquota")
+
+// Add creates a new WebhookQuota Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileWebhookQuota{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("webhookquota-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource WebhookQuota
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.WebhookQuota{}}, &handler.InstrumentedEnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// A quota's usage is that of the rules in its namespace
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.NamespacedValidatingRule{}}, crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return quotasInNamespace(mgr.GetClient(), o.GetNamespace())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
+	// and the types' limits clamp the timeouts of the webhooks adding up to it
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.NamespacedValidatingType{}}, crhandler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			return quotasInAllNamespaces(mgr.GetClient())
+		},
+	))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// quotasInAllNamespaces returns a request for one of the quotas of each namespace having any
+func quotasInAllNamespaces(c client.Client) []reconcile.Request {
+	quotaList := &appv1alpha1.WebhookQuotaList{}
+	err := c.List(context.TODO(), quotaList)
+	if err != nil {
+		log.Error(err, "quota list failed")
+		return nil
+	}
+
+	var ret []reconcile.Request
+	seen := make(map[string]bool)
+	for _, quota := range quotaList.Items {
+		if seen[quota.Namespace] {
+			continue
+		}
+		seen[quota.Namespace] = true
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: quota.Namespace, Name: quota.Name}})
+	}
+
+	return ret
+}
+
+// quotasInNamespace returns a request for one of namespace's quotas, as reconciling any of them reconciles all
+func quotasInNamespace(c client.Client, namespace string) []reconcile.Request {
+	quotaList := &appv1alpha1.WebhookQuotaList{}
+	err := c.List(context.TODO(), quotaList, client.InNamespace(namespace))
+	if err != nil {
+		log.Error(err, "quota list failed")
+		return nil
+	}
+
+	if len(quotaList.Items) == 0 {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: quotaList.Items[0].Name}}}
+}
+
+// blank assignment to verify that ReconcileWebhookQuota implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileWebhookQuota{}
+
+// ReconcileWebhookQuota reconciles the WebhookQuotas of a namespace
+type ReconcileWebhookQuota struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// Reconcile evaluates the quotas of the request's namespace against its rules, keeping QuotaData, which the admission
+// proxy enforces, and the quotas' status up to date
+func (r *ReconcileWebhookQuota) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	reqLogger.V(1).Info("Reconciling WebhookQuota")
+
+	observedState, err := observe(r.client, request, reqLogger)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	analyzedState, err := analyze(observedState, reqLogger)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	err = act(r.client, analyzedState, reqLogger)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookservicegrant
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func act(kubeClient client.Client, state *analyzedState, logger logr.Logger) error {
+	if state.customResource != nil && manageGeneration(state, logger) {
+		logger.V(2).Info("doing status update")
+		err := kubeClient.Status().Update(context.TODO(), state.customResource)
+		if err != nil {
+			logger.Error(err, "failed to do status update")
+			return err
+		}
+	}
+
+	if state.update {
+		logger.V(1).Info("updating grant data")
+	}
+	GrantData = state.newGrantData
+
+	return nil
+}
+
+func manageGeneration(state *analyzedState, logger logr.Logger) bool {
+	var ret bool
+
+	if state.customResource.Status.ObservedGeneration != state.customResource.Generation {
+		logger.V(2).Info("updating observed generation in status")
+		state.customResource.Status.ObservedGeneration = state.customResource.Generation
+		ret = true
+	}
+
+	return ret
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookservicegrant
+
+import (
+	"reflect"
+
+	"github.com/go-logr/logr"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+type analyzedState struct {
+	customResource *v1alpha1.WebhookServiceGrant
+	newGrantData   *GrantDataType
+	update         bool
+}
+
+func analyze(observed *observeState, logger logr.Logger) (*analyzedState, error) {
+	state := &analyzedState{
+		customResource: observed.customResource,
+	}
+
+	// grants carry no external state, so there's no need for a finalizer, a deleted grant is removed by name
+	if observed.customResource == nil {
+		logger.V(2).Info("grant deleted")
+		state.newGrantData = GrantData.Delete(observed.name)
+	} else {
+		state.newGrantData = GrantData.Update(observed.customResource)
+	}
+
+	if !reflect.DeepEqual(state.newGrantData, GrantData) {
+		state.update = true
+	}
+
+	return state, nil
+}
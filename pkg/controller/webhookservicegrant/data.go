@@ -0,0 +1,151 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookservicegrant
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+var (
+	GrantData = &GrantDataType{
+		Mapping: make(grantNamespaceMap),
+	}
+)
+
+// grantNameMap maps a grant's name to its spec
+type grantNameMap map[string]appv1alpha1.WebhookServiceGrantSpec
+
+// grantNamespaceMap maps the namespace services are granted in to the grants in it
+type grantNamespaceMap map[string]grantNameMap
+
+type GrantDataType struct {
+	Mapping grantNamespaceMap
+}
+
+// NewGrantData builds the grant data for a list of grants, without touching GrantData
+func NewGrantData(grants []appv1alpha1.WebhookServiceGrant) *GrantDataType {
+	ret := &GrantDataType{Mapping: make(grantNamespaceMap)}
+
+	for i := range grants {
+		ret = ret.Add(&grants[i])
+	}
+
+	return ret
+}
+
+// Allowed returns true if a rule in namespace fromNamespace may point a webhook at service.
+// Services in the rule's own namespace are always allowed.
+func (p *GrantDataType) Allowed(fromNamespace string, service types.NamespacedName) bool {
+	if service.Namespace == fromNamespace {
+		return true
+	}
+
+	for _, spec := range p.Mapping[service.Namespace] {
+		if grants(spec, fromNamespace, service.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func grants(spec appv1alpha1.WebhookServiceGrantSpec, fromNamespace, serviceName string) bool {
+	var fromFound bool
+	for _, from := range spec.From {
+		if from.Namespace == fromNamespace {
+			fromFound = true
+			break
+		}
+	}
+	if !fromFound {
+		return false
+	}
+
+	if len(spec.To) == 0 {
+		return true
+	}
+
+	for _, to := range spec.To {
+		if to.Name == serviceName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *GrantDataType) Add(g *appv1alpha1.WebhookServiceGrant) *GrantDataType {
+	newG := copyGrantData(p)
+
+	if newG.Mapping == nil {
+		newG.Mapping = make(grantNamespaceMap)
+	}
+
+	if _, ok := newG.Mapping[g.Namespace]; !ok {
+		newG.Mapping[g.Namespace] = make(grantNameMap)
+	}
+
+	newG.Mapping[g.Namespace][g.Name] = g.Spec
+
+	return newG
+}
+
+// Delete removes a grant by name, as a deleted grant can't be retrieved to find it by
+func (p *GrantDataType) Delete(name types.NamespacedName) *GrantDataType {
+	newG := copyGrantData(p)
+
+	if nameMap, ok := newG.Mapping[name.Namespace]; ok {
+		delete(nameMap, name.Name)
+		if len(nameMap) == 0 {
+			delete(newG.Mapping, name.Namespace)
+		}
+	}
+
+	return newG
+}
+
+func (p *GrantDataType) Update(g *appv1alpha1.WebhookServiceGrant) *GrantDataType {
+	newG := p.Delete(types.NamespacedName{Namespace: g.Namespace, Name: g.Name})
+	newG = newG.Add(g)
+
+	return newG
+}
+
+func copyGrantData(p *GrantDataType) *GrantDataType {
+	var newP GrantDataType
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	dec := gob.NewDecoder(&buf)
+
+	err := enc.Encode(p)
+	if err != nil {
+		return nil
+	}
+
+	err = dec.Decode(&newP)
+	if err != nil {
+		return nil
+	}
+
+	return &newP
+}
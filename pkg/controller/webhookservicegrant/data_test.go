@@ -0,0 +1,93 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookservicegrant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+const (
+	sourceNamespace = "source"
+	targetNamespace = "target"
+	service1        = "service1"
+	service2        = "service2"
+)
+
+var (
+	allServicesGrant = &v1alpha1.WebhookServiceGrant{
+		ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: targetNamespace},
+		Spec: v1alpha1.WebhookServiceGrantSpec{
+			From: []v1alpha1.WebhookServiceGrantFrom{{Namespace: sourceNamespace}},
+		},
+	}
+
+	oneServiceGrant = &v1alpha1.WebhookServiceGrant{
+		ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: targetNamespace},
+		Spec: v1alpha1.WebhookServiceGrantSpec{
+			From: []v1alpha1.WebhookServiceGrantFrom{{Namespace: sourceNamespace}},
+			To:   []v1alpha1.WebhookServiceGrantTo{{Name: service1}},
+		},
+	}
+)
+
+func TestAllowedSameNamespace(t *testing.T) {
+	g := &GrantDataType{}
+
+	assert.True(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: sourceNamespace, Name: service1}))
+	assert.False(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service1}))
+}
+
+func TestAllowedServices(t *testing.T) {
+	g := (&GrantDataType{}).Add(oneServiceGrant)
+
+	assert.True(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service1}))
+	assert.False(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service2}))
+	assert.False(t, g.Allowed("other", types.NamespacedName{Namespace: targetNamespace, Name: service1}))
+
+	g = g.Add(allServicesGrant)
+	assert.True(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service2}))
+}
+
+func TestDelete(t *testing.T) {
+	g := NewGrantData([]v1alpha1.WebhookServiceGrant{*oneServiceGrant, *allServicesGrant})
+
+	newG := g.Delete(types.NamespacedName{Namespace: targetNamespace, Name: allServicesGrant.Name})
+	assert.False(t, newG.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service2}))
+	assert.True(t, newG.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service1}))
+	// the original is untouched
+	assert.True(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service2}))
+
+	newG = newG.Delete(types.NamespacedName{Namespace: targetNamespace, Name: oneServiceGrant.Name})
+	assert.Empty(t, newG.Mapping)
+}
+
+func TestUpdate(t *testing.T) {
+	g := (&GrantDataType{}).Add(allServicesGrant)
+
+	narrowed := allServicesGrant.DeepCopy()
+	narrowed.Spec.To = []v1alpha1.WebhookServiceGrantTo{{Name: service1}}
+	g = g.Update(narrowed)
+
+	assert.True(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service1}))
+	assert.False(t, g.Allowed(sourceNamespace, types.NamespacedName{Namespace: targetNamespace, Name: service2}))
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookservicegrant
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+type observeState struct {
+	name types.NamespacedName
+	// customResource is nil once the grant has been deleted
+	customResource *v1alpha1.WebhookServiceGrant
+}
+
+func observe(kubeClient client.Client, request reconcile.Request, logger logr.Logger) (*observeState, error) {
+	ret := &observeState{
+		name:           request.NamespacedName,
+		customResource: &v1alpha1.WebhookServiceGrant{},
+	}
+
+	err := kubeClient.Get(context.TODO(), request.NamespacedName, ret.customResource)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.V(2).Info("didn't find resource")
+			ret.customResource = nil
+			return ret, nil
+		}
+		return nil, err
+	}
+
+	return ret, nil
+}
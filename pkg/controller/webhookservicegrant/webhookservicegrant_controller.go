@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookservicegrant
+
+import (
+	"context"
+
+	"github.com/operator-framework/operator-lib/handler"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	appv1alpha1 "github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+var log = logf.Log.WithName("controller_webhookservicegrant")
+
+// Add creates a new WebhookServiceGrant Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileWebhookServiceGrant{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("webhookservicegrant-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource WebhookServiceGrant
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.WebhookServiceGrant{}}, &handler.InstrumentedEnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileWebhookServiceGrant implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileWebhookServiceGrant{}
+
+// ReconcileWebhookServiceGrant reconciles a WebhookServiceGrant object
+type ReconcileWebhookServiceGrant struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+// Reconcile keeps GrantData, which the admission proxy checks cross-namespace webhooks against, in sync with the
+// WebhookServiceGrants in the cluster
+func (r *ReconcileWebhookServiceGrant) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	reqLogger.V(1).Info("Reconciling WebhookServiceGrant")
+
+	observedState, err := observe(r.client, request, reqLogger)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	analyzedState, err := analyze(observedState, reqLogger)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	err = act(r.client, analyzedState, reqLogger)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
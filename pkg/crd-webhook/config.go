@@ -0,0 +1,148 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"context"
+
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/common"
+)
+
+const (
+	WebhookName         = "crd.webhook.gesher"
+	MutatingWebhookName = "creator.crd.webhook.gesher"
+)
+
+// GenerateWebhookConfig returns the configuration sending gesher's own resources to the Validator
+func GenerateWebhookConfig(namespace, service string, caBundle []byte) *admregv1.ValidatingWebhookConfiguration {
+	path := common.ValidatePath
+	fail := admregv1.Fail
+	sideEffects := admregv1.SideEffectClassNone
+	scope := admregv1.AllScopes
+	var timeout int32 = 10
+
+	return &admregv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: WebhookName},
+		Webhooks: []admregv1.ValidatingWebhook{{
+			Name: WebhookName,
+			ClientConfig: admregv1.WebhookClientConfig{
+				Service: &admregv1.ServiceReference{
+					Namespace: namespace,
+					Name:      service,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{admregv1.Create, admregv1.Update},
+				Rule: admregv1.Rule{
+					APIGroups:   []string{v1alpha1.SchemeGroupVersion.Group},
+					APIVersions: []string{v1alpha1.SchemeGroupVersion.Version},
+					Resources:   []string{"namespacedvalidatingtypes", "namespacedvalidatingrules", "webhookservicegrants", "webhookquotas"},
+					Scope:       &scope,
+				},
+			}},
+			FailurePolicy:           &fail,
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeout,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}
+}
+
+// EnsureWebhookConfig creates config, or brings an existing one up to date with it
+func EnsureWebhookConfig(client kubernetes.Interface, config *admregv1.ValidatingWebhookConfiguration) error {
+	existing, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), config.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		log.Info("creating webhook configuration", "Name", config.Name)
+		_, err = client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(context.TODO(), config, metav1.CreateOptions{})
+		return err
+	}
+
+	log.Info("updating webhook configuration", "Name", config.Name)
+	existing.Webhooks = config.Webhooks
+	_, err = client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Update(context.TODO(), existing, metav1.UpdateOptions{})
+
+	return err
+}
+
+// GenerateMutatingWebhookConfig returns the configuration sending NamespacedValidatingRules to the Mutator
+func GenerateMutatingWebhookConfig(namespace, service string, caBundle []byte) *admregv1.MutatingWebhookConfiguration {
+	path := common.MutatePath
+	fail := admregv1.Fail
+	sideEffects := admregv1.SideEffectClassNone
+	scope := admregv1.NamespacedScope
+	var timeout int32 = 10
+
+	return &admregv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: MutatingWebhookName},
+		Webhooks: []admregv1.MutatingWebhook{{
+			Name: MutatingWebhookName,
+			ClientConfig: admregv1.WebhookClientConfig{
+				Service: &admregv1.ServiceReference{
+					Namespace: namespace,
+					Name:      service,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admregv1.RuleWithOperations{{
+				Operations: []admregv1.OperationType{admregv1.Create, admregv1.Update},
+				Rule: admregv1.Rule{
+					APIGroups:   []string{v1alpha1.SchemeGroupVersion.Group},
+					APIVersions: []string{v1alpha1.SchemeGroupVersion.Version},
+					Resources:   []string{"namespacedvalidatingrules"},
+					Scope:       &scope,
+				},
+			}},
+			FailurePolicy:           &fail,
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeout,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}
+}
+
+// EnsureMutatingWebhookConfig creates config, or brings an existing one up to date with it
+func EnsureMutatingWebhookConfig(client kubernetes.Interface, config *admregv1.MutatingWebhookConfiguration) error {
+	existing, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), config.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		log.Info("creating webhook configuration", "Name", config.Name)
+		_, err = client.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(context.TODO(), config, metav1.CreateOptions{})
+		return err
+	}
+
+	log.Info("updating webhook configuration", "Name", config.Name)
+	existing.Webhooks = config.Webhooks
+	_, err = client.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(context.TODO(), existing, metav1.UpdateOptions{})
+
+	return err
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	admv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+// Mutator is the admission handler recording who created each NamespacedValidatingRule
+type Mutator struct {
+	client  client.Client
+	decoder *admission.Decoder
+	// self is the username gesher runs as, which is never recorded as a creator
+	self string
+}
+
+var _ admission.Handler = &Mutator{}
+
+// NewMutator returns a Mutator reviewing access through c, self being the username gesher runs as
+func NewMutator(c client.Client, scheme *runtime.Scheme, self string) (*Mutator, error) {
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mutator{client: c, decoder: decoder, self: self}, nil
+}
+
+func (m *Mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Kind.Kind != "NamespacedValidatingRule" || (req.Operation != admv1.Create && req.Operation != admv1.Update) {
+		return admission.Allowed("")
+	}
+
+	rule := &v1alpha1.NamespacedValidatingRule{}
+	if err := m.decoder.Decode(req, rule); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var old *v1alpha1.NamespacedValidatingRule
+	if req.Operation == admv1.Update {
+		old = &v1alpha1.NamespacedValidatingRule{}
+		if err := m.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	changed, err := recordCreator(rule, old, req.UserInfo, m.self, func(claimed *authenticationv1.UserInfo) (bool, error) {
+		return mayImpersonate(ctx, m.client, req.UserInfo, claimed)
+	})
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !changed {
+		return admission.Allowed("")
+	}
+
+	marshaled, err := json.Marshal(rule)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// recordCreator sets rule's creator annotation to user on creation, and keeps it from changing afterwards.  A rule
+// without a creator, as it predates the annotation or was created by a system identity, is never attributed to
+// whoever updates it, so it may not use the types requiring the use permission until someone mayClaim allows, as
+// they may impersonate the creator claimed in its annotation, sets it.  It returns true if rule changed.
+func recordCreator(rule, old *v1alpha1.NamespacedValidatingRule, user authenticationv1.UserInfo, self string, mayClaim func(*authenticationv1.UserInfo) (bool, error)) (bool, error) {
+	creator, found := "", false
+	if old != nil {
+		creator, found = old.Annotations[v1alpha1.CreatorAnnotation]
+	}
+
+	if !found {
+		var err error
+		creator, found, err = newCreator(rule, old == nil, user, self, mayClaim)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	current, ok := rule.Annotations[v1alpha1.CreatorAnnotation]
+	if !found {
+		delete(rule.Annotations, v1alpha1.CreatorAnnotation)
+		return ok, nil
+	}
+
+	if ok && current == creator {
+		return false, nil
+	}
+
+	if rule.Annotations == nil {
+		rule.Annotations = make(map[string]string)
+	}
+	rule.Annotations[v1alpha1.CreatorAnnotation] = creator
+
+	return true, nil
+}
+
+// newCreator returns the creator of a rule that has none yet: the one its annotation claims, if mayClaim allows it,
+// or else user when creating the rule, unless they are a system identity
+func newCreator(rule *v1alpha1.NamespacedValidatingRule, creating bool, user authenticationv1.UserInfo, self string, mayClaim func(*authenticationv1.UserInfo) (bool, error)) (string, bool, error) {
+	// an unreadable claim is no claim
+	if claimed, _ := namespacedvalidatingrule.Creator(rule); claimed != nil {
+		allowed, err := mayClaim(claimed)
+		if err != nil {
+			return "", false, err
+		}
+		if allowed {
+			return rule.Annotations[v1alpha1.CreatorAnnotation], true, nil
+		}
+	}
+
+	if !creating || systemIdentity(user.Username, self) {
+		return "", false, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(data), true, nil
+}
+
+// systemIdentity returns true if username is gesher's own, self, or that of a component of the cluster rather than of
+// a tenant: a system user other than a service account, or a service account of the kube-system namespace
+func systemIdentity(username, self string) bool {
+	if username == self {
+		return true
+	}
+
+	if strings.HasPrefix(username, serviceAccountPrefix) {
+		return strings.HasPrefix(username, serviceAccountPrefix+metav1.NamespaceSystem+":")
+	}
+
+	return strings.HasPrefix(username, "system:")
+}
+
+// serviceAccountPrefix starts the usernames of service accounts
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// ServiceAccountUsername returns the username of the service account with the given namespace and name
+func ServiceAccountUsername(namespace, name string) string {
+	return serviceAccountPrefix + namespace + ":" + name
+}
+
+// mayImpersonate returns true if user may impersonate claimed, both their username and their groups
+func mayImpersonate(ctx context.Context, c client.Client, user authenticationv1.UserInfo, claimed *authenticationv1.UserInfo) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	check := func(resource, name string) (bool, error) {
+		sar := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     "impersonate",
+					Resource: resource,
+					Name:     name,
+				},
+				User:   user.Username,
+				Groups: user.Groups,
+				UID:    user.UID,
+				Extra:  extra,
+			},
+		}
+
+		if err := c.Create(ctx, sar); err != nil {
+			return false, err
+		}
+
+		return sar.Status.Allowed, nil
+	}
+
+	allowed, err := check("users", claimed.Username)
+	if err != nil || !allowed {
+		return false, err
+	}
+
+	for _, group := range claimed.Groups {
+		allowed, err := check("groups", group)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
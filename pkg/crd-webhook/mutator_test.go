@@ -0,0 +1,115 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+)
+
+const testSelf = "system:serviceaccount:gesher:gesher"
+
+// claimsBy allows only those named to claim a creator
+func claimsBy(names ...string) func(authenticationv1.UserInfo) func(*authenticationv1.UserInfo) (bool, error) {
+	return func(user authenticationv1.UserInfo) func(*authenticationv1.UserInfo) (bool, error) {
+		return func(*authenticationv1.UserInfo) (bool, error) {
+			for _, name := range names {
+				if name == user.Username {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+}
+
+func TestRecordCreator(t *testing.T) {
+	alice := authenticationv1.UserInfo{Username: "alice", Groups: []string{"tenants"}}
+	bob := authenticationv1.UserInfo{Username: "bob"}
+	mayClaim := claimsBy("admin")
+
+	rule := testRuleResource(t)
+	// a creator supplied by the user is overwritten
+	rule.Annotations = map[string]string{v1alpha1.CreatorAnnotation: `{"username":"admin"}`}
+
+	changed, err := recordCreator(rule, nil, alice, testSelf, mayClaim(alice))
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	creator, err := namespacedvalidatingrule.Creator(rule)
+	assert.Nil(t, err)
+	assert.Equal(t, alice, *creator)
+
+	// updates keep the original creator
+	updated := rule.DeepCopy()
+	updated.Annotations[v1alpha1.CreatorAnnotation] = `{"username":"bob"}`
+	changed, err = recordCreator(updated, rule, bob, testSelf, mayClaim(bob))
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, rule.Annotations, updated.Annotations)
+
+	changed, err = recordCreator(rule.DeepCopy(), rule, bob, testSelf, mayClaim(bob))
+	assert.Nil(t, err)
+	assert.False(t, changed)
+}
+
+func TestRecordCreatorUnknown(t *testing.T) {
+	bob := authenticationv1.UserInfo{Username: "bob"}
+	admin := authenticationv1.UserInfo{Username: "admin"}
+	mayClaim := claimsBy("admin")
+
+	// rules without a creator aren't attributed to whoever updates them
+	legacy := testRuleResource(t)
+	updated := legacy.DeepCopy()
+	changed, err := recordCreator(updated, legacy, bob, testSelf, mayClaim(bob))
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.NotContains(t, updated.Annotations, v1alpha1.CreatorAnnotation)
+
+	// nor can they claim to have created them
+	updated.Annotations = map[string]string{v1alpha1.CreatorAnnotation: `{"username":"bob"}`}
+	changed, err = recordCreator(updated, legacy, bob, testSelf, mayClaim(bob))
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.NotContains(t, updated.Annotations, v1alpha1.CreatorAnnotation)
+
+	// but someone who may impersonate the creator can set them
+	updated.Annotations = map[string]string{v1alpha1.CreatorAnnotation: `{"username":"bob"}`}
+	changed, err = recordCreator(updated, legacy, admin, testSelf, mayClaim(admin))
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, `{"username":"bob"}`, updated.Annotations[v1alpha1.CreatorAnnotation])
+
+	// gesher and the cluster's components never create rules
+	for _, username := range []string{testSelf, "system:kube-controller-manager", "system:serviceaccount:kube-system:generic-garbage-collector"} {
+		rule := testRuleResource(t)
+		changed, err = recordCreator(rule, nil, authenticationv1.UserInfo{Username: username}, testSelf, mayClaim(bob))
+		assert.Nil(t, err)
+		assert.False(t, changed)
+		assert.NotContains(t, rule.Annotations, v1alpha1.CreatorAnnotation)
+	}
+
+	// while tenants' service accounts do
+	rule := testRuleResource(t)
+	changed, err = recordCreator(rule, nil, authenticationv1.UserInfo{Username: "system:serviceaccount:tenant:ci"}, testSelf, mayClaim(bob))
+	assert.Nil(t, err)
+	assert.True(t, changed)
+}
@@ -0,0 +1,533 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"fmt"
+	pathpkg "path"
+	"strings"
+
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/bypass"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookquota"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
+)
+
+const (
+	// the api server's own limit on webhook timeouts
+	maxTimeoutSeconds = 30
+	// maxAttempts bounds webhook retries, as they all have to fit in the webhook's timeout
+	maxAttempts = 5
+)
+
+var (
+	supportedOperations = []string{
+		string(admregv1.OperationAll),
+		string(admregv1.Create),
+		string(admregv1.Update),
+		string(admregv1.Delete),
+		string(admregv1.Connect),
+	}
+	supportedFailurePolicies = []string{string(admregv1.Fail), string(admregv1.Ignore)}
+	supportedTypeScopes      = []string{string(admregv1.NamespacedScope), string(admregv1.AllScopes)}
+	supportedEvaluations     = []string{string(v1alpha1.EvaluationParallel), string(v1alpha1.EvaluationSequential)}
+	supportedDecisions       = []string{string(v1alpha1.DecisionAllMustAllow), string(v1alpha1.DecisionAnyAllows), string(v1alpha1.DecisionMajority)}
+)
+
+// ValidateNamespacedValidatingType returns the problems that would keep t from being proxied
+func ValidateNamespacedValidatingType(t *v1alpha1.NamespacedValidatingType) field.ErrorList {
+	var errs field.ErrorList
+
+	typesPath := field.NewPath("spec", "types")
+	if len(t.Spec.Types) == 0 {
+		errs = append(errs, field.Required(typesPath, "a type has to proxy at least one rule"))
+	}
+
+	for i, rule := range t.Spec.Types {
+		rulePath := typesPath.Index(i)
+		errs = append(errs, validateRule(rule, rulePath)...)
+
+		// the proxy webhook only ever receives namespaced resources
+		if rule.Scope != nil && !contains(supportedTypeScopes, string(*rule.Scope)) {
+			errs = append(errs, field.NotSupported(rulePath.Child("scope"), *rule.Scope, supportedTypeScopes))
+		}
+	}
+
+	if t.Spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(t.Spec.NamespaceSelector); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "namespaceSelector"), t.Spec.NamespaceSelector, err.Error()))
+		}
+	}
+
+	if limits := t.Spec.WebhookLimits; limits != nil {
+		limitsPath := field.NewPath("spec", "webhookLimits")
+
+		if limits.MaxFailurePolicy != nil && !contains(supportedFailurePolicies, string(*limits.MaxFailurePolicy)) {
+			errs = append(errs, field.NotSupported(limitsPath.Child("maxFailurePolicy"), *limits.MaxFailurePolicy, supportedFailurePolicies))
+		}
+
+		if limits.MaxTimeoutSeconds != nil && (*limits.MaxTimeoutSeconds < 1 || *limits.MaxTimeoutSeconds > maxTimeoutSeconds) {
+			errs = append(errs, field.Invalid(limitsPath.Child("maxTimeoutSeconds"), *limits.MaxTimeoutSeconds,
+				fmt.Sprintf("must be between 1 and %v seconds", maxTimeoutSeconds)))
+		}
+
+		for i, op := range limits.IgnoreOperations {
+			if !contains(supportedOperations, string(op)) {
+				errs = append(errs, field.NotSupported(limitsPath.Child("ignoreOperations").Index(i), op, supportedOperations))
+			}
+		}
+	}
+
+	if t.Spec.UserInfo != nil {
+		errs = append(errs, validateUserInfo(*t.Spec.UserInfo, field.NewPath("spec", "userInfo"))...)
+	}
+
+	redactionsPath := field.NewPath("spec", "redactions")
+	supportedModes := []string{string(v1alpha1.RedactionRemove), string(v1alpha1.RedactionHash)}
+	for i, redaction := range t.Spec.Redactions {
+		errs = append(errs, validateFieldPath(redaction.Path, redactionsPath.Index(i).Child("path"))...)
+		if redaction.Mode != "" && !contains(supportedModes, string(redaction.Mode)) {
+			errs = append(errs, field.NotSupported(redactionsPath.Index(i).Child("mode"), redaction.Mode, supportedModes))
+		}
+	}
+
+	if _, err := bypass.Parse(t.Annotations); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(v1alpha1.BypassAnnotation),
+			t.Annotations[v1alpha1.BypassAnnotation], err.Error()))
+	}
+
+	deniedPath := field.NewPath("spec", "deniedNamespaces")
+	for i, namespace := range t.Spec.DeniedNamespaces {
+		if contains(t.Spec.AllowedNamespaces, namespace) {
+			errs = append(errs, field.Invalid(deniedPath.Index(i), namespace, "namespace is also allowed"))
+		}
+	}
+
+	return errs
+}
+
+// ValidateNamespacedValidatingRule returns the problems that would keep rule's webhooks from being called, including
+// services in other namespaces that none of grantData's grants allow and rules only covered by types canUse says the
+// requesting user may not use, as well as warnings for the parts of it that are valid, but not proxied by any of
+// typeData's types
+func ValidateNamespacedValidatingRule(rule *v1alpha1.NamespacedValidatingRule, typeData *namespacedvalidatingtype.NamespacedTypeData, grantData *webhookservicegrant.GrantDataType, canUse func(string) bool) (field.ErrorList, []string) {
+	var errs field.ErrorList
+	var warnings []string
+
+	if rule.Spec.Evaluation != "" && !contains(supportedEvaluations, string(rule.Spec.Evaluation)) {
+		errs = append(errs, field.NotSupported(field.NewPath("spec", "evaluation"), rule.Spec.Evaluation, supportedEvaluations))
+	}
+
+	if rule.Spec.Decision != "" && !contains(supportedDecisions, string(rule.Spec.Decision)) {
+		errs = append(errs, field.NotSupported(field.NewPath("spec", "decision"), rule.Spec.Decision, supportedDecisions))
+	}
+
+	names := make(map[string]bool)
+	webhooksPath := field.NewPath("spec", "webhooks")
+
+	for i, webhook := range rule.Spec.Webhooks {
+		webhookPath := webhooksPath.Index(i)
+
+		switch {
+		case webhook.Name == "":
+			errs = append(errs, field.Required(webhookPath.Child("name"), ""))
+		case names[webhook.Name]:
+			errs = append(errs, field.Duplicate(webhookPath.Child("name"), webhook.Name))
+		}
+		names[webhook.Name] = true
+
+		errs = append(errs, validateClientConfig(webhook.ClientConfig, rule.Namespace, grantData, webhookPath.Child("clientConfig"))...)
+		for j, target := range webhook.Failover {
+			errs = append(errs, validateClientConfig(target, rule.Namespace, grantData, webhookPath.Child("failover").Index(j))...)
+		}
+		errs = append(errs, validateBackends(webhook.Backends, rule.Namespace, grantData, webhookPath.Child("backends"))...)
+
+		if webhook.TimeoutSeconds != nil && (*webhook.TimeoutSeconds < 1 || *webhook.TimeoutSeconds > maxTimeoutSeconds) {
+			errs = append(errs, field.Invalid(webhookPath.Child("timeoutSeconds"), *webhook.TimeoutSeconds,
+				fmt.Sprintf("must be between 1 and %v seconds", maxTimeoutSeconds)))
+		}
+
+		if webhook.FailurePolicy != nil && !contains(supportedFailurePolicies, string(*webhook.FailurePolicy)) {
+			errs = append(errs, field.NotSupported(webhookPath.Child("failurePolicy"), *webhook.FailurePolicy, supportedFailurePolicies))
+		}
+
+		if webhook.UserInfo != nil {
+			errs = append(errs, validateUserInfo(*webhook.UserInfo, webhookPath.Child("userInfo"))...)
+		}
+
+		errs = append(errs, validateGlobs(webhook.ResourceNames, webhookPath.Child("resourceNames"))...)
+		for j, resourceName := range webhook.ResourceNames {
+			if resourceName == "" {
+				errs = append(errs, field.Required(webhookPath.Child("resourceNames").Index(j), ""))
+			}
+		}
+
+		if webhook.UpdateFilter != nil {
+			errs = append(errs, validateUpdateFilter(*webhook.UpdateFilter, webhookPath.Child("updateFilter"))...)
+		}
+
+		if webhook.NamespaceMetadata != nil {
+			metadataPath := webhookPath.Child("namespaceMetadata")
+			errs = append(errs, validateGlobs(webhook.NamespaceMetadata.Labels, metadataPath.Child("labels"))...)
+			errs = append(errs, validateGlobs(webhook.NamespaceMetadata.Annotations, metadataPath.Child("annotations"))...)
+		}
+
+		errs = append(errs, validateFieldPaths(webhook.Projection, webhookPath.Child("projection"))...)
+
+		if webhook.Retry != nil {
+			errs = append(errs, validateRetry(*webhook.Retry, webhookPath.Child("retry"))...)
+		}
+
+		rulesPath := webhookPath.Child("rules")
+		if len(webhook.Rules) == 0 {
+			errs = append(errs, field.Required(rulesPath, "a webhook without rules is never called"))
+		}
+
+		for j, webhookRule := range webhook.Rules {
+			rulePath := rulesPath.Index(j)
+			ruleErrs := validateRule(webhookRule, rulePath)
+			errs = append(errs, ruleErrs...)
+			if len(ruleErrs) > 0 {
+				continue
+			}
+
+			accepted, rejected := namespacedvalidatingrule.SplitRule(webhookRule, typeData)
+			for _, r := range rejected {
+				warnings = append(warnings, fmt.Sprintf("%v: no NamespacedValidatingType covers %v on %v, it won't be proxied",
+					rulePath, operationsString(r.Operations), resourceString(r.Rule)))
+			}
+
+			_, unusable := namespacedvalidatingrule.SplitUsable(accepted, typeData, canUse)
+			for _, r := range unusable {
+				errs = append(errs, field.Forbidden(rulePath, fmt.Sprintf("%v on %v is only covered by NamespacedValidatingTypes requiring the %v verb",
+					operationsString(r.Operations), resourceString(r.Rule), v1alpha1.UseVerb)))
+			}
+
+			warnings = append(warnings, limitWarnings(webhook.ValidatingWebhook, accepted, typeData, rulePath)...)
+		}
+	}
+
+	return errs, warnings
+}
+
+// ValidateWebhookServiceGrant returns the problems with grant's namespace and service lists
+func ValidateWebhookServiceGrant(grant *v1alpha1.WebhookServiceGrant) field.ErrorList {
+	var errs field.ErrorList
+
+	fromPath := field.NewPath("spec", "from")
+	if len(grant.Spec.From) == 0 {
+		errs = append(errs, field.Required(fromPath, "a grant has to allow at least one namespace"))
+	}
+	for i, from := range grant.Spec.From {
+		if from.Namespace == "" {
+			errs = append(errs, field.Required(fromPath.Index(i).Child("namespace"), ""))
+		}
+	}
+
+	toPath := field.NewPath("spec", "to")
+	for i, to := range grant.Spec.To {
+		if to.Name == "" {
+			errs = append(errs, field.Required(toPath.Index(i).Child("name"), "leave out to, to allow all services"))
+		}
+	}
+
+	return errs
+}
+
+// ValidateRuleQuota returns the webhooks of rule that quotas, the WebhookQuotas of its namespace, would not let be
+// proxied, alongside rules, the other rules of the namespace.  It evaluates the quotas like the WebhookQuota controller,
+// whose evaluation the proxy enforces, with the timeouts clamped by the limits of typeData's types.
+func ValidateRuleQuota(rule *v1alpha1.NamespacedValidatingRule, quotas []v1alpha1.WebhookQuota, rules []v1alpha1.NamespacedValidatingRule, typeData *namespacedvalidatingtype.NamespacedTypeData) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	candidate := *rule
+	if candidate.CreationTimestamp.IsZero() {
+		candidate.CreationTimestamp = metav1.Now()
+	}
+
+	all := []v1alpha1.NamespacedValidatingRule{candidate}
+	for _, r := range rules {
+		if r.Name != rule.Name {
+			all = append(all, r)
+		}
+	}
+
+	quota := webhookquota.Evaluate(webhookquota.Limits(quotas), all, typeData)
+
+	webhooksPath := field.NewPath("spec", "webhooks")
+	for i, webhook := range rule.Spec.Webhooks {
+		if reason := quota.Excess[webhookquota.WebhookKey(rule.Name, webhook.Name)]; reason != "" {
+			errs = append(errs, field.Forbidden(webhooksPath.Index(i),
+				fmt.Sprintf("exceeds the WebhookQuota of namespace %v: %v", rule.Namespace, reason)))
+		}
+	}
+
+	return errs
+}
+
+// ValidateWebhookQuota returns the problems with quota's limits
+func ValidateWebhookQuota(quota *v1alpha1.WebhookQuota) field.ErrorList {
+	var errs field.ErrorList
+
+	specPath := field.NewPath("spec")
+	limits := map[string]*int32{
+		"maxWebhooks":       quota.Spec.MaxWebhooks,
+		"maxTimeoutSeconds": quota.Spec.MaxTimeoutSeconds,
+		"maxFanOut":         quota.Spec.MaxFanOut,
+	}
+	for _, name := range []string{"maxWebhooks", "maxTimeoutSeconds", "maxFanOut"} {
+		if limit := limits[name]; limit != nil && *limit < 0 {
+			errs = append(errs, field.Invalid(specPath.Child(name), *limit, "must not be negative"))
+		}
+	}
+
+	return errs
+}
+
+// limitWarnings returns a warning for each of rules, as returned by SplitRule, where the webhook limits of typeData's
+// types clamp webhook's failure policy or timeout
+func limitWarnings(webhook admregv1.ValidatingWebhook, rules []admregv1.RuleWithOperations, typeData *namespacedvalidatingtype.NamespacedTypeData, path *field.Path) []string {
+	var warnings []string
+
+	timeoutSeconds := namespacedvalidatingrule.WebhookTimeout(webhook)
+	failsClosed := webhook.FailurePolicy == nil || *webhook.FailurePolicy == admregv1.Fail
+
+	for _, rule := range rules {
+		kind := &metav1.GroupVersionKind{Group: rule.APIGroups[0], Version: rule.APIVersions[0], Kind: rule.Resources[0]}
+		for _, op := range rule.Operations {
+			limits := typeData.WebhookLimits(kind, op)
+
+			if limits.MaxTimeoutSeconds != nil && timeoutSeconds > *limits.MaxTimeoutSeconds {
+				warnings = append(warnings, fmt.Sprintf("%v: the timeout of %v on %v is limited to %v seconds",
+					path, op, resourceString(rule.Rule), *limits.MaxTimeoutSeconds))
+			}
+
+			if failsClosed && limits.MaxFailurePolicy != nil && *limits.MaxFailurePolicy == admregv1.Ignore {
+				warnings = append(warnings, fmt.Sprintf("%v: failures of %v on %v are ignored", path, op, resourceString(rule.Rule)))
+			}
+		}
+	}
+
+	return warnings
+}
+
+func validateUserInfo(match v1alpha1.UserInfoMatch, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for _, subjects := range []struct {
+		subjects *v1alpha1.UserInfoSubjects
+		path     *field.Path
+	}{{match.Include, path.Child("include")}, {match.Exclude, path.Child("exclude")}} {
+		if subjects.subjects == nil {
+			continue
+		}
+
+		errs = append(errs, validateGlobs(subjects.subjects.Usernames, subjects.path.Child("usernames"))...)
+		errs = append(errs, validateGlobs(subjects.subjects.Groups, subjects.path.Child("groups"))...)
+		errs = append(errs, validateGlobs(subjects.subjects.ServiceAccounts, subjects.path.Child("serviceAccounts"))...)
+		for i, serviceAccount := range subjects.subjects.ServiceAccounts {
+			if !strings.Contains(serviceAccount, "/") {
+				errs = append(errs, field.Invalid(subjects.path.Child("serviceAccounts").Index(i), serviceAccount, "must be namespace/name"))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateUpdateFilter(filter v1alpha1.UpdateFilter, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(filter.Watch) > 0 && len(filter.Ignore) > 0 {
+		errs = append(errs, field.Forbidden(path.Child("ignore"), "cannot be set along with watch"))
+	}
+
+	errs = append(errs, validateFieldPaths(filter.Watch, path.Child("watch"))...)
+	errs = append(errs, validateFieldPaths(filter.Ignore, path.Child("ignore"))...)
+
+	return errs
+}
+
+// validateRetry returns the problems with a webhook's retry policy
+func validateRetry(retry v1alpha1.RetryPolicy, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if retry.MaxAttempts != 0 && (retry.MaxAttempts < 1 || retry.MaxAttempts > maxAttempts) {
+		errs = append(errs, field.Invalid(path.Child("maxAttempts"), retry.MaxAttempts, fmt.Sprintf("must be between 1 and %v", maxAttempts)))
+	}
+
+	if retry.BackoffMilliseconds < 0 {
+		errs = append(errs, field.Invalid(path.Child("backoffMilliseconds"), retry.BackoffMilliseconds, "must not be negative"))
+	}
+
+	if retry.HedgeAfterMilliseconds != nil && *retry.HedgeAfterMilliseconds < 1 {
+		errs = append(errs, field.Invalid(path.Child("hedgeAfterMilliseconds"), *retry.HedgeAfterMilliseconds, "must be positive"))
+	}
+
+	return errs
+}
+
+// validateBackends returns the problems with the backends a webhook's requests are split between
+func validateBackends(backends []v1alpha1.WeightedBackend, namespace string, grantData *webhookservicegrant.GrantDataType, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	var total int32
+	names := make(map[string]bool)
+	for i, backend := range backends {
+		backendPath := path.Index(i)
+
+		switch {
+		case backend.Name == "":
+			errs = append(errs, field.Required(backendPath.Child("name"), ""))
+		case backend.Name == namespacedvalidatingrule.TargetName(0):
+			errs = append(errs, field.Invalid(backendPath.Child("name"), backend.Name, "names the webhook's own clientConfig"))
+		case names[backend.Name]:
+			errs = append(errs, field.Duplicate(backendPath.Child("name"), backend.Name))
+		}
+		names[backend.Name] = true
+
+		if backend.Weight < 0 || backend.Weight > 100 {
+			errs = append(errs, field.Invalid(backendPath.Child("weight"), backend.Weight, "must be a percentage between 0 and 100"))
+		} else {
+			total += backend.Weight
+		}
+
+		errs = append(errs, validateClientConfig(backend.ClientConfig, namespace, grantData, backendPath.Child("clientConfig"))...)
+	}
+
+	if total > 100 {
+		errs = append(errs, field.Invalid(path, total, "the weights of the backends must add up to at most 100"))
+	}
+
+	return errs
+}
+
+func validateFieldPaths(paths []string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for i, p := range paths {
+		errs = append(errs, validateFieldPath(p, path.Index(i))...)
+	}
+
+	return errs
+}
+
+func validateFieldPath(p string, path *field.Path) field.ErrorList {
+	for _, f := range strings.Split(p, ".") {
+		if f == "" {
+			return field.ErrorList{field.Invalid(path, p, "must be a dot-separated path of non-empty field names")}
+		}
+	}
+
+	return nil
+}
+
+func validateGlobs(globs []string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for i, glob := range globs {
+		if _, err := pathpkg.Match(glob, ""); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i), glob, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func validateClientConfig(clientConfig admregv1.WebhookClientConfig, namespace string, grantData *webhookservicegrant.GrantDataType, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if clientConfig.URL != nil {
+		errs = append(errs, field.Forbidden(path.Child("url"), "only service references are supported"))
+	}
+
+	switch {
+	case clientConfig.Service == nil:
+		errs = append(errs, field.Required(path.Child("service"), ""))
+	case clientConfig.Service.Name == "":
+		errs = append(errs, field.Required(path.Child("service", "name"), ""))
+	case clientConfig.Service.Namespace != "" && !grantData.Allowed(namespace,
+		types.NamespacedName{Namespace: clientConfig.Service.Namespace, Name: clientConfig.Service.Name}):
+		errs = append(errs, field.Forbidden(path.Child("service", "namespace"),
+			fmt.Sprintf("no WebhookServiceGrant in namespace %v allows namespace %v to use service %v",
+				clientConfig.Service.Namespace, namespace, clientConfig.Service.Name)))
+	}
+
+	if _, err := namespacedvalidatingrule.ParseCABundle(clientConfig.CABundle); err != nil {
+		errs = append(errs, field.Invalid(path.Child("caBundle"), "", err.Error()))
+	}
+
+	return errs
+}
+
+func validateRule(rule admregv1.RuleWithOperations, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(rule.Operations) == 0 {
+		errs = append(errs, field.Required(path.Child("operations"), ""))
+	}
+	for i, op := range rule.Operations {
+		if !contains(supportedOperations, string(op)) {
+			errs = append(errs, field.NotSupported(path.Child("operations").Index(i), op, supportedOperations))
+		}
+	}
+
+	if len(rule.APIGroups) == 0 {
+		errs = append(errs, field.Required(path.Child("apiGroups"), ""))
+	}
+	if len(rule.APIVersions) == 0 {
+		errs = append(errs, field.Required(path.Child("apiVersions"), ""))
+	}
+	if len(rule.Resources) == 0 {
+		errs = append(errs, field.Required(path.Child("resources"), ""))
+	}
+
+	return errs
+}
+
+func operationsString(ops []admregv1.OperationType) string {
+	var ret []string
+	for _, op := range ops {
+		ret = append(ret, string(op))
+	}
+
+	return strings.Join(ret, ",")
+}
+
+func resourceString(rule admregv1.Rule) string {
+	return fmt.Sprintf("%v/%v/%v", rule.APIGroups[0], rule.APIVersions[0], rule.Resources[0])
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,460 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
+)
+
+const (
+	testGroup    = "testGroup"
+	testVersion  = "testVersion"
+	testResource = "testResource"
+	testOp       = admregv1.Create
+)
+
+var (
+	testRule = admregv1.RuleWithOperations{
+		Operations: []admregv1.OperationType{testOp},
+		Rule: admregv1.Rule{
+			APIGroups:   []string{testGroup},
+			APIVersions: []string{testVersion},
+			Resources:   []string{testResource},
+		},
+	}
+
+	testType = &v1alpha1.NamespacedValidatingType{
+		ObjectMeta: metav1.ObjectMeta{UID: "1", Name: "type"},
+		Spec: v1alpha1.NamespacedValidatingTypeSpec{
+			Types: []admregv1.RuleWithOperations{testRule},
+		},
+	}
+)
+
+func TestValidateType(t *testing.T) {
+	assert.Empty(t, ValidateNamespacedValidatingType(testType))
+
+	invalid := testType.DeepCopy()
+	cluster := admregv1.ClusterScope
+	invalid.Spec.Types[0].Scope = &cluster
+	invalid.Spec.Types[0].Operations = []admregv1.OperationType{"PATCH"}
+	invalid.Spec.Types[0].Resources = nil
+
+	errs := ValidateNamespacedValidatingType(invalid)
+	assert.Len(t, errs, 3)
+	assert.Contains(t, fieldPaths(errs), "spec.types[0].scope")
+	assert.Contains(t, fieldPaths(errs), "spec.types[0].operations[0]")
+	assert.Contains(t, fieldPaths(errs), "spec.types[0].resources")
+
+	assert.Len(t, ValidateNamespacedValidatingType(&v1alpha1.NamespacedValidatingType{}), 1)
+}
+
+func TestValidateTypeNamespaces(t *testing.T) {
+	restricted := testType.DeepCopy()
+	restricted.Spec.AllowedNamespaces = []string{"a", "b"}
+	restricted.Spec.DeniedNamespaces = []string{"b"}
+	restricted.Spec.NamespaceSelector = &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: "Within"}},
+	}
+
+	errs := ValidateNamespacedValidatingType(restricted)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.namespaceSelector")
+	assert.Contains(t, fieldPaths(errs), "spec.deniedNamespaces[0]")
+}
+
+func TestValidateTypeWebhookLimits(t *testing.T) {
+	limited := testType.DeepCopy()
+	failurePolicy := admregv1.FailurePolicyType("Retry")
+	timeout := int32(60)
+	limited.Spec.WebhookLimits = &v1alpha1.WebhookLimits{
+		MaxFailurePolicy:  &failurePolicy,
+		MaxTimeoutSeconds: &timeout,
+		IgnoreOperations:  []admregv1.OperationType{admregv1.Delete, "PATCH"},
+	}
+
+	errs := ValidateNamespacedValidatingType(limited)
+	assert.Len(t, errs, 3)
+	assert.Contains(t, fieldPaths(errs), "spec.webhookLimits.maxFailurePolicy")
+	assert.Contains(t, fieldPaths(errs), "spec.webhookLimits.maxTimeoutSeconds")
+	assert.Contains(t, fieldPaths(errs), "spec.webhookLimits.ignoreOperations[1]")
+}
+
+func TestValidateRuleWebhookLimits(t *testing.T) {
+	limited := testType.DeepCopy()
+	ten := int32(10)
+	limited.Spec.WebhookLimits = &v1alpha1.WebhookLimits{
+		MaxTimeoutSeconds: &ten,
+		IgnoreOperations:  []admregv1.OperationType{admregv1.OperationAll},
+	}
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(limited)
+
+	errs, warnings := ValidateNamespacedValidatingRule(testRuleResource(t), typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Empty(t, errs)
+	assert.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "limited to 10 seconds")
+	assert.Contains(t, warnings[1], "are ignored")
+}
+
+func TestValidateRule(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	errs, warnings := ValidateNamespacedValidatingRule(testRuleResource(t), typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Empty(t, errs)
+	assert.Empty(t, warnings)
+}
+
+func TestValidateRuleInvalid(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	rule := testRuleResource(t)
+	duplicate := rule.Spec.Webhooks[0]
+	url := "https://example.com"
+	duplicate.ClientConfig = admregv1.WebhookClientConfig{URL: &url, CABundle: []byte("garbage")}
+	var timeout int32 = 31
+	duplicate.TimeoutSeconds = &timeout
+	rule.Spec.Webhooks = append(rule.Spec.Webhooks, duplicate)
+
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	paths := fieldPaths(errs)
+	assert.Len(t, errs, 5)
+	assert.Contains(t, paths, "spec.webhooks[1].name")
+	assert.Contains(t, paths, "spec.webhooks[1].clientConfig.url")
+	assert.Contains(t, paths, "spec.webhooks[1].clientConfig.service")
+	assert.Contains(t, paths, "spec.webhooks[1].clientConfig.caBundle")
+	assert.Contains(t, paths, "spec.webhooks[1].timeoutSeconds")
+}
+
+func TestValidateRuleUncovered(t *testing.T) {
+	errs, warnings := ValidateNamespacedValidatingRule(testRuleResource(t), &namespacedvalidatingtype.NamespacedTypeData{}, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Empty(t, errs)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "spec.webhooks[0].rules[0]")
+}
+
+func TestValidateRuleCrossNamespace(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].ClientConfig.Service.Namespace = "other"
+
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].clientConfig.service.namespace")
+
+	grantData := webhookservicegrant.NewGrantData([]v1alpha1.WebhookServiceGrant{{
+		ObjectMeta: metav1.ObjectMeta{Name: "grant", Namespace: "other"},
+		Spec: v1alpha1.WebhookServiceGrantSpec{
+			From: []v1alpha1.WebhookServiceGrantFrom{{Namespace: "test"}},
+			To:   []v1alpha1.WebhookServiceGrantTo{{Name: "service"}},
+		},
+	}})
+	errs, _ = ValidateNamespacedValidatingRule(rule, typeData, grantData, allowAll)
+	assert.Empty(t, errs)
+}
+
+func TestValidateRuleUsePermission(t *testing.T) {
+	restricted := testType.DeepCopy()
+	restricted.Spec.RequireUsePermission = true
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(restricted)
+
+	errs, _ := ValidateNamespacedValidatingRule(testRuleResource(t), typeData, &webhookservicegrant.GrantDataType{}, func(string) bool { return false })
+	assert.Len(t, errs, 1)
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].rules[0]")
+
+	errs, _ = ValidateNamespacedValidatingRule(testRuleResource(t), typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Empty(t, errs)
+}
+
+func TestValidateGrant(t *testing.T) {
+	grant := &v1alpha1.WebhookServiceGrant{
+		Spec: v1alpha1.WebhookServiceGrantSpec{
+			From: []v1alpha1.WebhookServiceGrantFrom{{Namespace: "test"}},
+		},
+	}
+	assert.Empty(t, ValidateWebhookServiceGrant(grant))
+
+	grant.Spec.From = append(grant.Spec.From, v1alpha1.WebhookServiceGrantFrom{})
+	grant.Spec.To = []v1alpha1.WebhookServiceGrantTo{{}}
+	errs := ValidateWebhookServiceGrant(grant)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.from[1].namespace")
+	assert.Contains(t, fieldPaths(errs), "spec.to[0].name")
+
+	assert.Len(t, ValidateWebhookServiceGrant(&v1alpha1.WebhookServiceGrant{}), 1)
+}
+
+func testRuleResource(t *testing.T) *v1alpha1.NamespacedValidatingRule {
+	return &v1alpha1.NamespacedValidatingRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "rule", Namespace: "test"},
+		Spec: v1alpha1.NamespacedValidatingRuleSpec{
+			Webhooks: []v1alpha1.NamespacedValidatingWebhook{{ValidatingWebhook: admregv1.ValidatingWebhook{
+				Name: "webhook",
+				ClientConfig: admregv1.WebhookClientConfig{
+					Service:  &admregv1.ServiceReference{Name: "service"},
+					CABundle: testCABundle(t),
+				},
+				Rules: []admregv1.RuleWithOperations{testRule},
+			}}},
+		},
+	}
+}
+
+func allowAll(string) bool {
+	return true
+}
+
+func fieldPaths(errs field.ErrorList) []string {
+	var ret []string
+	for _, err := range errs {
+		ret = append(ret, err.Field)
+	}
+
+	return ret
+}
+
+func testCABundle(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestValidateRuleQuota(t *testing.T) {
+	rule := testRuleResource(t)
+	existing := testRuleResource(t)
+	existing.Name = "existing"
+	existing.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+
+	assert.Empty(t, ValidateRuleQuota(rule, nil, []v1alpha1.NamespacedValidatingRule{*existing}, nil))
+
+	one := int32(1)
+	quotas := []v1alpha1.WebhookQuota{{Spec: v1alpha1.WebhookQuotaSpec{MaxWebhooks: &one}}}
+	assert.Empty(t, ValidateRuleQuota(rule, quotas, nil, nil))
+	// updating a rule replaces its old version
+	assert.Empty(t, ValidateRuleQuota(existing, quotas, []v1alpha1.NamespacedValidatingRule{*existing}, nil))
+
+	errs := ValidateRuleQuota(rule, quotas, []v1alpha1.NamespacedValidatingRule{*existing}, nil)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.webhooks[0]", errs[0].Field)
+
+	quotas = []v1alpha1.WebhookQuota{{Spec: v1alpha1.WebhookQuotaSpec{MaxFanOut: &one}}}
+	errs = ValidateRuleQuota(rule, quotas, []v1alpha1.NamespacedValidatingRule{*existing}, nil)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.webhooks[0]", errs[0].Field)
+	assert.Contains(t, errs[0].Detail, "rules[0]")
+}
+
+func TestValidateQuota(t *testing.T) {
+	zero, negative := int32(0), int32(-1)
+	quota := &v1alpha1.WebhookQuota{Spec: v1alpha1.WebhookQuotaSpec{MaxWebhooks: &zero}}
+	assert.Empty(t, ValidateWebhookQuota(quota))
+
+	quota.Spec.MaxFanOut = &negative
+	errs := ValidateWebhookQuota(quota)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.maxFanOut", errs[0].Field)
+}
+
+func TestValidateTypeBypass(t *testing.T) {
+	bypassed := testType.DeepCopy()
+	bypassed.Annotations = map[string]string{v1alpha1.BypassAnnotation: "true"}
+	assert.Empty(t, ValidateNamespacedValidatingType(bypassed))
+
+	bypassed.Annotations[v1alpha1.BypassAnnotation] = "tomorrow"
+	errs := ValidateNamespacedValidatingType(bypassed)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "metadata.annotations[gesher.redislabs.com/bypass]", errs[0].Field)
+}
+
+func TestValidateUserInfo(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].UserInfo = &v1alpha1.UserInfoMatch{
+		Include: &v1alpha1.UserInfoSubjects{Usernames: []string{"*@example.com"}, Groups: []string{"[a-"}},
+		Exclude: &v1alpha1.UserInfoSubjects{ServiceAccounts: []string{"test/operator", "operator"}},
+	}
+
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].userInfo.include.groups[0]")
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].userInfo.exclude.serviceAccounts[1]")
+
+	exempting := testType.DeepCopy()
+	exempting.Spec.UserInfo = &v1alpha1.UserInfoMatch{Exclude: &v1alpha1.UserInfoSubjects{Usernames: []string{"[x"}}}
+	errs = ValidateNamespacedValidatingType(exempting)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.userInfo.exclude.usernames[0]", errs[0].Field)
+}
+
+func TestValidateResourceNames(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].ResourceNames = []string{"billing-*", "[a-", ""}
+
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].resourceNames[1]")
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].resourceNames[2]")
+}
+
+func TestValidateUpdateFilter(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].UpdateFilter = &v1alpha1.UpdateFilter{Watch: []string{"spec", "metadata..labels"}}
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.webhooks[0].updateFilter.watch[1]", errs[0].Field)
+
+	rule.Spec.Webhooks[0].UpdateFilter = &v1alpha1.UpdateFilter{Watch: []string{"spec"}, Ignore: []string{"status", ""}}
+	errs, _ = ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].updateFilter.ignore")
+	assert.Contains(t, fieldPaths(errs), "spec.webhooks[0].updateFilter.ignore[1]")
+}
+
+func TestValidateNamespaceMetadata(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].NamespaceMetadata = &v1alpha1.NamespaceMetadataSelection{Labels: []string{"team"}, Annotations: []string{"[a-"}}
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.webhooks[0].namespaceMetadata.annotations[0]", errs[0].Field)
+}
+
+func TestValidateRedactionProjection(t *testing.T) {
+	redacting := testType.DeepCopy()
+	redacting.Spec.Redactions = []v1alpha1.Redaction{
+		{Path: "data", Mode: v1alpha1.RedactionHash},
+		{Path: "data.", Mode: "Encrypt"},
+	}
+	errs := ValidateNamespacedValidatingType(redacting)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.redactions[1].path")
+	assert.Contains(t, fieldPaths(errs), "spec.redactions[1].mode")
+
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].Projection = []string{"spec", ".metadata"}
+	errs, _ = ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.webhooks[0].projection[1]", errs[0].Field)
+}
+
+func TestValidateEvaluationDecision(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+	rule := testRuleResource(t)
+	rule.Spec.Evaluation = v1alpha1.EvaluationSequential
+	rule.Spec.Decision = v1alpha1.DecisionMajority
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Empty(t, errs)
+
+	rule.Spec.Evaluation = "Random"
+	rule.Spec.Decision = "Unanimous"
+	errs, _ = ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, fieldPaths(errs), "spec.evaluation")
+	assert.Contains(t, fieldPaths(errs), "spec.decision")
+}
+
+func TestValidateRetry(t *testing.T) {
+	hedge := int32(50)
+	assert.Empty(t, validateRetry(v1alpha1.RetryPolicy{MaxAttempts: 3, BackoffMilliseconds: 100, HedgeAfterMilliseconds: &hedge}, field.NewPath("retry")))
+	assert.Empty(t, validateRetry(v1alpha1.RetryPolicy{}, field.NewPath("retry")))
+
+	hedge = 0
+	errs := validateRetry(v1alpha1.RetryPolicy{MaxAttempts: 10, BackoffMilliseconds: -1, HedgeAfterMilliseconds: &hedge}, field.NewPath("retry"))
+	assert.Equal(t, []string{"retry.maxAttempts", "retry.backoffMilliseconds", "retry.hedgeAfterMilliseconds"}, fieldPaths(errs))
+}
+
+func TestValidateFailover(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].Failover = []admregv1.WebhookClientConfig{
+		{Service: &admregv1.ServiceReference{Name: "new"}, CABundle: testCABundle(t)},
+		{Service: &admregv1.ServiceReference{Namespace: "other", Name: "shared"}, CABundle: testCABundle(t)},
+	}
+
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Equal(t, []string{"spec.webhooks[0].failover[1].service.namespace"}, fieldPaths(errs))
+}
+
+func TestValidateBackends(t *testing.T) {
+	typeData := (&namespacedvalidatingtype.NamespacedTypeData{}).Add(testType)
+	backend := func(name string, weight int32) v1alpha1.WeightedBackend {
+		return v1alpha1.WeightedBackend{
+			Name:         name,
+			Weight:       weight,
+			ClientConfig: admregv1.WebhookClientConfig{Service: &admregv1.ServiceReference{Name: name}, CABundle: testCABundle(t)},
+		}
+	}
+
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].Backends = []v1alpha1.WeightedBackend{backend("canary", 10), backend("next", 0)}
+	errs, _ := ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Empty(t, errs)
+
+	rule.Spec.Webhooks[0].Backends = []v1alpha1.WeightedBackend{
+		backend("", 10),
+		backend("clientConfig", 10),
+		backend("canary", 60),
+		backend("canary", 30),
+		backend("negative", -1),
+	}
+	rule.Spec.Webhooks[0].Backends[2].ClientConfig.Service.Namespace = "other"
+	errs, _ = ValidateNamespacedValidatingRule(rule, typeData, &webhookservicegrant.GrantDataType{}, allowAll)
+	assert.Equal(t, []string{
+		"spec.webhooks[0].backends[0].name",
+		"spec.webhooks[0].backends[0].clientConfig.service.name",
+		"spec.webhooks[0].backends[1].name",
+		"spec.webhooks[0].backends[2].clientConfig.service.namespace",
+		"spec.webhooks[0].backends[3].name",
+		"spec.webhooks[0].backends[4].weight",
+		"spec.webhooks[0].backends",
+	}, fieldPaths(errs))
+}
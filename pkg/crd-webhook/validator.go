@@ -0,0 +1,228 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	admv1 "k8s.io/api/admission/v1"
+	admregv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingrule"
+	"github.com/redislabs/gesher/pkg/controller/namespacedvalidatingtype"
+	"github.com/redislabs/gesher/pkg/controller/webhookservicegrant"
+)
+
+var log = logf.Log.WithName("crd_webhook")
+
+// Validator is the admission handler for NamespacedValidatingTypes, NamespacedValidatingRules, WebhookServiceGrants and
+// WebhookQuotas
+type Validator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &Validator{}
+
+// NewValidator returns a Validator reading the cluster's types and grants through c
+func NewValidator(c client.Client, scheme *runtime.Scheme) (*Validator, error) {
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validator{client: c, decoder: decoder}, nil
+}
+
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admv1.Create && req.Operation != admv1.Update {
+		return admission.Allowed("")
+	}
+
+	reqLogger := log.WithValues("Kind", req.Kind.Kind, "Namespace", req.Namespace, "Name", req.Name)
+
+	switch req.Kind.Kind {
+	case "NamespacedValidatingType":
+		t := &v1alpha1.NamespacedValidatingType{}
+		if err := v.decoder.Decode(req, t); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		// the bypass annotation is validated along with the spec, as it's set on types whose spec doesn't change
+		old := &v1alpha1.NamespacedValidatingType{}
+		unchanged, err := v.unchanged(req, t, old, func() bool {
+			return equality.Semantic.DeepEqual(old.Spec, t.Spec) && sameAnnotation(old, t, v1alpha1.BypassAnnotation)
+		})
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if unchanged {
+			return admission.Allowed("")
+		}
+
+		errs := ValidateNamespacedValidatingType(t)
+		return toResponse(req, t.Name, errs, nil, reqLogger)
+	case "NamespacedValidatingRule":
+		rule := &v1alpha1.NamespacedValidatingRule{}
+		if err := v.decoder.Decode(req, rule); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		// the grants, quotas and use permissions are only checked when the spec they apply to changes
+		old := &v1alpha1.NamespacedValidatingRule{}
+		unchanged, err := v.unchanged(req, rule, old, func() bool { return equality.Semantic.DeepEqual(old.Spec, rule.Spec) })
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if unchanged {
+			return admission.Allowed("")
+		}
+
+		typeList := &v1alpha1.NamespacedValidatingTypeList{}
+		if err := v.client.List(ctx, typeList); err != nil {
+			reqLogger.Error(err, "type list failed")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		grantList := &v1alpha1.WebhookServiceGrantList{}
+		if err := v.client.List(ctx, grantList); err != nil {
+			reqLogger.Error(err, "grant list failed")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		typeData := namespacedvalidatingtype.NewNamespacedTypeData(typeList.Items)
+
+		var rules []admregv1.RuleWithOperations
+		for _, webhook := range rule.Spec.Webhooks {
+			rules = append(rules, webhook.Rules...)
+		}
+
+		// the use permission is the rule creator's, as the mutating webhook recorded them, like when the rule is
+		// reconciled.  A rule without a creator may not use any type requiring it.
+		creator, err := namespacedvalidatingrule.Creator(rule)
+		if err != nil {
+			reqLogger.Error(err, "creator retrieval failed")
+		}
+
+		usableTypes := make(map[string]bool)
+		for _, name := range namespacedvalidatingrule.UseRequiringTypes(rules, typeData) {
+			if creator == nil {
+				usableTypes[name] = false
+				continue
+			}
+
+			allowed, err := namespacedvalidatingrule.CheckUse(ctx, v.client, creator, name)
+			if err != nil {
+				reqLogger.Error(err, "subject access review failed", "Type", name)
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+			usableTypes[name] = allowed
+		}
+
+		quotaList := &v1alpha1.WebhookQuotaList{}
+		if err := v.client.List(ctx, quotaList, client.InNamespace(req.Namespace)); err != nil {
+			reqLogger.Error(err, "quota list failed")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		ruleList := &v1alpha1.NamespacedValidatingRuleList{}
+		if len(quotaList.Items) > 0 {
+			if err := v.client.List(ctx, ruleList, client.InNamespace(req.Namespace)); err != nil {
+				reqLogger.Error(err, "rule list failed")
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+		}
+
+		errs, warnings := ValidateNamespacedValidatingRule(rule, typeData, webhookservicegrant.NewGrantData(grantList.Items),
+			func(name string) bool { return usableTypes[name] })
+		errs = append(errs, ValidateRuleQuota(rule, quotaList.Items, ruleList.Items, typeData)...)
+		return toResponse(req, rule.Name, errs, warnings, reqLogger)
+	case "WebhookServiceGrant":
+		grant := &v1alpha1.WebhookServiceGrant{}
+		if err := v.decoder.Decode(req, grant); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		errs := ValidateWebhookServiceGrant(grant)
+		return toResponse(req, grant.Name, errs, nil, reqLogger)
+	case "WebhookQuota":
+		quota := &v1alpha1.WebhookQuota{}
+		if err := v.decoder.Decode(req, quota); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		errs := ValidateWebhookQuota(quota)
+		return toResponse(req, quota.Name, errs, nil, reqLogger)
+	default:
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("unexpected kind %v", req.Kind.Kind))
+	}
+}
+
+// unchanged returns true if req is for an object being deleted, or updates it without changing its spec, as
+// sameSpec finds comparing it with old, decoded from the request's old object.  Such requests are allowed without
+// validating the object again, as one that became invalid since it was admitted must still have its metadata edited,
+// its finalizer removed by the controller among them.
+func (v *Validator) unchanged(req admission.Request, object metav1.Object, old runtime.Object, sameSpec func() bool) (bool, error) {
+	if object.GetDeletionTimestamp() != nil {
+		return true, nil
+	}
+
+	if req.Operation != admv1.Update {
+		return false, nil
+	}
+
+	if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+		return false, err
+	}
+
+	return sameSpec(), nil
+}
+
+// sameAnnotation returns true if old and object have the same value for the annotation key, or both lack it
+func sameAnnotation(old, object metav1.Object, key string) bool {
+	oldValue, oldOk := old.GetAnnotations()[key]
+	value, ok := object.GetAnnotations()[key]
+
+	return oldOk == ok && oldValue == value
+}
+
+func toResponse(req admission.Request, name string, errs field.ErrorList, warnings []string, logger logr.Logger) admission.Response {
+	if len(errs) > 0 {
+		logger.Info("denying invalid resource", "errors", errs.ToAggregate().Error())
+		statusErr := apierrors.NewInvalid(v1alpha1.SchemeGroupVersion.WithKind(req.Kind.Kind).GroupKind(), name, errs)
+		return admission.Response{
+			AdmissionResponse: admv1.AdmissionResponse{
+				Allowed: false,
+				Result:  &statusErr.ErrStatus,
+			},
+		}.WithWarnings(warnings...)
+	}
+
+	return admission.Allowed("").WithWarnings(warnings...)
+}
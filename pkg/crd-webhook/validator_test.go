@@ -0,0 +1,167 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd_webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/redislabs/gesher/pkg/apis"
+	"github.com/redislabs/gesher/pkg/apis/app/v1alpha1"
+)
+
+// reviewingClient answers subject access reviews, allowing those of the users listed
+type reviewingClient struct {
+	client.Client
+	allowed []string
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if sar, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+		for _, user := range c.allowed {
+			sar.Status.Allowed = sar.Status.Allowed || sar.Spec.User == user
+		}
+		return nil
+	}
+
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func testValidator(t *testing.T, allowed []string, objects ...client.Object) *Validator {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, apis.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	v, err := NewValidator(&reviewingClient{Client: c, allowed: allowed}, scheme)
+	assert.NoError(t, err)
+
+	return v
+}
+
+func ruleRequest(t *testing.T, op admv1.Operation, rule, old *v1alpha1.NamespacedValidatingRule) admission.Request {
+	var oldObject client.Object
+	if old != nil {
+		oldObject = old
+	}
+
+	return objectRequest(t, op, "NamespacedValidatingRule", rule, oldObject)
+}
+
+func typeRequest(t *testing.T, op admv1.Operation, namespacedType, old *v1alpha1.NamespacedValidatingType) admission.Request {
+	var oldObject client.Object
+	if old != nil {
+		oldObject = old
+	}
+
+	return objectRequest(t, op, "NamespacedValidatingType", namespacedType, oldObject)
+}
+
+func objectRequest(t *testing.T, op admv1.Operation, kind string, object, old client.Object) admission.Request {
+	raw := func(object client.Object) runtime.RawExtension {
+		if object == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(object)
+		assert.NoError(t, err)
+		return runtime.RawExtension{Raw: data}
+	}
+
+	return admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+		Operation: op,
+		Kind:      metav1.GroupVersionKind{Group: v1alpha1.SchemeGroupVersion.Group, Version: v1alpha1.SchemeGroupVersion.Version, Kind: kind},
+		Namespace: object.GetNamespace(),
+		Name:      object.GetName(),
+		Object:    raw(object),
+		OldObject: raw(old),
+	}}
+}
+
+func TestHandleUnchangedRule(t *testing.T) {
+	v := testValidator(t, nil)
+
+	// no type covers the rule any longer
+	rule := testRuleResource(t)
+	rule.Spec.Webhooks[0].Name = ""
+	assert.False(t, v.Handle(context.TODO(), ruleRequest(t, admv1.Create, rule, nil)).Allowed)
+
+	// metadata edits are allowed
+	labeled := rule.DeepCopy()
+	labeled.Labels = map[string]string{"team": "a"}
+	assert.True(t, v.Handle(context.TODO(), ruleRequest(t, admv1.Update, labeled, rule)).Allowed)
+
+	// as is removing the finalizer of a rule being deleted, whatever its spec
+	deleting := labeled.DeepCopy()
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	deleting.Spec.Webhooks[0].Name = "changed"
+	assert.True(t, v.Handle(context.TODO(), ruleRequest(t, admv1.Update, deleting, labeled)).Allowed)
+
+	// but changing the spec is validated
+	changed := labeled.DeepCopy()
+	changed.Spec.Webhooks[0].Rules = nil
+	assert.False(t, v.Handle(context.TODO(), ruleRequest(t, admv1.Update, changed, labeled)).Allowed)
+}
+
+func TestHandleTypeBypassAnnotation(t *testing.T) {
+	v := testValidator(t, nil)
+
+	// annotating a type leaves its spec as it was, but the bypass annotation is still validated
+	annotated := testType.DeepCopy()
+	annotated.Annotations = map[string]string{v1alpha1.BypassAnnotation: "1h"}
+	assert.False(t, v.Handle(context.TODO(), typeRequest(t, admv1.Update, annotated, testType)).Allowed)
+
+	annotated.Annotations[v1alpha1.BypassAnnotation] = "true"
+	assert.True(t, v.Handle(context.TODO(), typeRequest(t, admv1.Update, annotated, testType)).Allowed)
+
+	// other metadata edits aren't
+	labeled := annotated.DeepCopy()
+	labeled.Labels = map[string]string{"team": "a"}
+	assert.True(t, v.Handle(context.TODO(), typeRequest(t, admv1.Update, labeled, annotated)).Allowed)
+}
+
+func TestHandleRuleCreatorUse(t *testing.T) {
+	restricted := testType.DeepCopy()
+	restricted.Spec.RequireUsePermission = true
+	v := testValidator(t, []string{"alice"}, restricted)
+
+	// the creator's use permission counts, not that of whoever updates the rule
+	old := testRuleResource(t)
+	old.Annotations = map[string]string{v1alpha1.CreatorAnnotation: `{"username":"alice"}`}
+	rule := old.DeepCopy()
+	rule.Spec.Webhooks[0].Order = 1
+	req := ruleRequest(t, admv1.Update, rule, old)
+	req.UserInfo = authenticationv1.UserInfo{Username: "bob"}
+	assert.True(t, v.Handle(context.TODO(), req).Allowed)
+
+	// a rule without a creator may not use the type
+	delete(old.Annotations, v1alpha1.CreatorAnnotation)
+	delete(rule.Annotations, v1alpha1.CreatorAnnotation)
+	req = ruleRequest(t, admv1.Update, rule, old)
+	req.UserInfo = authenticationv1.UserInfo{Username: "alice"}
+	assert.False(t, v.Handle(context.TODO(), req).Allowed)
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tls_manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/redislabs/gesher/pkg/clientauth"
+)
+
+const (
+	clientPrivateKeySecretKey = "clientPrivateKey"
+	clientCertSecretKey       = "clientCert"
+	clientCASecretKey         = "clientCA"
+	// clientCAPrivateKeySecretKey holds the key of the client CA, which outlives the client certificates it issues so
+	// that webhooks verifying them with it keep doing so across rotations
+	clientCAPrivateKeySecretKey = "clientCAPrivateKey"
+	// clientIssuedForSecretKey holds the hash of the serving certificate the client one was issued along with, so that
+	// they rotate together
+	clientIssuedForSecretKey = "clientIssuedFor"
+
+	clientCAValidity   = 10 * 365 * 24 * time.Hour
+	clientCertValidity = 5 * 365 * 24 * time.Hour
+	// clientCARenewal is how long before it expires the client CA is replaced, along with the certificate it issued
+	clientCARenewal = 365 * 24 * time.Hour
+)
+
+// NewClientCA returns the private key and certificate of a CA issuing the client certificates gesher deployed as
+// service presents to namespaced webhooks
+func NewClientCA(service string) ([]byte, []byte, error) {
+	notBefore := time.Now()
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate CA key")
+	}
+
+	caSerialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber: caSerialNumber,
+		Subject: pkix.Name{
+			CommonName:   service + "-client-ca",
+			Organization: []string{"RedisLabs Admission Control"},
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(clientCAValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create CA certificate")
+	}
+
+	pemdata := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(caKey)})
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	return pemdata, ca, nil
+}
+
+// NewClientKeyPair returns the private key and certificate gesher deployed as service in namespace presents to
+// namespaced webhooks, issued by the CA whose PEM encoded private key and certificate are caKeyPEM and caPEM.  The
+// certificate expires with the CA, if not before.
+func NewClientKeyPair(namespace, service string, caKeyPEM, caPEM []byte) ([]byte, []byte, error) {
+	caKey, caCert, err := parseClientCA(caKeyPEM, caPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notBefore := time.Now()
+	notAfter := notBefore.Add(clientCertValidity)
+	if caCert.NotAfter.Before(notAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate client key")
+	}
+
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   service,
+			Organization: []string{"RedisLabs Admission Control"},
+		},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		URIs:        []*url.URL{clientauth.Identity(namespace, service)},
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, privateKey.Public(), caKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create client certificate")
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	pemdata := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	return pemdata, cert, nil
+}
+
+// parseClientCA returns the private key and certificate of the client CA, verifying they belong together
+func parseClientCA(caKeyPEM, caPEM []byte) (*rsa.PrivateKey, *x509.Certificate, error) {
+	keyBlock, _ := pem.Decode(caKeyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("client CA private key isn't PEM encoded")
+	}
+	caKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse client CA private key")
+	}
+
+	certBlock, _ := pem.Decode(caPEM)
+	if certBlock == nil {
+		return nil, nil, errors.New("client CA certificate isn't PEM encoded")
+	}
+	caCert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse client CA certificate")
+	}
+
+	if !caCert.IsCA || !caKey.PublicKey.Equal(caCert.PublicKey) {
+		return nil, nil, errors.New("client CA certificate doesn't match its private key")
+	}
+
+	return caKey, caCert, nil
+}
+
+// usableClientCA returns true if the client CA whose PEM encoded private key and certificate are caKeyPEM and caPEM
+// may keep issuing client certificates at now
+func usableClientCA(caKeyPEM, caPEM []byte, now time.Time) bool {
+	_, caCert, err := parseClientCA(caKeyPEM, caPEM)
+	if err != nil {
+		klog.Warningf("client CA can't be used: %v", err)
+		return false
+	}
+
+	return now.Add(clientCARenewal).Before(caCert.NotAfter)
+}
+
+func (k *kubeTLSManager) HasClientKey() bool {
+	secret, err := k.getSecret()
+	if err != nil {
+		klog.Error(err, "HasClientKey's call to GetSecret failed")
+		return false
+	}
+	if secret == nil {
+		return false
+	}
+
+	for _, key := range []string{clientPrivateKeySecretKey, clientCertSecretKey, clientCASecretKey, clientCAPrivateKeySecretKey} {
+		if _, ok := secret.Data[key]; !ok {
+			return false
+		}
+	}
+
+	// a client certificate issued along with another serving certificate is rotated, as it is when its CA nears expiry
+	return bytes.Equal(secret.Data[clientIssuedForSecretKey], issuedFor(secret.Data[certSecretKey])) &&
+		usableClientCA(secret.Data[clientCAPrivateKeySecretKey], secret.Data[clientCASecretKey], time.Now())
+}
+
+func (k *kubeTLSManager) CreateClientKey(namespace, service string) error {
+	secret, err := k.getSecret()
+	if err != nil {
+		return errors.Wrap(err, "GetSecret failed")
+	}
+	if secret == nil {
+		return errors.New("private key secret doesn't exit")
+	}
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+
+	// the CA is kept for as long as it is usable, for the bundle webhooks verify the proxy with not to change
+	caKey, ca := secret.Data[clientCAPrivateKeySecretKey], secret.Data[clientCASecretKey]
+	if !usableClientCA(caKey, ca, time.Now()) {
+		klog.Infof("CreateClientKey: creating a new client CA")
+		caKey, ca, err = NewClientCA(service)
+		if err != nil {
+			return err
+		}
+	}
+
+	privKey, cert, err := NewClientKeyPair(namespace, service, caKey, ca)
+	if err != nil {
+		return err
+	}
+
+	secret.Data[clientPrivateKeySecretKey] = privKey
+	secret.Data[clientCertSecretKey] = cert
+	secret.Data[clientCASecretKey] = ca
+	secret.Data[clientCAPrivateKeySecretKey] = caKey
+	secret.Data[clientIssuedForSecretKey] = issuedFor(secret.Data[certSecretKey])
+
+	klog.Infof("CreateClientKey: namespace = %v, secret = %v", k.namespace, k.name)
+	_, err = k.kubeClient.CoreV1().Secrets(k.namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	if err != nil {
+		err = errors.Wrap(err, "createClientKey failed to update secret")
+	}
+
+	return err
+}
+
+func (k *kubeTLSManager) GetClientKey() ([]byte, []byte, []byte, error) {
+	secret, err := k.getSecret()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "GetSecret failed")
+	}
+	if secret == nil {
+		return nil, nil, nil, errors.New("private key secret doesn't exit")
+	}
+
+	privKey, ok := secret.Data[clientPrivateKeySecretKey]
+	if !ok {
+		return nil, nil, nil, errors.New("secret doesn't contain client private key")
+	}
+
+	cert, ok := secret.Data[clientCertSecretKey]
+	if !ok {
+		return nil, nil, nil, errors.New("secret doesn't contain client certificate")
+	}
+
+	ca, ok := secret.Data[clientCASecretKey]
+	if !ok {
+		return nil, nil, nil, errors.New("secret doesn't contain client CA")
+	}
+
+	return privKey, cert, ca, nil
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate serial number")
+	}
+
+	return serialNumber, nil
+}
+
+// issuedFor identifies a serving certificate, for the client certificate issued along with it
+func issuedFor(cert []byte) []byte {
+	sum := sha256.Sum256(cert)
+	return []byte(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tls_manager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateClientKeyKeepsCA(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "tls"},
+		Data:       map[string][]byte{certSecretKey: []byte("serving")},
+	})
+	tlsManager := NewTLSManager(client, "test", "tls", nil, nil)
+	assert.False(t, tlsManager.HasClientKey())
+
+	assert.NoError(t, tlsManager.CreateClientKey("test", "gesher"))
+	assert.True(t, tlsManager.HasClientKey())
+	_, firstCert, firstCA, err := tlsManager.GetClientKey()
+	assert.NoError(t, err)
+
+	// rotating the client certificate along with a new serving one keeps the CA webhooks verify it with
+	secret, err := client.CoreV1().Secrets("test").Get(context.TODO(), "tls", metav1.GetOptions{})
+	assert.NoError(t, err)
+	secret.Data[certSecretKey] = []byte("rotated")
+	_, err = client.CoreV1().Secrets("test").Update(context.TODO(), secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.False(t, tlsManager.HasClientKey())
+
+	assert.NoError(t, tlsManager.CreateClientKey("test", "gesher"))
+	_, cert, ca, err := tlsManager.GetClientKey()
+	assert.NoError(t, err)
+	assert.Equal(t, firstCA, ca)
+	assert.NotEqual(t, firstCert, cert)
+	assert.NoError(t, verifyClientCert(cert, ca))
+}
+
+func TestUsableClientCA(t *testing.T) {
+	caKey, ca, err := NewClientCA("gesher")
+	assert.NoError(t, err)
+	assert.True(t, usableClientCA(caKey, ca, time.Now()))
+
+	// a CA nearing expiry is replaced
+	assert.False(t, usableClientCA(caKey, ca, time.Now().Add(clientCAValidity-clientCARenewal)))
+
+	otherKey, _, err := NewClientCA("gesher")
+	assert.NoError(t, err)
+	assert.False(t, usableClientCA(otherKey, ca, time.Now()))
+	assert.False(t, usableClientCA(nil, ca, time.Now()))
+}
+
+func verifyClientCert(cert, ca []byte) error {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	block, _ := pem.Decode(cert)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	return err
+}
@@ -43,6 +43,9 @@ type TLSManager interface {
 	CreateKey() error
 	GetKey() (privKey []byte, csr []byte, err error)
 	ConfigTLS([]byte, []byte) *tls.Config
+	HasClientKey() bool
+	CreateClientKey(namespace, service string) error
+	GetClientKey() (privKey []byte, cert []byte, ca []byte, err error)
 }
 
 const (
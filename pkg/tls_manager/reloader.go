@@ -0,0 +1,132 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tls_manager
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeyPairReloader serves a key pair from PEM files, loading it again whenever either of them changes
+type KeyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewKeyPairReloader(certFile, keyFile string) *KeyPairReloader {
+	return &KeyPairReloader{certFile: certFile, keyFile: keyFile}
+}
+
+// Load returns the current key pair, loading it again if the files changed since it last was
+func (r *KeyPairReloader) Load() (*tls.Certificate, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+
+	return r.cert, nil
+}
+
+// GetClientCertificate is meant for tls.Config.  It sends no certificate when the key pair can't be loaded, leaving
+// the server to decide whether to go on without one.
+func (r *KeyPairReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := r.Load()
+	if err != nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return cert, nil
+}
+
+func (r *KeyPairReloader) latestModTime() (time.Time, error) {
+	return latestModTime(r.certFile, r.keyFile)
+}
+
+// FileReloader serves the content of a file, reading it again whenever it changes
+type FileReloader struct {
+	file string
+
+	mu      sync.Mutex
+	data    []byte
+	modTime time.Time
+}
+
+func NewFileReloader(file string) *FileReloader {
+	return &FileReloader{file: file}
+}
+
+// Load returns the file's current content, reading it again if it changed since it last was
+func (r *FileReloader) Load() ([]byte, error) {
+	modTime, err := latestModTime(r.file)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.data != nil && !modTime.After(r.modTime) {
+		return r.data, nil
+	}
+
+	data, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return nil, err
+	}
+
+	r.data = data
+	r.modTime = modTime
+
+	return r.data, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 Redis Labs Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tls_manager
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPairReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reloader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	reloader := NewKeyPairReloader(certFile, keyFile)
+
+	// no certificate is sent before there is one
+	_, err = reloader.Load()
+	assert.Error(t, err)
+	cert, err := reloader.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, cert.Certificate)
+
+	writeKeyPair(t, certFile, keyFile, "first", time.Now())
+	cert, err = reloader.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", leafName(t, cert.Certificate[0]))
+
+	// the files changing makes for a new key pair
+	writeKeyPair(t, certFile, keyFile, "second", time.Now().Add(time.Minute))
+	cert, err = reloader.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", leafName(t, cert.Certificate[0]))
+}
+
+func TestFileReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reloader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "ca.pem")
+	reloader := NewFileReloader(file)
+
+	_, err = reloader.Load()
+	assert.Error(t, err)
+
+	writeFile(t, file, "first", time.Now())
+	data, err := reloader.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	// the file is only read again once it changes
+	assert.NoError(t, ioutil.WriteFile(file, []byte("unseen"), 0600))
+	assert.NoError(t, os.Chtimes(file, reloader.modTime, reloader.modTime))
+	data, err = reloader.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	writeFile(t, file, "second", time.Now().Add(time.Minute))
+	data, err = reloader.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+}
+
+func writeFile(t *testing.T, file, data string, modTime time.Time) {
+	assert.NoError(t, ioutil.WriteFile(file, []byte(data), 0600))
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+}
+
+func writeKeyPair(t *testing.T, certFile, keyFile, service string, modTime time.Time) {
+	caKey, ca, err := NewClientCA(service)
+	assert.NoError(t, err)
+	privKey, cert, err := NewClientKeyPair("test", service, caKey, ca)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(certFile, cert, 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, privKey, 0600))
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func leafName(t *testing.T, der []byte) string {
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
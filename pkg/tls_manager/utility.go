@@ -57,6 +57,22 @@ func GenerateTLS(client kubernetes.Interface, namespace, serviceName, secretName
 	return tlsManager.GetKey()
 }
 
+// GenerateClientTLS returns the client key pair gesher presents to namespaced webhooks and the CA it is issued from,
+// adding them to the secret GenerateTLS keeps the serving key pair in when they are missing or were issued along with
+// another serving certificate
+func GenerateClientTLS(client kubernetes.Interface, namespace, serviceName, secretName string) ([]byte, []byte, []byte, error) {
+	tlsManager := NewTLSManager(client, namespace, secretName, nil, nil)
+
+	if !tlsManager.HasClientKey() {
+		err := tlsManager.CreateClientKey(namespace, serviceName)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to create client key")
+		}
+	}
+
+	return tlsManager.GetClientKey()
+}
+
 func GetIPsAndNames(ips []net.IP, serviceName string, namespace string) ([]net.IP, []string) {
 	podIp := os.Getenv("POD_IP")
 	if podIp != "" {